@@ -0,0 +1,94 @@
+package artifact
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type cacheEntry struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+// Remove the least recently used entries until the cache fits its size limit.
+// The entries in keep were just used and are never evicted.
+func (f *Fetcher) evict(keep ...string) error {
+	if f.MaxSize <= 0 {
+		return nil
+	}
+
+	entries, err := f.entries()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	if total <= f.MaxSize {
+		return nil
+	}
+
+	sort.Slice(entries, func(ii, jj int) bool {
+		return entries[ii].lastUsed.Before(entries[jj].lastUsed)
+	})
+
+	kept := map[string]bool{}
+	for _, k := range keep {
+		kept[k] = true
+	}
+	for _, e := range entries {
+		if total <= f.MaxSize {
+			break
+		}
+		if kept[e.path] {
+			continue
+		}
+		if err := os.RemoveAll(e.path); err != nil {
+			return err
+		}
+		total -= e.size
+	}
+	// url index entries of evicted objects are dropped lazily on lookup
+	return nil
+}
+
+// Objects and extracted archives along with their size and last use
+func (f *Fetcher) entries() ([]cacheEntry, error) {
+	var entries []cacheEntry
+	for _, sub := range []string{"objects", "extracted"} {
+		infos, err := ioutil.ReadDir(filepath.Join(f.Dir, sub))
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			path := filepath.Join(f.Dir, sub, info.Name())
+			size := info.Size()
+			if info.IsDir() {
+				size = dirSize(path)
+			}
+			entries = append(entries, cacheEntry{
+				path:     path,
+				size:     size,
+				lastUsed: info.ModTime(),
+			})
+		}
+	}
+	return entries, nil
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
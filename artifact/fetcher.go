@@ -0,0 +1,366 @@
+// Package artifact downloads model artifacts into a local content addressed cache.
+//
+// The cache directory is laid out as
+//
+//	objects/<sha256>      downloaded files, named by the digest of their content
+//	extracted/<sha256>/   extracted content of archives
+//	urls/<sha256 of url>  digest of the object last downloaded from the url
+//	partial/<sha256 of url>  interrupted downloads, resumed with range requests
+//	partial/<sha256 of url>.validator  ETag or Last-Modified the download started from
+//
+// The access time of an entry is tracked through its modification time, which
+// is used to evict the least recently used entries once the cache grows beyond
+// its size limit.
+package artifact
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Fetcher downloads files over HTTP(S) into a cache directory
+type Fetcher struct {
+	// root of the cache
+	Dir string
+	// maximum size of the cache in bytes, 0 means unlimited
+	MaxSize int64
+	// client used for the downloads, defaults to http.DefaultClient
+	Client *http.Client
+
+	mu sync.Mutex
+}
+
+// Create new fetcher storing its files under dir
+func NewFetcher(dir string, maxSize int64) (*Fetcher, error) {
+	for _, sub := range []string{"objects", "extracted", "urls", "partial"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, errors.Wrapf(err, "failed to create cache directory %s", dir)
+		}
+	}
+	return &Fetcher{
+		Dir:     dir,
+		MaxSize: maxSize,
+	}, nil
+}
+
+// Download a file unless it is cached already and return its local path.
+// The checksum is an optional md5 or sha256 hex digest of the content.
+func (f *Fetcher) Fetch(ctx context.Context, url, checksum string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path, err := f.fetch(ctx, url, checksum)
+	if err != nil {
+		return "", err
+	}
+	if err := f.evict(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Download an archive (tar, tar.gz or zip) unless it is cached already
+// and return the directory it was extracted to
+func (f *Fetcher) FetchArchive(ctx context.Context, url, checksum string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path, dir, err := f.fetchArchive(ctx, url, checksum)
+	if err != nil {
+		return "", err
+	}
+	if err := f.evict(path, dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Download and extract an archive, returns the archive and its directory
+func (f *Fetcher) fetchArchive(ctx context.Context, url, checksum string) (string, string, error) {
+	path, err := f.fetch(ctx, url, checksum)
+	if err != nil {
+		return "", "", err
+	}
+	dir := filepath.Join(f.Dir, "extracted", filepath.Base(path))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := extract(path, dir); err != nil {
+			return "", "", err
+		}
+	}
+	touch(dir)
+	return path, dir, nil
+}
+
+func (f *Fetcher) fetch(ctx context.Context, url, checksum string) (string, error) {
+	algorithm, expected, err := parseChecksum(checksum)
+	if err != nil {
+		return "", err
+	}
+
+	urlKey := hashString(url)
+	indexFile := filepath.Join(f.Dir, "urls", urlKey)
+
+	// cache hit, the object is still there and matches the expected content
+	if digest, err := ioutil.ReadFile(indexFile); err == nil {
+		path := f.objectPath(strings.TrimSpace(string(digest)))
+		if _, err := os.Stat(path); err == nil {
+			if expected == "" || algorithm == "sha256" && filepath.Base(path) == expected {
+				touch(path)
+				return path, nil
+			}
+			if ok, err := checkFile(path, algorithm, expected); err == nil && ok {
+				touch(path)
+				return path, nil
+			}
+		}
+	}
+
+	partial := filepath.Join(f.Dir, "partial", urlKey)
+	if err := f.download(ctx, url, partial); err != nil {
+		return "", err
+	}
+
+	sha, md, err := digests(partial)
+	if err != nil {
+		return "", err
+	}
+	actual := sha
+	if algorithm == "md5" {
+		actual = md
+	}
+	if expected != "" && actual != expected {
+		// a corrupted partial file must not be resumed
+		removePartial(partial)
+		return "", errors.Errorf("%s checksum mismatch for %s: expected %s, got %s", algorithm, url, expected, actual)
+	}
+
+	path := f.objectPath(sha)
+	if err := os.Rename(partial, path); err != nil {
+		return "", errors.Wrapf(err, "failed to move %s into the cache", url)
+	}
+	os.Remove(validatorPath(partial))
+	touch(path)
+	if err := ioutil.WriteFile(indexFile, []byte(sha), 0644); err != nil {
+		return "", errors.Wrapf(err, "failed to index %s", url)
+	}
+	return path, nil
+}
+
+// Download url into the partial file, resuming from its current size when
+// the remote file is unchanged and starting over otherwise
+func (f *Fetcher) download(ctx context.Context, url, partial string) error {
+	restart, err := f.downloadFrom(ctx, url, partial, true)
+	if err != nil || !restart {
+		return err
+	}
+	removePartial(partial)
+	_, err = f.downloadFrom(ctx, url, partial, false)
+	return err
+}
+
+// Single download request, returns true when the partial file cannot be
+// resumed and the download has to start over
+func (f *Fetcher) downloadFrom(ctx context.Context, url, partial string, resume bool) (bool, error) {
+	var offset int64
+	var validator string
+	if resume {
+		if st, err := os.Stat(partial); err == nil {
+			offset = st.Size()
+		}
+		if buf, err := ioutil.ReadFile(validatorPath(partial)); err == nil {
+			validator = strings.TrimSpace(string(buf))
+		}
+		// without a validator there is no telling whether the remote file changed
+		if offset > 0 && validator == "" {
+			return true, nil
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid url %s", url)
+	}
+	req = req.WithContext(ctx)
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		// the server sends the whole file when it no longer matches the validator
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to download %s", url)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, _, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if offset == 0 || !ok || start != offset {
+			return true, nil
+		}
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// the server ignored the range or the remote file changed, start over
+		flags |= os.O_TRUNC
+		if err := writeValidator(partial, resp.Header); err != nil {
+			return false, err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the validator matched, the partial file is complete when it has the full size
+		_, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if offset > 0 && ok && total == offset {
+			return false, nil
+		}
+		if offset > 0 {
+			return true, nil
+		}
+		return false, errors.Errorf("failed to download %s: %s", url, resp.Status)
+	default:
+		return false, errors.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+
+	out, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to open %s", partial)
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		return false, errors.Wrapf(err, "download of %s interrupted", url)
+	}
+	return false, out.Close()
+}
+
+// Record the validator a resumed download is checked against, a strong ETag
+// or else the modification time. Weak ETags cannot be used with If-Range.
+func writeValidator(partial string, header http.Header) error {
+	validator := header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = header.Get("Last-Modified")
+	}
+	if validator == "" {
+		os.Remove(validatorPath(partial))
+		return nil
+	}
+	if err := ioutil.WriteFile(validatorPath(partial), []byte(validator), 0644); err != nil {
+		return errors.Wrapf(err, "failed to write %s", validatorPath(partial))
+	}
+	return nil
+}
+
+func validatorPath(partial string) string {
+	return partial + ".validator"
+}
+
+func removePartial(partial string) {
+	os.Remove(partial)
+	os.Remove(validatorPath(partial))
+}
+
+// Parse a Content-Range header of the form "bytes start-end/total" or
+// "bytes */total", returns the first byte and the total size, -1 when unknown
+func parseContentRange(header string) (int64, int64, bool) {
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, false
+	}
+	kv := strings.SplitN(strings.TrimPrefix(header, "bytes "), "/", 2)
+	if len(kv) != 2 {
+		return 0, 0, false
+	}
+	total := int64(-1)
+	if kv[1] != "*" {
+		n, err := strconv.ParseInt(kv[1], 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		total = n
+	}
+	start := int64(-1)
+	if kv[0] != "*" {
+		bounds := strings.SplitN(kv[0], "-", 2)
+		n, err := strconv.ParseInt(bounds[0], 10, 64)
+		if err != nil || len(bounds) != 2 {
+			return 0, 0, false
+		}
+		start = n
+	}
+	return start, total, true
+}
+
+func (f *Fetcher) client() *http.Client {
+	if f.Client != nil {
+		return f.Client
+	}
+	return http.DefaultClient
+}
+
+func (f *Fetcher) objectPath(digest string) string {
+	return filepath.Join(f.Dir, "objects", digest)
+}
+
+func parseChecksum(checksum string) (string, string, error) {
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	if kv := strings.SplitN(checksum, ":", 2); len(kv) == 2 {
+		checksum = kv[1]
+	}
+	switch len(checksum) {
+	case 0:
+		return "sha256", "", nil
+	case 2 * md5.Size:
+		return "md5", checksum, nil
+	case 2 * sha256.Size:
+		return "sha256", checksum, nil
+	}
+	return "", "", errors.Errorf("checksum %s is neither md5 nor sha256", checksum)
+}
+
+func checkFile(path, algorithm, expected string) (bool, error) {
+	sha, md, err := digests(path)
+	if err != nil {
+		return false, err
+	}
+	if algorithm == "md5" {
+		return md == expected, nil
+	}
+	return sha == expected, nil
+}
+
+// Compute the sha256 and md5 digests of a file in one pass
+func digests(path string) (string, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer f.Close()
+	var sha, md hash.Hash = sha256.New(), md5.New()
+	if _, err := io.Copy(io.MultiWriter(sha, md), f); err != nil {
+		return "", "", errors.Wrapf(err, "failed to hash %s", path)
+	}
+	return hex.EncodeToString(sha.Sum(nil)), hex.EncodeToString(md.Sum(nil)), nil
+}
+
+func hashString(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// Mark an entry as recently used
+func touch(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
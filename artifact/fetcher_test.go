@@ -0,0 +1,295 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rai-project/dlframework"
+)
+
+// Serves named files with range support, each file version gets its own ETag
+type fileServer struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	etags    map[string]string
+	requests []*http.Request
+	// serve only the first half of the next response of a file, then drop the connection
+	truncate map[string]bool
+}
+
+func newFileServer() *fileServer {
+	return &fileServer{
+		files:    map[string][]byte{},
+		etags:    map[string]string{},
+		truncate: map[string]bool{},
+	}
+}
+
+func (s *fileServer) set(name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = data
+	s.etags[name] = `"` + digest(data)[:16] + `"`
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	name := r.URL.Path
+	data, ok := s.files[name]
+	etag := s.etags[name]
+	truncate := s.truncate[name]
+	delete(s.truncate, name)
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if truncate {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(data[:len(data)/2])
+		return
+	}
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+}
+
+func (s *fileServer) lastRequest() *http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+func digest(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func content(n int, seed byte) []byte {
+	data := make([]byte, n)
+	for ii := range data {
+		data[ii] = seed + byte(ii%251)
+	}
+	return data
+}
+
+func newTestFetcher(t *testing.T, maxSize int64) (*Fetcher, func()) {
+	dir, err := ioutil.TempDir("", "artifact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFetcher(dir, maxSize)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return f, func() { os.RemoveAll(dir) }
+}
+
+func readFile(t *testing.T, path string) []byte {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestFetchResumesInterruptedDownload(t *testing.T) {
+	srv := newFileServer()
+	data := content(64*1024, 1)
+	srv.set("/model.dlc", data)
+	srv.truncate["/model.dlc"] = true
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	f, cleanup := newTestFetcher(t, 0)
+	defer cleanup()
+	url := ts.URL + "/model.dlc"
+
+	if _, err := f.Fetch(context.Background(), url, ""); err == nil {
+		t.Fatal("expected the truncated download to fail")
+	}
+
+	path, err := f.Fetch(context.Background(), url, "sha256:"+digest(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readFile(t, path), data) {
+		t.Fatal("resumed download does not match the served file")
+	}
+	req := srv.lastRequest()
+	if got, want := req.Header.Get("Range"), "bytes="+strconv.Itoa(len(data)/2)+"-"; got != want {
+		t.Errorf("Range = %q, want %q", got, want)
+	}
+	if got, want := req.Header.Get("If-Range"), srv.etags["/model.dlc"]; got != want {
+		t.Errorf("If-Range = %q, want %q", got, want)
+	}
+}
+
+func TestFetchRestartsWhenRemoteFileChanged(t *testing.T) {
+	srv := newFileServer()
+	srv.set("/labels.txt", content(32*1024, 1))
+	srv.truncate["/labels.txt"] = true
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	f, cleanup := newTestFetcher(t, 0)
+	defer cleanup()
+	url := ts.URL + "/labels.txt"
+
+	if _, err := f.Fetch(context.Background(), url, ""); err == nil {
+		t.Fatal("expected the truncated download to fail")
+	}
+
+	// no checksum, the content must not be spliced from both versions
+	changed := content(32*1024, 7)
+	srv.set("/labels.txt", changed)
+	path, err := f.Fetch(context.Background(), url, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readFile(t, path), changed) {
+		t.Fatal("download mixes the old and the new remote file")
+	}
+}
+
+func TestFetchChecksumMismatch(t *testing.T) {
+	srv := newFileServer()
+	data := content(1024, 1)
+	srv.set("/model.dlc", data)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	f, cleanup := newTestFetcher(t, 0)
+	defer cleanup()
+	url := ts.URL + "/model.dlc"
+
+	if _, err := f.Fetch(context.Background(), url, "sha256:"+digest([]byte("other"))); err == nil {
+		t.Fatal("expected a checksum mismatch")
+	}
+	objects, err := ioutil.ReadDir(filepath.Join(f.Dir, "objects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("mismatching download was cached: %d objects", len(objects))
+	}
+	partials, err := ioutil.ReadDir(filepath.Join(f.Dir, "partial"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(partials) != 0 {
+		t.Errorf("mismatching download was kept for resuming: %d files", len(partials))
+	}
+
+	if _, err := f.Fetch(context.Background(), url, digest(data)); err != nil {
+		t.Fatalf("fetch with the right checksum: %v", err)
+	}
+}
+
+func TestFetchEvictsLeastRecentlyUsed(t *testing.T) {
+	srv := newFileServer()
+	for ii, name := range []string{"/a", "/b", "/c"} {
+		srv.set(name, content(1000, byte(ii)))
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	f, cleanup := newTestFetcher(t, 2500)
+	defer cleanup()
+	ctx := context.Background()
+
+	a, err := f.Fetch(ctx, ts.URL+"/a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Fetch(ctx, ts.URL+"/b", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(b, old, old)
+	os.Chtimes(a, old.Add(time.Minute), old.Add(time.Minute))
+
+	c, err := f.Fetch(ctx, ts.URL+"/c", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{a: true, b: false, c: true} {
+		if _, err := os.Stat(path); (err == nil) != want {
+			t.Errorf("%s cached = %v, want %v", filepath.Base(path), err == nil, want)
+		}
+	}
+
+	// evicted objects are downloaded again
+	if _, err := f.Fetch(ctx, ts.URL+"/b", ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFetchModelKeepsItsFiles(t *testing.T) {
+	srv := newFileServer()
+	srv.set("/models/mobilenet.dlc", content(2000, 1))
+	srv.set("/models/labels.txt", content(2000, 2))
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	// room for a single file only
+	f, cleanup := newTestFetcher(t, 2500)
+	defer cleanup()
+
+	m := &dlframework.ModelManifest{
+		Name: "mobilenet",
+		Model: &dlframework.ModelManifest_Model{
+			BaseUrl:   ts.URL + "/models",
+			GraphPath: "mobilenet.dlc",
+		},
+		Attributes: map[string]string{
+			"features_url": "labels.txt",
+		},
+	}
+	files, err := f.FetchModel(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{files.Graph, files.Labels} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("file of the model was evicted: %v", err)
+		}
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	cases := []struct {
+		header       string
+		start, total int64
+		ok           bool
+	}{
+		{"bytes 100-199/200", 100, 200, true},
+		{"bytes 0-99/*", 0, -1, true},
+		{"bytes */200", -1, 200, true},
+		{"bytes 100/200", 0, 0, false},
+		{"items 0-1/2", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, c := range cases {
+		start, total, ok := parseContentRange(c.header)
+		if start != c.start || total != c.total || ok != c.ok {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v, want %d, %d, %v",
+				c.header, start, total, ok, c.start, c.total, c.ok)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package artifact
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rai-project/dlframework"
+)
+
+// ModelFiles are the local copies of the files of a model manifest
+type ModelFiles struct {
+	Graph  string
+	Labels string
+}
+
+// Fetch the DLC and label files described by a model manifest.
+// When the model is an archive, BaseUrl points to the archive and
+// GraphPath is the location of the DLC inside of it. None of the files
+// of the model is evicted to make room for the others.
+func (f *Fetcher) FetchModel(ctx context.Context, m *dlframework.ModelManifest) (*ModelFiles, error) {
+	model := m.GetModel()
+	if model == nil {
+		return nil, errors.Errorf("the manifest of %s has no model section", m.GetName())
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var keep []string
+	files := &ModelFiles{}
+	if model.GetIsArchive() {
+		archive, dir, err := f.fetchArchive(ctx, model.GetBaseUrl(), "")
+		if err != nil {
+			return nil, err
+		}
+		keep = append(keep, archive, dir)
+		graph, err := safeJoin(dir, model.GetGraphPath())
+		if err != nil {
+			return nil, err
+		}
+		if checksum := model.GetGraphChecksum(); checksum != "" {
+			algorithm, expected, err := parseChecksum(checksum)
+			if err != nil {
+				return nil, err
+			}
+			ok, err := checkFile(graph, algorithm, expected)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, errors.Errorf("%s checksum mismatch for %s in %s", algorithm, model.GetGraphPath(), model.GetBaseUrl())
+			}
+		}
+		files.Graph = graph
+	} else {
+		graphURL, err := resolveURL(model.GetBaseUrl(), model.GetGraphPath())
+		if err != nil {
+			return nil, err
+		}
+		graph, err := f.fetch(ctx, graphURL, model.GetGraphChecksum())
+		if err != nil {
+			return nil, err
+		}
+		keep = append(keep, graph)
+		files.Graph = graph
+	}
+
+	// classification labels are referenced through the manifest attributes
+	if labelsURL := m.GetAttributes()["features_url"]; labelsURL != "" {
+		labelsURL, err := resolveURL(model.GetBaseUrl(), labelsURL)
+		if err != nil {
+			return nil, err
+		}
+		labels, err := f.fetch(ctx, labelsURL, m.GetAttributes()["features_checksum"])
+		if err != nil {
+			return nil, err
+		}
+		keep = append(keep, labels)
+		files.Labels = labels
+	}
+
+	if err := f.evict(keep...); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Resolve a path relative to a base url, absolute urls are returned as is
+func resolveURL(base, p string) (string, error) {
+	if u, err := url.Parse(p); err == nil && u.IsAbs() {
+		return p, nil
+	}
+	if base == "" {
+		return "", errors.Errorf("cannot resolve %s without a base url", p)
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid base url %s", base)
+	}
+	u.Path = path.Join(u.Path, filepath.ToSlash(strings.TrimPrefix(p, "/")))
+	return u.String(), nil
+}
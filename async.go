@@ -0,0 +1,254 @@
+package snpe
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultQueueSize is the number of submissions an AsyncPredictor holds
+const DefaultQueueSize = 16
+
+var (
+	// ErrQueueFull is returned by TrySubmit when the submission queue is full
+	ErrQueueFull = errors.New("submission queue is full")
+	// ErrAsyncClosed is returned for submissions to a closed AsyncPredictor
+	ErrAsyncClosed = errors.New("async predictor is closed")
+	// ErrCanceled is the result of a submission cancelled before it ran
+	ErrCanceled = errors.New("submission canceled")
+)
+
+// AsyncOptions configures an AsyncPredictor
+type AsyncOptions struct {
+	// maximum number of pending submissions, defaults to DefaultQueueSize
+	QueueSize int
+	// whether inputs are passed to the model as quantized data
+	Quantize bool
+}
+
+const (
+	futurePending int32 = iota
+	futureRunning
+	futureDone
+)
+
+// Future is the pending result of a submission
+type Future struct {
+	ctx    context.Context
+	data   []byte
+	inputs []Tensor
+
+	state   int32
+	done    chan struct{}
+	outputs []Tensor
+	err     error
+}
+
+// Closed once the result is available
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait for the output tensors of the submission
+func (f *Future) Result() ([]Tensor, error) {
+	<-f.done
+	return f.outputs, f.err
+}
+
+// Wait for the output tensors until the context is done. The submission
+// keeps its place in the queue when the wait is abandoned.
+func (f *Future) Wait(ctx context.Context) ([]Tensor, error) {
+	select {
+	case <-f.done:
+		return f.outputs, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Cancel a submission that has not started running, its result becomes
+// ErrCanceled. Returns false when it is already running or done.
+func (f *Future) Cancel() bool {
+	if !atomic.CompareAndSwapInt32(&f.state, futurePending, futureDone) {
+		return false
+	}
+	f.err = ErrCanceled
+	close(f.done)
+	return true
+}
+
+func (f *Future) complete(outputs []Tensor, err error) {
+	f.outputs, f.err = outputs, err
+	atomic.StoreInt32(&f.state, futureDone)
+	close(f.done)
+}
+
+// AsyncPredictor runs submissions on a predictor from a bounded queue.
+//
+// Submissions run one at a time in the order they were accepted, so the
+// futures of a single submitting goroutine complete in submission order.
+// There is no order between submissions of concurrent goroutines other than
+// the order in which they entered the queue. Cancelled submissions and
+// submissions whose context is done are skipped.
+type AsyncPredictor struct {
+	p    *PredictorData
+	opts AsyncOptions
+
+	queue chan *Future
+	done  chan struct{}
+	wg    sync.WaitGroup
+	// guards closed so that nothing is queued after the final drain
+	mu     sync.RWMutex
+	closed bool
+
+	pending int64
+}
+
+// Create new asynchronous front end of a predictor
+func NewAsyncPredictor(p *PredictorData, opts AsyncOptions) (*AsyncPredictor, error) {
+	if p == nil {
+		return nil, errors.New("empty predictor")
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	a := &AsyncPredictor{
+		p:     p,
+		opts:  opts,
+		queue: make(chan *Future, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+	a.wg.Add(1)
+	go a.loop()
+	return a, nil
+}
+
+// Queue an input, blocking while the queue is full until there is room or
+// the context is done. The context also cancels the submission while it
+// waits in the queue.
+func (a *AsyncPredictor) Submit(ctx context.Context, data []byte) (*Future, error) {
+	if len(data) == 0 {
+		return nil, errors.New("image data is empty")
+	}
+	return a.submit(ctx, &Future{ctx: ctx, data: data}, true)
+}
+
+// Queue the named inputs of a network with several inputs, see Submit
+func (a *AsyncPredictor) SubmitInputs(ctx context.Context, inputs []Tensor) (*Future, error) {
+	if len(inputs) == 0 {
+		return nil, errors.New("no inputs")
+	}
+	return a.submit(ctx, &Future{ctx: ctx, inputs: inputs}, true)
+}
+
+// Queue an input without blocking, returns ErrQueueFull when there is no room
+func (a *AsyncPredictor) TrySubmit(ctx context.Context, data []byte) (*Future, error) {
+	if len(data) == 0 {
+		return nil, errors.New("image data is empty")
+	}
+	return a.submit(ctx, &Future{ctx: ctx, data: data}, false)
+}
+
+// Number of submissions waiting in the queue
+func (a *AsyncPredictor) Pending() int {
+	return int(atomic.LoadInt64(&a.pending))
+}
+
+// Stop accepting submissions and wait for the pending ones to run.
+// The underlying predictor is not closed.
+func (a *AsyncPredictor) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.done)
+	}
+	a.mu.Unlock()
+	a.wg.Wait()
+}
+
+func (a *AsyncPredictor) submit(ctx context.Context, f *Future, block bool) (*Future, error) {
+	if ctx == nil {
+		ctx = context.Background()
+		f.ctx = ctx
+	}
+	f.done = make(chan struct{})
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return nil, ErrAsyncClosed
+	}
+	atomic.AddInt64(&a.pending, 1)
+	if !block {
+		select {
+		case a.queue <- f:
+			return f, nil
+		default:
+			atomic.AddInt64(&a.pending, -1)
+			return nil, ErrQueueFull
+		}
+	}
+	select {
+	case a.queue <- f:
+		return f, nil
+	case <-ctx.Done():
+		atomic.AddInt64(&a.pending, -1)
+		return nil, ctx.Err()
+	}
+}
+
+func (a *AsyncPredictor) loop() {
+	defer a.wg.Done()
+	for {
+		select {
+		case f := <-a.queue:
+			a.run(f)
+		case <-a.done:
+			// nothing is queued once closed is set
+			for {
+				select {
+				case f := <-a.queue:
+					a.run(f)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *AsyncPredictor) run(f *Future) {
+	atomic.AddInt64(&a.pending, -1)
+	if err := f.ctx.Err(); err != nil {
+		if atomic.CompareAndSwapInt32(&f.state, futurePending, futureDone) {
+			f.err = err
+			close(f.done)
+		}
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&f.state, futurePending, futureRunning) {
+		// cancelled while queued
+		return
+	}
+
+	var outputs []Tensor
+	var err error
+	if f.inputs != nil {
+		outputs, err = predictInputTensors(a.p, f.inputs)
+	} else {
+		outputs, err = predictTensors(a.p, f.data, a.opts.Quantize)
+	}
+	f.complete(outputs, err)
+}
+
+// Run inference on named inputs and return a copy of every output tensor
+func predictInputTensors(p *PredictorData, inputs []Tensor) ([]Tensor, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := predictInputs(p, inputs); err != nil {
+		return nil, err
+	}
+	return readOutputTensors(p)
+}
@@ -0,0 +1,290 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config of the feature front end
+type Config struct {
+	SampleRate int
+	// analysis window and the step between windows
+	WindowSize time.Duration
+	HopSize    time.Duration
+	// FFT length, defaults to the window length rounded up to a power of two
+	FFTSize int
+	// number and frequency range of the mel filters, UpperFreq defaults to Nyquist
+	NumMelBins int
+	LowerFreq  float64
+	UpperFreq  float64
+	// number of cepstral coefficients, 0 produces log-mel spectrograms
+	NumMFCC int
+	// added to the filterbank energies before the log
+	LogFloor float64
+}
+
+// Settings of the speech commands keyword spotting models
+func DefaultConfig() Config {
+	return Config{
+		SampleRate: 16000,
+		WindowSize: 30 * time.Millisecond,
+		HopSize:    20 * time.Millisecond,
+		NumMelBins: 40,
+		LowerFreq:  20,
+		UpperFreq:  4000,
+		NumMFCC:    10,
+		LogFloor:   1e-6,
+	}
+}
+
+type melFilter struct {
+	start   int
+	weights []float64
+}
+
+// Frontend computes log-mel spectrograms and MFCCs
+type Frontend struct {
+	cfg     Config
+	window  []float64
+	hop     int
+	fftSize int
+	filters []melFilter
+	dct     [][]float64
+}
+
+// Create feature front end
+func NewFrontend(cfg Config) (*Frontend, error) {
+	if cfg.SampleRate <= 0 {
+		return nil, errors.New("the sample rate is required")
+	}
+	windowLen := int(cfg.WindowSize.Seconds() * float64(cfg.SampleRate))
+	hop := int(cfg.HopSize.Seconds() * float64(cfg.SampleRate))
+	if windowLen <= 0 || hop <= 0 {
+		return nil, errors.Errorf("window %v and hop %v are too short for %d Hz", cfg.WindowSize, cfg.HopSize, cfg.SampleRate)
+	}
+	fftSize := cfg.FFTSize
+	if fftSize == 0 {
+		for fftSize = 1; fftSize < windowLen; fftSize <<= 1 {
+		}
+	}
+	if fftSize < windowLen || fftSize&(fftSize-1) != 0 {
+		return nil, errors.Errorf("FFT size %d must be a power of two of at least %d", fftSize, windowLen)
+	}
+	if cfg.NumMelBins <= 0 {
+		return nil, errors.New("the number of mel bins is required")
+	}
+	if cfg.UpperFreq <= 0 {
+		cfg.UpperFreq = float64(cfg.SampleRate) / 2
+	}
+	if cfg.LowerFreq < 0 || cfg.LowerFreq >= cfg.UpperFreq || cfg.UpperFreq > float64(cfg.SampleRate)/2 {
+		return nil, errors.Errorf("invalid mel frequency range %v-%v Hz", cfg.LowerFreq, cfg.UpperFreq)
+	}
+	if cfg.NumMFCC > cfg.NumMelBins {
+		return nil, errors.Errorf("%d MFCCs need at least as many mel bins, got %d", cfg.NumMFCC, cfg.NumMelBins)
+	}
+	if cfg.LogFloor <= 0 {
+		cfg.LogFloor = 1e-6
+	}
+
+	f := &Frontend{
+		cfg:     cfg,
+		window:  make([]float64, windowLen),
+		hop:     hop,
+		fftSize: fftSize,
+	}
+	// periodic Hann window
+	for ii := range f.window {
+		f.window[ii] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(ii)/float64(windowLen))
+	}
+	f.filters = melFilterbank(cfg.NumMelBins, fftSize, cfg.SampleRate, cfg.LowerFreq, cfg.UpperFreq)
+	if cfg.NumMFCC > 0 {
+		f.dct = dctMatrix(cfg.NumMFCC, cfg.NumMelBins)
+	}
+	return f, nil
+}
+
+// Number of values per frame
+func (f *Frontend) NumFeatures() int {
+	if f.cfg.NumMFCC > 0 {
+		return f.cfg.NumMFCC
+	}
+	return f.cfg.NumMelBins
+}
+
+// Number of frames computed from that many samples
+func (f *Frontend) NumFrames(samples int) int {
+	if samples < len(f.window) {
+		return 0
+	}
+	return 1 + (samples-len(f.window))/f.hop
+}
+
+// Number of samples needed to compute that many frames
+func (f *Frontend) NumSamples(frames int) int {
+	if frames <= 0 {
+		return 0
+	}
+	return len(f.window) + (frames-1)*f.hop
+}
+
+// Sample rate the front end expects
+func (f *Frontend) SampleRate() int {
+	return f.cfg.SampleRate
+}
+
+// MFCCs when configured, log-mel spectrogram otherwise
+func (f *Frontend) Compute(samples []float32) [][]float32 {
+	if f.cfg.NumMFCC > 0 {
+		return f.MFCC(samples)
+	}
+	return f.LogMel(samples)
+}
+
+// Log of the mel filterbank energies of every frame
+func (f *Frontend) LogMel(samples []float32) [][]float32 {
+	frames := make([][]float32, f.NumFrames(len(samples)))
+	buf := make([]complex128, f.fftSize)
+	for ii := range frames {
+		frame := samples[ii*f.hop : ii*f.hop+len(f.window)]
+		for jj := range buf {
+			buf[jj] = 0
+		}
+		for jj, s := range frame {
+			buf[jj] = complex(float64(s)*f.window[jj], 0)
+		}
+		fft(buf)
+
+		mel := make([]float32, len(f.filters))
+		for jj, filter := range f.filters {
+			var energy float64
+			for kk, w := range filter.weights {
+				energy += w * sqr(cmplx.Abs(buf[filter.start+kk]))
+			}
+			mel[jj] = float32(math.Log(energy + f.cfg.LogFloor))
+		}
+		frames[ii] = mel
+	}
+	return frames
+}
+
+// Mel frequency cepstral coefficients of every frame
+func (f *Frontend) MFCC(samples []float32) [][]float32 {
+	frames := f.LogMel(samples)
+	if f.dct == nil {
+		return frames
+	}
+	for ii, mel := range frames {
+		coeffs := make([]float32, len(f.dct))
+		for jj, row := range f.dct {
+			var sum float64
+			for kk, v := range mel {
+				sum += row[kk] * float64(v)
+			}
+			coeffs[jj] = float32(sum)
+		}
+		frames[ii] = coeffs
+	}
+	return frames
+}
+
+// Features of the samples flattened into a tensor of exactly that many
+// frames, zero padded or truncated at the end
+func (f *Frontend) Tensor(samples []float32, frames int) []float32 {
+	features := f.Compute(samples)
+	width := f.NumFeatures()
+	res := make([]float32, frames*width)
+	for ii := 0; ii < frames && ii < len(features); ii++ {
+		copy(res[ii*width:], features[ii])
+	}
+	return res
+}
+
+// Triangular filters equally spaced on the mel scale over the FFT bins
+func melFilterbank(numBins, fftSize, sampleRate int, lower, upper float64) []melFilter {
+	lowMel, highMel := hzToMel(lower), hzToMel(upper)
+	centers := make([]float64, numBins+2)
+	for ii := range centers {
+		centers[ii] = melToHz(lowMel + (highMel-lowMel)*float64(ii)/float64(numBins+1))
+	}
+
+	binHz := float64(sampleRate) / float64(fftSize)
+	filters := make([]melFilter, numBins)
+	for ii := range filters {
+		left, center, right := centers[ii], centers[ii+1], centers[ii+2]
+		start := int(math.Ceil(left / binHz))
+		end := int(math.Floor(right / binHz))
+		if end > fftSize/2 {
+			end = fftSize / 2
+		}
+		filter := melFilter{start: start}
+		for bin := start; bin <= end; bin++ {
+			hz := float64(bin) * binHz
+			var w float64
+			if hz <= center {
+				w = (hz - left) / (center - left)
+			} else {
+				w = (right - hz) / (right - center)
+			}
+			filter.weights = append(filter.weights, math.Max(0, w))
+		}
+		filters[ii] = filter
+	}
+	return filters
+}
+
+// Orthonormal DCT-II
+func dctMatrix(rows, cols int) [][]float64 {
+	m := make([][]float64, rows)
+	for ii := range m {
+		m[ii] = make([]float64, cols)
+		scale := math.Sqrt(2 / float64(cols))
+		if ii == 0 {
+			scale = math.Sqrt(1 / float64(cols))
+		}
+		for jj := range m[ii] {
+			m[ii][jj] = scale * math.Cos(math.Pi*float64(ii)*(float64(jj)+0.5)/float64(cols))
+		}
+	}
+	return m
+}
+
+// In place iterative radix-2 FFT, the length must be a power of two
+func fft(x []complex128) {
+	n := len(x)
+	for ii, jj := 1, 0; ii < n; ii++ {
+		bit := n >> 1
+		for ; jj&bit != 0; bit >>= 1 {
+			jj ^= bit
+		}
+		jj ^= bit
+		if ii < jj {
+			x[ii], x[jj] = x[jj], x[ii]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for kk := 0; kk < size/2; kk++ {
+				a, b := x[start+kk], x[start+kk+size/2]*w
+				x[start+kk], x[start+kk+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+func hzToMel(hz float64) float64 {
+	return 1127 * math.Log(1+hz/700)
+}
+
+func melToHz(mel float64) float64 {
+	return 700 * (math.Exp(mel/1127) - 1)
+}
+
+func sqr(x float64) float64 {
+	return x * x
+}
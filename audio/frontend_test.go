@@ -0,0 +1,217 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func sine(freq float64, rate, n int) []float32 {
+	s := make([]float32, n)
+	for ii := range s {
+		s[ii] = float32(math.Sin(2 * math.Pi * freq * float64(ii) / float64(rate)))
+	}
+	return s
+}
+
+func TestFFTSinePeak(t *testing.T) {
+	const n, k = 64, 5
+	x := make([]complex128, n)
+	for ii, s := range sine(k, n, n) {
+		x[ii] = complex(float64(s), 0)
+	}
+	fft(x)
+	for ii, v := range x {
+		want := 0.0
+		if ii == k || ii == n-k {
+			want = n / 2
+		}
+		if math.Abs(cmplx.Abs(v)-want) > 1e-4 {
+			t.Errorf("|X[%d]| = %v, want %v", ii, cmplx.Abs(v), want)
+		}
+	}
+}
+
+func TestFFTMatchesDFT(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 2, 8, 256} {
+		x := make([]complex128, n)
+		for ii := range x {
+			x[ii] = complex(rng.Float64()-0.5, rng.Float64()-0.5)
+		}
+		want := make([]complex128, n)
+		for k := range want {
+			for ii, v := range x {
+				want[k] += v * cmplx.Exp(complex(0, -2*math.Pi*float64(k*ii)/float64(n)))
+			}
+		}
+		fft(x)
+		for k := range x {
+			if cmplx.Abs(x[k]-want[k]) > 1e-9 {
+				t.Errorf("n=%d: X[%d] = %v, want %v", n, k, x[k], want[k])
+				break
+			}
+		}
+	}
+}
+
+func TestMelScale(t *testing.T) {
+	if got := hzToMel(700); math.Abs(got-1127*math.Ln2) > 1e-9 {
+		t.Errorf("hzToMel(700) = %v, want %v", got, 1127*math.Ln2)
+	}
+	for _, hz := range []float64{0, 20, 1000, 4000, 8000} {
+		if got := melToHz(hzToMel(hz)); math.Abs(got-hz) > 1e-6 {
+			t.Errorf("melToHz(hzToMel(%v)) = %v", hz, got)
+		}
+	}
+}
+
+func TestMelFilterbank(t *testing.T) {
+	const fftSize, rate = 512, 16000
+	filters := melFilterbank(40, fftSize, rate, 20, 4000)
+	if len(filters) != 40 {
+		t.Fatalf("%d filters, want 40", len(filters))
+	}
+	binHz := float64(rate) / fftSize
+	for ii, f := range filters {
+		if len(f.weights) == 0 {
+			t.Errorf("filter %d is empty", ii)
+			continue
+		}
+		if ii > 0 && f.start < filters[ii-1].start {
+			t.Errorf("filter %d starts before filter %d", ii, ii-1)
+		}
+		lo, hi := float64(f.start)*binHz, float64(f.start+len(f.weights)-1)*binHz
+		if lo < 20-binHz || hi > 4000+binHz {
+			t.Errorf("filter %d covers %v-%v Hz, outside of 20-4000 Hz", ii, lo, hi)
+		}
+		peak := 0.0
+		for _, w := range f.weights {
+			if w < 0 || w > 1 {
+				t.Errorf("filter %d has weight %v", ii, w)
+			}
+			peak = math.Max(peak, w)
+		}
+		if peak < 0.5 {
+			t.Errorf("filter %d peaks at %v", ii, peak)
+		}
+	}
+}
+
+func TestDCTOrthonormal(t *testing.T) {
+	m := dctMatrix(8, 8)
+	for ii := range m {
+		for jj := range m {
+			var dot float64
+			for kk := range m[ii] {
+				dot += m[ii][kk] * m[jj][kk]
+			}
+			want := 0.0
+			if ii == jj {
+				want = 1
+			}
+			if math.Abs(dot-want) > 1e-9 {
+				t.Errorf("row %d . row %d = %v, want %v", ii, jj, dot, want)
+			}
+		}
+	}
+}
+
+func TestFrontendSinePeak(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.NumMFCC = 0
+	f, err := NewFrontend(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const freq = 1000
+	frames := f.LogMel(sine(freq, cfg.SampleRate, cfg.SampleRate))
+	if len(frames) != 49 {
+		t.Fatalf("%d frames of one second, want 49", len(frames))
+	}
+
+	// the loudest mel bin is the filter weighing the sine frequency the most
+	binHz := float64(cfg.SampleRate) / float64(f.fftSize)
+	bin := int(math.Round(freq / binHz))
+	want, best := -1, 0.0
+	for ii, filter := range f.filters {
+		if kk := bin - filter.start; kk >= 0 && kk < len(filter.weights) && filter.weights[kk] > best {
+			want, best = ii, filter.weights[kk]
+		}
+	}
+	for ii, frame := range frames {
+		peak := 0
+		for jj, v := range frame {
+			if v > frame[peak] {
+				peak = jj
+			}
+		}
+		if peak != want {
+			t.Fatalf("frame %d peaks at mel bin %d, want %d", ii, peak, want)
+		}
+	}
+
+	// silence only leaves the log floor
+	for _, v := range f.LogMel(make([]float32, 480))[0] {
+		if math.Abs(float64(v)-math.Log(1e-6)) > 1e-6 {
+			t.Fatalf("log-mel of silence = %v, want log(1e-6)", v)
+		}
+	}
+}
+
+func TestFrontendFrames(t *testing.T) {
+	f, err := NewFrontend(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 30 ms windows and 20 ms steps at 16 kHz
+	if got := f.NumFrames(16000); got != 49 {
+		t.Errorf("NumFrames(16000) = %d, want 49", got)
+	}
+	if got := f.NumFrames(479); got != 0 {
+		t.Errorf("NumFrames(479) = %d, want 0", got)
+	}
+	if got := f.NumSamples(49); got != 15840 {
+		t.Errorf("NumSamples(49) = %d, want 15840", got)
+	}
+	if f.NumFeatures() != 10 {
+		t.Errorf("NumFeatures = %d, want 10", f.NumFeatures())
+	}
+
+	tensor := f.Tensor(sine(440, 16000, 16000), 60)
+	if len(tensor) != 60*10 {
+		t.Fatalf("tensor of %d values, want %d", len(tensor), 60*10)
+	}
+	for _, v := range tensor[49*10:] {
+		if v != 0 {
+			t.Fatal("frames past the samples are not zero padded")
+		}
+	}
+	mfcc := f.MFCC(sine(440, 16000, 16000))
+	if len(mfcc) != 49 || len(mfcc[0]) != 10 {
+		t.Errorf("MFCC of %dx%d values, want 49x10", len(mfcc), len(mfcc[0]))
+	}
+}
+
+func TestNewFrontendErrors(t *testing.T) {
+	cases := map[string]func(*Config){
+		"no sample rate":  func(c *Config) { c.SampleRate = 0 },
+		"short window":    func(c *Config) { c.WindowSize = time.Microsecond },
+		"small FFT":       func(c *Config) { c.FFTSize = 256 },
+		"odd FFT":         func(c *Config) { c.FFTSize = 1000 },
+		"no mel bins":     func(c *Config) { c.NumMelBins = 0 },
+		"above Nyquist":   func(c *Config) { c.UpperFreq = 9000 },
+		"empty range":     func(c *Config) { c.LowerFreq = 4000 },
+		"too many MFCCs":  func(c *Config) { c.NumMFCC = 41 },
+		"negative bottom": func(c *Config) { c.LowerFreq = -1 },
+	}
+	for name, change := range cases {
+		cfg := DefaultConfig()
+		change(&cfg)
+		if _, err := NewFrontend(cfg); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package audio
+
+import "math"
+
+// Zero crossings of the sinc kernel on each side of a sample
+const resampleTaps = 16
+
+// Resample to another sample rate with a Hann windowed sinc filter. When
+// downsampling, the cutoff is lowered to the new Nyquist frequency.
+func Resample(samples []float32, from, to int) []float32 {
+	if from == to || from <= 0 || to <= 0 || len(samples) == 0 {
+		return append([]float32(nil), samples...)
+	}
+
+	ratio := float64(to) / float64(from)
+	cutoff := math.Min(1, ratio)
+	// kernel half width in input samples
+	width := float64(resampleTaps) / cutoff
+
+	n := int(math.Ceil(float64(len(samples)) * ratio))
+	res := make([]float32, n)
+	for ii := range res {
+		center := float64(ii) / ratio
+		lo := int(math.Ceil(center - width))
+		hi := int(math.Floor(center + width))
+		var sum, norm float64
+		for jj := lo; jj <= hi; jj++ {
+			if jj < 0 || jj >= len(samples) {
+				continue
+			}
+			x := float64(jj) - center
+			w := cutoff * sinc(cutoff*x) * (0.5 + 0.5*math.Cos(math.Pi*x/width))
+			sum += w * float64(samples[jj])
+			norm += w
+		}
+		if norm != 0 {
+			// keep the gain at one near the edges where taps are missing
+			sum /= norm
+		}
+		res[ii] = float32(sum)
+	}
+	return res
+}
+
+// Resample a clip in place
+func (c *Clip) Resample(rate int) {
+	c.Samples = Resample(c.Samples, c.SampleRate, rate)
+	c.SampleRate = rate
+}
+
+// Length of the clip in seconds
+func (c *Clip) Duration() float64 {
+	if c.SampleRate == 0 {
+		return 0
+	}
+	return float64(len(c.Samples)) / float64(c.SampleRate)
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
@@ -0,0 +1,79 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func rms(s []float32) float64 {
+	var sum float64
+	for _, v := range s {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum / float64(len(s)))
+}
+
+func TestResampleSine(t *testing.T) {
+	in := sine(440, 48000, 48000)
+	out := Resample(in, 48000, 16000)
+	if len(out) != 16000 {
+		t.Fatalf("%d samples, want 16000", len(out))
+	}
+	want := sine(440, 16000, 16000)
+	// away from the edges the resampled sine matches one sampled at the new rate
+	for ii := 100; ii < len(out)-100; ii++ {
+		if math.Abs(float64(out[ii]-want[ii])) > 1e-2 {
+			t.Fatalf("sample %d = %v, want %v", ii, out[ii], want[ii])
+		}
+	}
+
+	up := Resample(want, 16000, 44100)
+	if len(up) != 44100 {
+		t.Fatalf("%d samples, want 44100", len(up))
+	}
+	ref := sine(440, 44100, 44100)
+	for ii := 300; ii < len(up)-300; ii++ {
+		if math.Abs(float64(up[ii]-ref[ii])) > 1e-2 {
+			t.Fatalf("upsampled sample %d = %v, want %v", ii, up[ii], ref[ii])
+		}
+	}
+}
+
+func TestResampleFiltersAboveNyquist(t *testing.T) {
+	// 6 kHz is above the 4 kHz Nyquist frequency of the new rate
+	out := Resample(sine(6000, 16000, 16000), 16000, 8000)
+	if r := rms(out[200 : len(out)-200]); r > 0.05 {
+		t.Errorf("RMS %v left of a tone above the new Nyquist frequency", r)
+	}
+}
+
+func TestResampleDC(t *testing.T) {
+	in := make([]float32, 1000)
+	for ii := range in {
+		in[ii] = 0.5
+	}
+	// the gain stays at one up to the edges
+	for _, v := range Resample(in, 16000, 11025) {
+		if math.Abs(float64(v)-0.5) > 1e-3 {
+			t.Fatalf("resampled constant = %v, want 0.5", v)
+		}
+	}
+}
+
+func TestResampleClip(t *testing.T) {
+	in := []float32{1, 2, 3}
+	out := Resample(in, 16000, 16000)
+	if !equalSamples(out, in, 0) {
+		t.Errorf("same rate = %v, want %v", out, in)
+	}
+	out[0] = 0
+	if in[0] != 1 {
+		t.Error("same rate resampling shares the input")
+	}
+
+	clip := &Clip{SampleRate: 8000, Samples: make([]float32, 8000)}
+	clip.Resample(16000)
+	if clip.SampleRate != 16000 || len(clip.Samples) != 16000 || clip.Duration() != 1 {
+		t.Errorf("clip at %d Hz with %d samples, want one second at 16000 Hz", clip.SampleRate, len(clip.Samples))
+	}
+}
@@ -0,0 +1,165 @@
+// Package audio is the front end of speech models: it reads PCM WAV files,
+// resamples them and computes log-mel spectrograms and MFCCs sized to the
+// input of a network.
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// WAV sample formats
+const (
+	formatPCM        = 1
+	formatFloat      = 3
+	formatExtensible = 0xFFFE
+)
+
+// Clip is mono audio with samples in [-1, 1]
+type Clip struct {
+	SampleRate int
+	Samples    []float32
+}
+
+// Read a WAV file
+func LoadWAV(path string) (*Clip, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer f.Close()
+	clip, err := ReadWAV(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+	return clip, nil
+}
+
+// Read 8, 16, 24 or 32 bit PCM or 32 bit float WAV data, the channels
+// are averaged into a single one
+func ReadWAV(r io.Reader) (*Clip, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read WAV data")
+	}
+	if len(buf) < 12 || string(buf[0:4]) != "RIFF" || string(buf[8:12]) != "WAVE" {
+		return nil, errors.New("not a RIFF WAVE file")
+	}
+
+	var (
+		format        uint16
+		channels      int
+		sampleRate    int
+		bitsPerSample int
+		data          []byte
+	)
+	for pos := 12; pos+8 <= len(buf); {
+		id := string(buf[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(buf[pos+4 : pos+8]))
+		body := buf[pos+8:]
+		if size > len(body) {
+			// truncated files are common for streamed recordings
+			size = len(body)
+		}
+		body = body[:size]
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.New("invalid fmt chunk")
+			}
+			format = binary.LittleEndian.Uint16(body[0:2])
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(body[14:16]))
+			if format == formatExtensible && size >= 26 {
+				format = binary.LittleEndian.Uint16(body[24:26])
+			}
+		case "data":
+			data = body
+		}
+		// chunks are padded to an even size
+		pos += 8 + size + size%2
+	}
+
+	if channels == 0 || sampleRate == 0 {
+		return nil, errors.New("missing fmt chunk")
+	}
+	if data == nil {
+		return nil, errors.New("missing data chunk")
+	}
+
+	decode, err := sampleDecoder(format, bitsPerSample)
+	if err != nil {
+		return nil, err
+	}
+	width := bitsPerSample / 8
+	frames := len(data) / (width * channels)
+	samples := make([]float32, frames)
+	for ii := 0; ii < frames; ii++ {
+		var sum float32
+		for c := 0; c < channels; c++ {
+			off := (ii*channels + c) * width
+			sum += decode(data[off : off+width])
+		}
+		samples[ii] = sum / float32(channels)
+	}
+	return &Clip{SampleRate: sampleRate, Samples: samples}, nil
+}
+
+// Write the clip as 16 bit PCM WAV data
+func WriteWAV(w io.Writer, clip *Clip) error {
+	var buf bytes.Buffer
+	size := 2 * len(clip.Samples)
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+size))
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []interface{}{
+		uint32(16), uint16(formatPCM), uint16(1), uint32(clip.SampleRate),
+		uint32(2 * clip.SampleRate), uint16(2), uint16(16),
+	} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(size))
+	for _, s := range clip.Samples {
+		v := math.Max(-1, math.Min(1, float64(s)))
+		binary.Write(&buf, binary.LittleEndian, int16(math.Round(v*math.MaxInt16)))
+	}
+	_, err := w.Write(buf.Bytes())
+	return errors.Wrap(err, "failed to write WAV data")
+}
+
+func sampleDecoder(format uint16, bits int) (func([]byte) float32, error) {
+	switch {
+	case format == formatPCM && bits == 8:
+		// 8 bit samples are unsigned
+		return func(b []byte) float32 {
+			return (float32(b[0]) - 128) / 128
+		}, nil
+	case format == formatPCM && bits == 16:
+		return func(b []byte) float32 {
+			return float32(int16(binary.LittleEndian.Uint16(b))) / 32768
+		}, nil
+	case format == formatPCM && bits == 24:
+		return func(b []byte) float32 {
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			return float32(v) / (1 << 23)
+		}, nil
+	case format == formatPCM && bits == 32:
+		return func(b []byte) float32 {
+			return float32(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+		}, nil
+	case format == formatFloat && bits == 32:
+		return func(b []byte) float32 {
+			return math.Float32frombits(binary.LittleEndian.Uint32(b))
+		}, nil
+	}
+	return nil, errors.Errorf("unsupported WAV format %d with %d bits per sample", format, bits)
+}
@@ -0,0 +1,190 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+type chunk struct {
+	id   string
+	body []byte
+}
+
+// RIFF WAVE file made of the given chunks, odd sized chunks are padded
+func riff(chunks ...chunk) []byte {
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	for _, c := range chunks {
+		body.WriteString(c.id)
+		binary.Write(&body, binary.LittleEndian, uint32(len(c.body)))
+		body.Write(c.body)
+		if len(c.body)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(body.Len()))
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+func fmtChunk(format uint16, channels, rate, bits int) chunk {
+	var b bytes.Buffer
+	align := channels * bits / 8
+	for _, v := range []interface{}{
+		format, uint16(channels), uint32(rate), uint32(rate * align), uint16(align), uint16(bits),
+	} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	return chunk{"fmt ", b.Bytes()}
+}
+
+func le(values ...interface{}) []byte {
+	var b bytes.Buffer
+	for _, v := range values {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	return b.Bytes()
+}
+
+func TestReadWAVHeader(t *testing.T) {
+	// canonical 44 byte header of a mono 16 bit 8 kHz file with 4 samples
+	file := []byte{
+		'R', 'I', 'F', 'F', 0x2c, 0, 0, 0, 'W', 'A', 'V', 'E',
+		'f', 'm', 't', ' ', 16, 0, 0, 0, 1, 0, 1, 0, 0x40, 0x1f, 0, 0, 0x80, 0x3e, 0, 0, 2, 0, 16, 0,
+		'd', 'a', 't', 'a', 8, 0, 0, 0,
+		0x00, 0x00, 0x00, 0x40, 0x00, 0x80, 0xff, 0x7f,
+	}
+	clip, err := ReadWAV(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clip.SampleRate != 8000 {
+		t.Errorf("SampleRate = %d, want 8000", clip.SampleRate)
+	}
+	want := []float32{0, 0.5, -1, 32767.0 / 32768}
+	if !equalSamples(clip.Samples, want, 0) {
+		t.Errorf("Samples = %v, want %v", clip.Samples, want)
+	}
+	if d := clip.Duration(); d != 0.0005 {
+		t.Errorf("Duration = %v, want 0.0005", d)
+	}
+}
+
+func TestReadWAVFormats(t *testing.T) {
+	cases := []struct {
+		name   string
+		format uint16
+		bits   int
+		data   []byte
+		want   []float32
+	}{
+		{"8 bit unsigned", formatPCM, 8, []byte{128, 192, 0}, []float32{0, 0.5, -1}},
+		{"24 bit", formatPCM, 24, []byte{0, 0, 0x40, 0, 0, 0xc0, 0xff, 0xff, 0x7f}, []float32{0.5, -0.5, float32(0x7fffff) / (1 << 23)}},
+		{"32 bit", formatPCM, 32, le(int32(1<<30), int32(-1<<31)), []float32{0.5, -1}},
+		{"32 bit float", formatFloat, 32, le(float32(0.25), float32(-0.75)), []float32{0.25, -0.75}},
+	}
+	for _, c := range cases {
+		clip, err := ReadWAV(bytes.NewReader(riff(fmtChunk(c.format, 1, 16000, c.bits), chunk{"data", c.data})))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !equalSamples(clip.Samples, c.want, 0) {
+			t.Errorf("%s: Samples = %v, want %v", c.name, clip.Samples, c.want)
+		}
+	}
+}
+
+func TestReadWAVChannelsAndChunks(t *testing.T) {
+	// stereo frames are averaged
+	stereo := riff(fmtChunk(formatPCM, 2, 16000, 16), chunk{"data", le(int16(16384), int16(-16384), int16(16384), int16(16384))})
+	clip, err := ReadWAV(bytes.NewReader(stereo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float32{0, 0.5}; !equalSamples(clip.Samples, want, 0) {
+		t.Errorf("stereo Samples = %v, want %v", clip.Samples, want)
+	}
+
+	// WAVE_FORMAT_EXTENSIBLE with the float sub format, after an odd sized chunk
+	ext := fmtChunk(formatExtensible, 1, 16000, 32)
+	ext.body = append(ext.body, le(uint16(22), uint16(32), uint32(4), uint16(formatFloat))...)
+	ext.body = append(ext.body, make([]byte, 14)...)
+	file := riff(chunk{"LIST", []byte("odd")}, ext, chunk{"data", le(float32(0.125))})
+	clip, err = ReadWAV(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float32{0.125}; !equalSamples(clip.Samples, want, 0) {
+		t.Errorf("extensible Samples = %v, want %v", clip.Samples, want)
+	}
+
+	// a data chunk cut short by a streamed recording is read up to its
+	// end, the incomplete last sample is dropped
+	cut := riff(fmtChunk(formatPCM, 1, 16000, 16), chunk{"data", le(int16(16384), int16(16384), int16(16384))})
+	cut = cut[:len(cut)-1]
+	data := bytes.Index(cut, []byte("data"))
+	binary.LittleEndian.PutUint32(cut[data+4:], 100)
+	clip, err = ReadWAV(bytes.NewReader(cut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float32{0.5, 0.5}; !equalSamples(clip.Samples, want, 0) {
+		t.Errorf("truncated Samples = %v, want %v", clip.Samples, want)
+	}
+}
+
+func TestReadWAVErrors(t *testing.T) {
+	cases := map[string][]byte{
+		"not riff":     []byte("RIFX\x00\x00\x00\x00WAVE"),
+		"no fmt":       riff(chunk{"data", []byte{0, 0}}),
+		"no data":      riff(fmtChunk(formatPCM, 1, 16000, 16)),
+		"short fmt":    riff(chunk{"fmt ", make([]byte, 8)}, chunk{"data", []byte{0, 0}}),
+		"12 bit":       riff(fmtChunk(formatPCM, 1, 16000, 12), chunk{"data", []byte{0, 0}}),
+		"64 bit float": riff(fmtChunk(formatFloat, 1, 16000, 64), chunk{"data", make([]byte, 8)}),
+	}
+	for name, file := range cases {
+		if _, err := ReadWAV(bytes.NewReader(file)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestWriteWAVRoundTrip(t *testing.T) {
+	clip := &Clip{SampleRate: 22050, Samples: []float32{0, 0.5, -0.5, 1, -1, 2}}
+	var buf bytes.Buffer
+	if err := WriteWAV(&buf, clip); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 44+2*len(clip.Samples) {
+		t.Errorf("file of %d bytes, want a 44 byte header and 16 bit samples", buf.Len())
+	}
+	back, err := ReadWAV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.SampleRate != clip.SampleRate {
+		t.Errorf("SampleRate = %d, want %d", back.SampleRate, clip.SampleRate)
+	}
+	// samples are clipped to [-1, 1] and quantized to 16 bit
+	want := []float32{0, 0.5, -0.5, 1, -1, 1}
+	if !equalSamples(back.Samples, want, 1.0/16384) {
+		t.Errorf("Samples = %v, want %v", back.Samples, want)
+	}
+}
+
+func equalSamples(a, b []float32, tolerance float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for ii := range a {
+		if math.Abs(float64(a[ii]-b[ii])) > tolerance {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,303 @@
+package snpe
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// File of the cache directory holding the AUTO runtime decisions
+const autoRuntimeFile = "auto_runtime.json"
+
+// serializes the read-modify-write of the decision files
+var autoRuntimeMu sync.Mutex
+
+// AutoOptions configures the selection of the AUTO runtime
+type AutoOptions struct {
+	// hardware modes tried, defaults to DSP, GPU and CPU
+	Candidates []int
+	// timed runs per runtime after one warmup run, defaults to 5
+	Trials int
+	// compare the outputs of every runtime with CPU and reject the
+	// runtimes exceeding the tolerances
+	CheckAgreement bool
+	// defaults to a minimum correlation of 0.95 when none is set
+	Tolerances Tolerances
+	// run the trial even when a decision is cached
+	Refresh bool
+}
+
+// RuntimeTrial is the outcome of the trial of one runtime
+type RuntimeTrial struct {
+	Runtime string `json:"runtime"`
+	Mode    int    `json:"mode"`
+	// median latency of the timed runs
+	Latency    time.Duration     `json:"latency"`
+	Comparison *OutputComparison `json:"comparison,omitempty"`
+	Accepted   bool              `json:"accepted"`
+	Reason     string            `json:"reason,omitempty"`
+}
+
+// RuntimeDecision is the runtime chosen for a model on a device
+type RuntimeDecision struct {
+	Mode        int            `json:"mode"`
+	Runtime     string         `json:"runtime"`
+	ModelSHA256 string         `json:"model_sha256"`
+	Device      string         `json:"device"`
+	Trials      []RuntimeTrial `json:"trials"`
+	Created     time.Time      `json:"created"`
+	// the decision was read from the cache rather than measured
+	Cached bool `json:"-"`
+}
+
+// Select the runtime with the AUTO mode, see SelectRuntime
+func AutoSelect(opts AutoOptions) Option {
+	return func(o *Options) {
+		o.mode = AUTO
+		o.auto = opts
+	}
+}
+
+// Runtime decision of a predictor loaded with the AUTO mode, nil otherwise
+func AutoDecision(p *PredictorData) *RuntimeDecision {
+	return p.autoDecision
+}
+
+// Build the model on every available candidate runtime, time a few runs on
+// synthetic input and return the fastest runtime whose outputs are
+// acceptable. Decisions are cached per device and model hash in the cache
+// directory of the options, so later loads skip the trial.
+func SelectRuntime(model string, options *Options) (*RuntimeDecision, error) {
+	opts := options.auto
+	if len(opts.Candidates) == 0 {
+		opts.Candidates = []int{DSP, GPU, CPU_1_thread}
+	}
+	if opts.Trials <= 0 {
+		opts.Trials = 5
+	}
+	if opts.CheckAgreement && opts.Tolerances == (Tolerances{}) {
+		opts.Tolerances = Tolerances{MinCorrelation: 0.95}
+	}
+
+	modelHash, err := fileSHA256(model)
+	if err != nil {
+		return nil, err
+	}
+	device := deviceFingerprint()
+	file, err := autoRuntimePath(model, options)
+	if err != nil {
+		return nil, err
+	}
+	key := autoRuntimeKey(modelHash, device, options, opts)
+
+	if !opts.Refresh {
+		if d, ok := readRuntimeDecision(file, key); ok && IsRuntimeAvailable(d.Mode) {
+			d.Cached = true
+			return d, nil
+		}
+	}
+
+	decision := &RuntimeDecision{
+		ModelSHA256: modelHash,
+		Device:      device,
+		Created:     time.Now().UTC(),
+	}
+
+	// CPU runs first, it provides the input and the reference outputs
+	candidates := append([]int(nil), opts.Candidates...)
+	sort.SliceStable(candidates, func(ii, jj int) bool {
+		return RuntimeName(candidates[ii]) == "CPU" && RuntimeName(candidates[jj]) != "CPU"
+	})
+	var reference []Tensor
+	var input []Tensor
+	for _, mode := range candidates {
+		trial := RuntimeTrial{Runtime: RuntimeName(mode), Mode: mode}
+		if !IsRuntimeAvailable(mode) {
+			trial.Reason = "not available"
+			decision.Trials = append(decision.Trials, trial)
+			continue
+		}
+		if opts.CheckAgreement && reference == nil && trial.Runtime != "CPU" {
+			reference, input, err = trialOutputs(model, options, CPU_1_thread, input)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to run the CPU reference")
+			}
+		}
+
+		outputs, latency, in, err := runTrial(model, options, mode, input, opts.Trials)
+		if err != nil {
+			trial.Reason = err.Error()
+			decision.Trials = append(decision.Trials, trial)
+			continue
+		}
+		input = in
+		trial.Latency = latency
+		trial.Accepted = true
+		if trial.Runtime == "CPU" {
+			if reference == nil {
+				reference = outputs
+			}
+		} else if opts.CheckAgreement {
+			comparisons, err := CompareOutputs(reference, outputs, 5, opts.Tolerances)
+			if err != nil {
+				trial.Accepted = false
+				trial.Reason = err.Error()
+			}
+			for ii, c := range comparisons {
+				if len(c.Violations) > 0 {
+					trial.Comparison = &comparisons[ii]
+					trial.Accepted = false
+					trial.Reason = strings.Join(c.Violations, ", ")
+					break
+				}
+			}
+		}
+		decision.Trials = append(decision.Trials, trial)
+	}
+
+	var best *RuntimeTrial
+	for ii, t := range decision.Trials {
+		if t.Accepted && (best == nil || t.Latency < best.Latency) {
+			best = &decision.Trials[ii]
+		}
+	}
+	if best == nil {
+		return nil, errors.Errorf("no runtime could run %s", model)
+	}
+	decision.Mode = best.Mode
+	decision.Runtime = best.Runtime
+
+	if err := writeRuntimeDecision(file, key, decision); err != nil {
+		log.WithError(err).Warn("failed to cache the runtime decision")
+	}
+	return decision, nil
+}
+
+// Load the model on a runtime and time the trial runs, the input is
+// generated from the network inputs when none is given
+func runTrial(model string, options *Options, mode int, input []Tensor, trials int) ([]Tensor, time.Duration, []Tensor, error) {
+	p, err := trialPredictor(model, options, mode)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer Close(p)
+	if input == nil {
+		input = syntheticInputs(p)
+	}
+
+	// the first run pays for lazy initialization and is not timed
+	outputs, err := predictInputTensors(p, input)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	latencies := make([]time.Duration, trials)
+	for ii := range latencies {
+		start := time.Now()
+		if outputs, err = predictInputTensors(p, input); err != nil {
+			return nil, 0, nil, err
+		}
+		latencies[ii] = time.Since(start)
+	}
+	sort.Slice(latencies, func(ii, jj int) bool { return latencies[ii] < latencies[jj] })
+	return outputs, latencies[len(latencies)/2], input, nil
+}
+
+// Outputs of a single run, used for the CPU reference
+func trialOutputs(model string, options *Options, mode int, input []Tensor) ([]Tensor, []Tensor, error) {
+	outputs, _, in, err := runTrial(model, options, mode, input, 1)
+	return outputs, in, err
+}
+
+func trialPredictor(model string, options *Options, mode int) (*PredictorData, error) {
+	o := *options
+	o.mode = mode
+	o.auto = AutoOptions{}
+	p := newPredictorData(model, &o)
+	// trial loads and runs are kept out of the process metrics
+	p.metrics = newMetrics()
+	if err := Load(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Identifies the device and SNPE version a decision was measured on
+func deviceFingerprint() string {
+	caps := Capabilities()
+	parts := []string{caps.CPU.Model, caps.CPU.Arch, fmt.Sprint(caps.CPU.Cores), caps.SNPEVersion}
+	for _, r := range caps.Runtimes {
+		if r.Available {
+			parts = append(parts, r.Name)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// Decisions are only reused for the settings they were measured and checked with
+func autoRuntimeKey(modelHash, device string, options *Options, opts AutoOptions) string {
+	h := sha256.Sum256([]byte(fmt.Sprint(modelHash, device, opts.Candidates, opts.Trials,
+		opts.CheckAgreement, opts.Tolerances, options.batch, options.outputLayers, options.cpuFixedPoint,
+		options.perfProfile, options.priority)))
+	return fmt.Sprintf("%x", h[:8])
+}
+
+// Decisions live in the init cache directory, next to the model by default
+func autoRuntimePath(model string, options *Options) (string, error) {
+	root := options.cacheDir
+	if root == "" {
+		absModel, err := filepath.Abs(model)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to resolve model path %s", model)
+		}
+		root = filepath.Join(filepath.Dir(absModel), initCacheDirName)
+	}
+	return filepath.Join(root, autoRuntimeFile), nil
+}
+
+func readRuntimeDecisions(file string) map[string]*RuntimeDecision {
+	decisions := map[string]*RuntimeDecision{}
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return decisions
+	}
+	if err := json.Unmarshal(buf, &decisions); err != nil {
+		log.WithError(err).WithField("file", file).Warn("ignoring corrupt runtime decisions")
+		return map[string]*RuntimeDecision{}
+	}
+	return decisions
+}
+
+func readRuntimeDecision(file, key string) (*RuntimeDecision, bool) {
+	autoRuntimeMu.Lock()
+	defer autoRuntimeMu.Unlock()
+	d, ok := readRuntimeDecisions(file)[key]
+	return d, ok && d != nil
+}
+
+func writeRuntimeDecision(file, key string, d *RuntimeDecision) error {
+	autoRuntimeMu.Lock()
+	defer autoRuntimeMu.Unlock()
+	decisions := readRuntimeDecisions(file)
+	decisions[key] = d
+	buf, err := json.MarshalIndent(decisions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,32 @@
+package snpe
+
+import (
+	"testing"
+)
+
+func TestAutoRuntimeKey(t *testing.T) {
+	opts := AutoOptions{Trials: 5}
+	base := autoRuntimeKey("0123456789abcdef", "CPU/GPU", NewOptions(), opts)
+	if again := autoRuntimeKey("0123456789abcdef", "CPU/GPU", NewOptions(), opts); again != base {
+		t.Errorf("key changed from %s to %s for the same settings", base, again)
+	}
+
+	// a decision measured with other settings is not reused
+	for name, options := range map[string]*Options{
+		"batch":               NewOptions(Batch(4)),
+		"output layers":       NewOptions(OutputLayers("prob")),
+		"cpu fixed point":     NewOptions(CPUFixedPoint(true)),
+		"performance profile": NewOptions(PerformanceProfile(PerfHighPerformance)),
+		"priority":            NewOptions(ExecutionPriority(PriorityLow)),
+	} {
+		if key := autoRuntimeKey("0123456789abcdef", "CPU/GPU", options, opts); key == base {
+			t.Errorf("%s: same key as the default settings", name)
+		}
+	}
+	if key := autoRuntimeKey("0123456789abcdef", "CPU/GPU", NewOptions(), AutoOptions{Trials: 10}); key == base {
+		t.Error("trials: same key as the default settings")
+	}
+	if key := autoRuntimeKey("0123456789abcdef", "CPU", NewOptions(), opts); key == base {
+		t.Error("device: same key as the default settings")
+	}
+}
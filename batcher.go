@@ -0,0 +1,262 @@
+package snpe
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultBatchDelay is how long a Batcher waits for a batch to fill up
+const DefaultBatchDelay = 5 * time.Millisecond
+
+// ErrBatcherClosed is returned for requests sent to a closed Batcher
+var ErrBatcherClosed = errors.New("batcher is closed")
+
+// BatcherOptions configures the batching scheduler
+type BatcherOptions struct {
+	// maximum number of requests merged into one execution,
+	// defaults to (and cannot exceed) the batch size of the network
+	MaxBatchSize int
+	// maximum time the first request of a batch waits for others to arrive
+	MaxDelay time.Duration
+	// whether inputs are passed to the model as quantized data
+	Quantize bool
+}
+
+// BatcherStats reports the queueing behaviour of a Batcher
+type BatcherStats struct {
+	// number of requests currently waiting to be scheduled
+	QueueDepth int64 `json:"queue_depth"`
+	// queue depth seen by every incoming request
+	QueueDepthHistogram HistogramSnapshot `json:"queue_depth_histogram"`
+	// number of requests merged into each execution
+	BatchSizeHistogram HistogramSnapshot `json:"batch_size_histogram"`
+}
+
+type batchRequest struct {
+	data   []byte
+	result chan batchResult
+}
+
+type batchResult struct {
+	output []float32
+	err    error
+}
+
+// Batcher merges concurrent single item requests into batched executions
+// of one predictor and fans the results back out to each caller
+type Batcher struct {
+	opts BatcherOptions
+	// runs one execution on a buffer of slots items
+	run func(input []byte) ([]float32, error)
+	// batch dimension of the network and size in bytes of one item
+	slots    int
+	itemSize int
+	requests chan *batchRequest
+	done     chan struct{}
+	wg       sync.WaitGroup
+	// guards closed so that no request is queued after the final drain
+	mu     sync.RWMutex
+	closed bool
+
+	queueDepth     int64
+	queueDepthHist *Histogram
+	batchSizeHist  *Histogram
+}
+
+// Create new batching scheduler in front of a predictor
+func NewBatcher(p *PredictorData, opts BatcherOptions) (*Batcher, error) {
+	if p == nil || p.ctx == nil {
+		return nil, errors.New("empty predictor context")
+	}
+	if n := len(p.inputs); n != 1 {
+		return nil, errors.Errorf("cannot batch a model with %d inputs", n)
+	}
+	// the native predictor fills the input tensor of the network, so the
+	// slots are the network batch dimension rather than the Batch option
+	if len(p.inputShape) == 0 || p.inputShape[0] <= 0 {
+		return nil, errors.Errorf("the network input shape %v has no batch dimension", p.inputShape)
+	}
+	slots := p.inputShape[0]
+	if p.batch != slots {
+		return nil, errors.Errorf("predictor batch size %d does not match the network batch size %d", p.batch, slots)
+	}
+	quantize := opts.Quantize
+	run := func(input []byte) ([]float32, error) {
+		return predictRaw(p, input, quantize)
+	}
+	return newBatcher(run, slots, 4*shapeSize(p.inputShape)/slots, opts)
+}
+
+func newBatcher(run func([]byte) ([]float32, error), slots, itemSize int, opts BatcherOptions) (*Batcher, error) {
+	if slots <= 0 {
+		return nil, errors.New("null batch")
+	}
+	if itemSize <= 0 {
+		return nil, errors.New("null batch item size")
+	}
+	if opts.MaxBatchSize <= 0 {
+		opts.MaxBatchSize = slots
+	}
+	if opts.MaxBatchSize > slots {
+		return nil, errors.Errorf("max batch size %d exceeds the network batch size %d", opts.MaxBatchSize, slots)
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = DefaultBatchDelay
+	}
+
+	b := &Batcher{
+		opts:           opts,
+		run:            run,
+		slots:          slots,
+		itemSize:       itemSize,
+		requests:       make(chan *batchRequest, 4*opts.MaxBatchSize),
+		done:           make(chan struct{}),
+		queueDepthHist: NewHistogram(exponentialBounds(4 * opts.MaxBatchSize)...),
+		batchSizeHist:  NewHistogram(exponentialBounds(opts.MaxBatchSize)...),
+	}
+	b.wg.Add(1)
+	go b.loop()
+	return b, nil
+}
+
+// Run inference on a single item and return its slice of the batched output
+func (b *Batcher) Predict(ctx context.Context, data []byte) ([]float32, error) {
+	if len(data) == 0 {
+		return nil, errors.New("image data is empty")
+	}
+	if len(data) != b.itemSize {
+		return nil, errors.Errorf("input size %d does not match the batch item size %d", len(data), b.itemSize)
+	}
+
+	req := &batchRequest{
+		data:   data,
+		result: make(chan batchResult, 1),
+	}
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return nil, ErrBatcherClosed
+	}
+	depth := atomic.AddInt64(&b.queueDepth, 1)
+	b.queueDepthHist.Observe(float64(depth))
+	select {
+	case b.requests <- req:
+		b.mu.RUnlock()
+	case <-ctx.Done():
+		atomic.AddInt64(&b.queueDepth, -1)
+		b.mu.RUnlock()
+		return nil, ctx.Err()
+	}
+
+	select {
+	case res := <-req.result:
+		return res.output, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Report queue depth and batch size statistics
+func (b *Batcher) Stats() BatcherStats {
+	return BatcherStats{
+		QueueDepth:          atomic.LoadInt64(&b.queueDepth),
+		QueueDepthHistogram: b.queueDepthHist.Snapshot(),
+		BatchSizeHistogram:  b.batchSizeHist.Snapshot(),
+	}
+}
+
+// Stop the scheduler, pending requests are still executed.
+// The underlying predictor is not closed.
+func (b *Batcher) Close() {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
+
+func (b *Batcher) loop() {
+	defer b.wg.Done()
+	for {
+		var first *batchRequest
+		select {
+		case first = <-b.requests:
+		case <-b.done:
+			b.drain()
+			return
+		}
+
+		batch := []*batchRequest{first}
+		timer := time.NewTimer(b.opts.MaxDelay)
+	collect:
+		for len(batch) < b.opts.MaxBatchSize {
+			select {
+			case req := <-b.requests:
+				batch = append(batch, req)
+			case <-timer.C:
+				break collect
+			case <-b.done:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		b.execute(batch)
+	}
+}
+
+// Execute whatever is left in the queue once the batcher is closed
+func (b *Batcher) drain() {
+	for {
+		batch := []*batchRequest{}
+	fill:
+		for len(batch) < b.opts.MaxBatchSize {
+			select {
+			case req := <-b.requests:
+				batch = append(batch, req)
+			default:
+				break fill
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+		b.execute(batch)
+	}
+}
+
+func (b *Batcher) execute(batch []*batchRequest) {
+	atomic.AddInt64(&b.queueDepth, -int64(len(batch)))
+	b.batchSizeHist.Observe(float64(len(batch)))
+
+	// unused slots are zero padded since the network batch size is fixed
+	input := make([]byte, b.slots*b.itemSize)
+	for ii, req := range batch {
+		copy(input[ii*b.itemSize:], req.data)
+	}
+
+	output, err := b.run(input)
+	if err == nil && len(output)%b.slots != 0 {
+		err = errors.Errorf("output length %d is not a multiple of the batch size %d", len(output), b.slots)
+	}
+	if err != nil {
+		for _, req := range batch {
+			req.result <- batchResult{err: err}
+		}
+		return
+	}
+
+	outputSize := len(output) / b.slots
+	for ii, req := range batch {
+		req.result <- batchResult{
+			output: output[ii*outputSize : (ii+1)*outputSize : (ii+1)*outputSize],
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package snpe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Runner returning, for every slot, the first byte of the item and the slot index
+type echoRunner struct {
+	mu     sync.Mutex
+	inputs [][]byte
+	slots  int
+	err    error
+}
+
+func (r *echoRunner) run(input []byte) ([]float32, error) {
+	r.mu.Lock()
+	r.inputs = append(r.inputs, append([]byte(nil), input...))
+	r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	itemSize := len(input) / r.slots
+	output := make([]float32, 0, 2*r.slots)
+	for ii := 0; ii < r.slots; ii++ {
+		output = append(output, float32(input[ii*itemSize]), float32(ii))
+	}
+	return output, nil
+}
+
+func item(id byte, size int) []byte {
+	return bytes.Repeat([]byte{id}, size)
+}
+
+func TestBatcherFansOutResults(t *testing.T) {
+	r := &echoRunner{slots: 4}
+	b, err := newBatcher(r.run, 4, 8, BatcherOptions{MaxDelay: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	var wg sync.WaitGroup
+	outputs := make([][]float32, 4)
+	errs := make([]error, 4)
+	for ii := range outputs {
+		wg.Add(1)
+		go func(ii int) {
+			defer wg.Done()
+			outputs[ii], errs[ii] = b.Predict(context.Background(), item(byte(ii+1), 8))
+		}(ii)
+	}
+	wg.Wait()
+
+	// a full batch runs without waiting for the delay, in a single execution
+	if len(r.inputs) != 1 {
+		t.Fatalf("%d executions, want 1", len(r.inputs))
+	}
+	for ii, out := range outputs {
+		if errs[ii] != nil {
+			t.Fatal(errs[ii])
+		}
+		if len(out) != 2 || out[0] != float32(ii+1) {
+			t.Errorf("request %d got %v, want the output of its own item", ii, out)
+		}
+		if cap(out) != 2 {
+			t.Errorf("request %d output has capacity %d, it must not reach into other items", ii, cap(out))
+		}
+	}
+
+	stats := b.Stats()
+	if stats.QueueDepth != 0 {
+		t.Errorf("QueueDepth = %d, want 0", stats.QueueDepth)
+	}
+	if s := stats.BatchSizeHistogram; s.Count != 1 || s.Sum != 4 {
+		t.Errorf("batch size histogram count %d sum %v, want a single batch of 4", s.Count, s.Sum)
+	}
+	if s := stats.QueueDepthHistogram; s.Count != 4 {
+		t.Errorf("queue depth histogram count %d, want 4", s.Count)
+	}
+}
+
+func TestBatcherPadsPartialBatch(t *testing.T) {
+	r := &echoRunner{slots: 4}
+	b, err := newBatcher(r.run, 4, 8, BatcherOptions{MaxDelay: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	out, err := b.Predict(context.Background(), item(7, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || out[0] != 7 || out[1] != 0 {
+		t.Errorf("output = %v, want the first slot", out)
+	}
+	want := append(item(7, 8), make([]byte, 3*8)...)
+	if !bytes.Equal(r.inputs[0], want) {
+		t.Errorf("input = %v, want the item followed by zero padding", r.inputs[0])
+	}
+}
+
+func TestBatcherMaxBatchSize(t *testing.T) {
+	r := &echoRunner{slots: 4}
+	b, err := newBatcher(r.run, 4, 1, BatcherOptions{MaxBatchSize: 2, MaxDelay: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	var wg sync.WaitGroup
+	for ii := 0; ii < 4; ii++ {
+		wg.Add(1)
+		go func(ii int) {
+			defer wg.Done()
+			if _, err := b.Predict(context.Background(), item(byte(ii), 1)); err != nil {
+				t.Error(err)
+			}
+		}(ii)
+	}
+	wg.Wait()
+
+	s := b.Stats().BatchSizeHistogram
+	if s.Count != 2 || s.Sum != 4 {
+		t.Errorf("batch size histogram count %d sum %v, want two batches of 2", s.Count, s.Sum)
+	}
+
+	if _, err := newBatcher(r.run, 4, 1, BatcherOptions{MaxBatchSize: 5}); err == nil {
+		t.Error("expected an error for a max batch size above the network batch size")
+	}
+}
+
+func TestBatcherRejectsItemSize(t *testing.T) {
+	r := &echoRunner{slots: 2}
+	b, err := newBatcher(r.run, 2, 8, BatcherOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	for _, data := range [][]byte{nil, item(1, 4), item(1, 16)} {
+		if _, err := b.Predict(context.Background(), data); err == nil {
+			t.Errorf("expected an error for an item of %d bytes", len(data))
+		}
+	}
+	if len(r.inputs) != 0 {
+		t.Errorf("%d executions for rejected items", len(r.inputs))
+	}
+}
+
+func TestBatcherErrors(t *testing.T) {
+	failure := errors.New("execute failed")
+	r := &echoRunner{slots: 2, err: failure}
+	b, err := newBatcher(r.run, 2, 1, BatcherOptions{MaxDelay: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	var wg sync.WaitGroup
+	for ii := 0; ii < 2; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := b.Predict(context.Background(), item(1, 1)); err != failure {
+				t.Errorf("error = %v, want %v", err, failure)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// an output that cannot be split evenly fails every request of the batch
+	odd := func(input []byte) ([]float32, error) { return make([]float32, 3), nil }
+	b2, err := newBatcher(odd, 2, 1, BatcherOptions{MaxDelay: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b2.Close()
+	if _, err := b2.Predict(context.Background(), item(1, 1)); err == nil {
+		t.Error("expected an error for an output of 3 values and 2 slots")
+	}
+}
+
+func TestBatcherClose(t *testing.T) {
+	r := &echoRunner{slots: 2}
+	b, err := newBatcher(r.run, 2, 1, BatcherOptions{MaxDelay: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pending request is executed by the final drain
+	result := make(chan error, 1)
+	go func() {
+		_, err := b.Predict(context.Background(), item(1, 1))
+		result <- err
+	}()
+	for b.Stats().QueueDepth == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	b.Close()
+	if err := <-result; err != nil {
+		t.Errorf("pending request failed: %v", err)
+	}
+
+	if _, err := b.Predict(context.Background(), item(1, 1)); err != ErrBatcherClosed {
+		t.Errorf("error = %v, want %v", err, ErrBatcherClosed)
+	}
+}
+
+func TestBatcherContextCancel(t *testing.T) {
+	block := make(chan struct{})
+	run := func(input []byte) ([]float32, error) {
+		<-block
+		return make([]float32, 1), nil
+	}
+	b, err := newBatcher(run, 1, 1, BatcherOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	defer close(block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.Predict(ctx, item(1, 1)); err != context.DeadlineExceeded {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,219 @@
+package snpe
+
+// #include "cbits/predictor.hpp"
+import "C"
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rai-project/dlframework"
+)
+
+// Root of the sysfs CPU topology
+var sysCPUDir = "/sys/devices/system/cpu"
+
+// RuntimeCapability is the availability of an SNPE runtime on the device
+type RuntimeCapability struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+}
+
+// CPUCluster is a group of cores sharing a cluster, such as the big or
+// LITTLE cores of a big.LITTLE system
+type CPUCluster struct {
+	Cores []int `json:"cores"`
+	// highest maximum frequency of the cores, zero when cpufreq is not exposed
+	MaxFrequencyKHz int `json:"max_frequency_khz"`
+}
+
+// CPUInfo describes the processor of the device
+type CPUInfo struct {
+	Arch string `json:"arch"`
+	// hardware or model name reported by /proc/cpuinfo
+	Model    string       `json:"model,omitempty"`
+	Cores    int          `json:"cores"`
+	Clusters []CPUCluster `json:"clusters,omitempty"`
+}
+
+// DeviceCapabilities is what the device offers to SNPE models
+type DeviceCapabilities struct {
+	SNPEVersion string              `json:"snpe_version"`
+	Runtimes    []RuntimeCapability `json:"runtimes"`
+	CPU         CPUInfo             `json:"cpu"`
+}
+
+// Probe the SNPE library version, the runtimes available on the device
+// and the CPU topology
+func Capabilities() DeviceCapabilities {
+	runtimes := []struct {
+		name string
+		id   C.int
+	}{
+		{"CPU", C.SNPE_RUNTIME_CPU},
+		{"GPU", C.SNPE_RUNTIME_GPU},
+		{"GPU_FLOAT16", C.SNPE_RUNTIME_GPU_FLOAT16},
+		{"DSP", C.SNPE_RUNTIME_DSP},
+		{"AIP", C.SNPE_RUNTIME_AIP},
+	}
+	caps := DeviceCapabilities{
+		SNPEVersion: LibraryVersion(),
+		CPU:         cpuInfo(),
+	}
+	for _, r := range runtimes {
+		caps.Runtimes = append(caps.Runtimes, RuntimeCapability{
+			Name:      r.name,
+			Available: bool(C.IsRuntimeTypeAvailableSnpe(r.id)),
+		})
+	}
+	return caps
+}
+
+// Whether a runtime, by its name in Runtimes, is available
+func (c DeviceCapabilities) Available(name string) bool {
+	for _, r := range c.Runtimes {
+		if strings.EqualFold(r.Name, name) {
+			return r.Available
+		}
+	}
+	return false
+}
+
+// Hardware description used to register the agent with dlframework,
+// the accelerator runtimes are listed in place of a GPU name
+func (c DeviceCapabilities) ContainerHardware() *dlframework.ContainerHardware {
+	var accelerators []string
+	for _, r := range c.Runtimes {
+		if r.Available && r.Name != "CPU" {
+			accelerators = append(accelerators, r.Name)
+		}
+	}
+	cpu := fmt.Sprintf("%s %d cores", c.CPU.Arch, c.CPU.Cores)
+	if c.CPU.Model != "" {
+		cpu = c.CPU.Model + " " + cpu
+	}
+	return &dlframework.ContainerHardware{
+		Cpu: cpu,
+		Gpu: strings.Join(accelerators, ","),
+	}
+}
+
+func cpuInfo() CPUInfo {
+	info := CPUInfo{
+		Arch:  runtime.GOARCH,
+		Cores: runtime.NumCPU(),
+		Model: cpuModel("/proc/cpuinfo"),
+	}
+	info.Clusters = cpuClusters(sysCPUDir)
+	if n := clusterCores(info.Clusters); n > info.Cores {
+		info.Cores = n
+	}
+	return info
+}
+
+// Hardware line of /proc/cpuinfo on ARM, model name elsewhere
+func cpuModel(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	var model string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch key {
+		case "Hardware":
+			return value
+		case "model name":
+			if model == "" {
+				model = value
+			}
+		}
+	}
+	return model
+}
+
+// Online cores grouped by cluster, slowest cluster first. Clusters come
+// from topology/cluster_id, or core_siblings on kernels without it, and
+// cores without a topology are grouped by maximum frequency.
+func cpuClusters(dir string) []CPUCluster {
+	paths, err := filepath.Glob(filepath.Join(dir, "cpu[0-9]*"))
+	if err != nil || len(paths) == 0 {
+		return nil
+	}
+	var keys []string
+	byKey := map[string]*CPUCluster{}
+	for _, path := range paths {
+		core, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "cpu"))
+		if err != nil {
+			continue
+		}
+		// cpu0 usually has no online file since it cannot be taken offline
+		if online, ok := readSysfs(path, "online"); ok && online == "0" {
+			continue
+		}
+		freq := 0
+		if value, ok := readSysfs(path, "cpufreq", "cpuinfo_max_freq"); ok {
+			freq, _ = strconv.Atoi(value)
+		}
+
+		key := "freq " + strconv.Itoa(freq)
+		if id, ok := readSysfs(path, "topology", "cluster_id"); ok && !strings.HasPrefix(id, "-") {
+			key = "cluster " + id
+		} else if siblings, ok := readSysfs(path, "topology", "core_siblings"); ok {
+			key = "siblings " + siblings
+		}
+		c, ok := byKey[key]
+		if !ok {
+			c = &CPUCluster{}
+			byKey[key] = c
+			keys = append(keys, key)
+		}
+		c.Cores = append(c.Cores, core)
+		if freq > c.MaxFrequencyKHz {
+			c.MaxFrequencyKHz = freq
+		}
+	}
+
+	clusters := make([]CPUCluster, 0, len(keys))
+	for _, key := range keys {
+		c := byKey[key]
+		sort.Ints(c.Cores)
+		clusters = append(clusters, *c)
+	}
+	sort.Slice(clusters, func(ii, jj int) bool {
+		if clusters[ii].MaxFrequencyKHz != clusters[jj].MaxFrequencyKHz {
+			return clusters[ii].MaxFrequencyKHz < clusters[jj].MaxFrequencyKHz
+		}
+		return clusters[ii].Cores[0] < clusters[jj].Cores[0]
+	})
+	return clusters
+}
+
+// Trimmed content of a sysfs file, false when it cannot be read
+func readSysfs(elem ...string) (string, bool) {
+	buf, err := ioutil.ReadFile(filepath.Join(elem...))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(buf)), true
+}
+
+func clusterCores(clusters []CPUCluster) int {
+	n := 0
+	for _, c := range clusters {
+		n += len(c.Cores)
+	}
+	return n
+}
@@ -0,0 +1,184 @@
+package snpe
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Write the files of a sysfs tree, keyed by their path relative to dir
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCPUClusters(t *testing.T) {
+	cases := []struct {
+		name  string
+		files map[string]string
+		want  []CPUCluster
+	}{
+		{
+			// a prime core at a higher frequency than the other big cores
+			"cluster_id",
+			map[string]string{
+				"cpu0/topology/cluster_id":         "0",
+				"cpu0/cpufreq/cpuinfo_max_freq":    "1800000",
+				"cpu1/topology/cluster_id":         "0",
+				"cpu1/cpufreq/cpuinfo_max_freq":    "1800000",
+				"cpu2/topology/cluster_id":         "1",
+				"cpu2/cpufreq/cpuinfo_max_freq":    "2400000",
+				"cpu3/topology/cluster_id":         "1",
+				"cpu3/cpufreq/cpuinfo_max_freq":    "2400000",
+				"cpu10/topology/cluster_id":        "1",
+				"cpu10/cpufreq/cpuinfo_max_freq":   "2800000",
+				"cpu10/online":                     "1",
+				"cpufreq/policy0/scaling_governor": "schedutil",
+			},
+			[]CPUCluster{
+				{Cores: []int{0, 1}, MaxFrequencyKHz: 1800000},
+				{Cores: []int{2, 3, 10}, MaxFrequencyKHz: 2800000},
+			},
+		},
+		{
+			"core_siblings",
+			map[string]string{
+				"cpu0/topology/core_siblings":   "03",
+				"cpu0/cpufreq/cpuinfo_max_freq": "1400000",
+				"cpu1/topology/core_siblings":   "03",
+				"cpu1/cpufreq/cpuinfo_max_freq": "1400000",
+				"cpu2/topology/core_siblings":   "0c",
+				"cpu2/cpufreq/cpuinfo_max_freq": "1400000",
+				"cpu3/topology/core_siblings":   "0c",
+				"cpu3/cpufreq/cpuinfo_max_freq": "1400000",
+			},
+			// same frequency but two clusters, ordered by their first core
+			[]CPUCluster{
+				{Cores: []int{0, 1}, MaxFrequencyKHz: 1400000},
+				{Cores: []int{2, 3}, MaxFrequencyKHz: 1400000},
+			},
+		},
+		{
+			// offline cores have no topology nor cpufreq
+			"offline",
+			map[string]string{
+				"cpu0/topology/cluster_id":      "0",
+				"cpu0/cpufreq/cpuinfo_max_freq": "1800000",
+				"cpu1/topology/cluster_id":      "0",
+				"cpu1/cpufreq/cpuinfo_max_freq": "1800000",
+				"cpu2/online":                   "0",
+				"cpu3/online":                   "0",
+			},
+			[]CPUCluster{{Cores: []int{0, 1}, MaxFrequencyKHz: 1800000}},
+		},
+		{
+			// a cluster_id of -1 means that the architecture does not report it
+			"frequency",
+			map[string]string{
+				"cpu0/topology/cluster_id":      "-1",
+				"cpu0/cpufreq/cpuinfo_max_freq": "2000000",
+				"cpu1/cpufreq/cpuinfo_max_freq": "1000000",
+				"cpu2/cpufreq/cpuinfo_max_freq": "2000000",
+				"cpu3/online":                   "1",
+			},
+			[]CPUCluster{
+				{Cores: []int{3}, MaxFrequencyKHz: 0},
+				{Cores: []int{1}, MaxFrequencyKHz: 1000000},
+				{Cores: []int{0, 2}, MaxFrequencyKHz: 2000000},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		dir, err := ioutil.TempDir("", "sysfs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		writeTree(t, dir, c.files)
+		if got := cpuClusters(dir); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: clusters = %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCPUInfoClusters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saved := sysCPUDir
+	sysCPUDir = dir
+	defer func() { sysCPUDir = saved }()
+
+	if info := cpuInfo(); info.Clusters != nil {
+		t.Errorf("clusters = %+v without a sysfs topology", info.Clusters)
+	}
+	files := map[string]string{}
+	for _, name := range []string{"cpu0", "cpu1", "cpu2", "cpu3", "cpu4", "cpu5", "cpu6", "cpu7", "cpu8", "cpu9"} {
+		files[name+"/topology/cluster_id"] = "0"
+	}
+	writeTree(t, dir, files)
+	info := cpuInfo()
+	if len(info.Clusters) != 1 || len(info.Clusters[0].Cores) != 10 {
+		t.Errorf("clusters = %+v, want the 10 cores", info.Clusters)
+	}
+	// the cores of the topology are counted when the process sees fewer
+	if info.Cores < 10 {
+		t.Errorf("cores = %d, want at least 10", info.Cores)
+	}
+}
+
+func TestCPUModel(t *testing.T) {
+	cases := []struct {
+		name    string
+		cpuinfo string
+		want    string
+	}{
+		{
+			"arm",
+			"processor\t: 0\nBogoMIPS\t: 38.40\nFeatures\t: fp asimd\n\nprocessor\t: 1\nBogoMIPS\t: 38.40\n\nHardware\t: Qualcomm Technologies, Inc SM8150\n",
+			"Qualcomm Technologies, Inc SM8150",
+		},
+		{
+			"x86",
+			"processor\t: 0\nmodel name\t: Intel(R) Xeon(R) CPU @ 2.20GHz\n\nprocessor\t: 1\nmodel name\t: Other\n",
+			"Intel(R) Xeon(R) CPU @ 2.20GHz",
+		},
+		{
+			// the hardware line wins over an earlier model name
+			"both",
+			"model name\t: ARMv8 Processor rev 14 (v8l)\nHardware\t: Qualcomm SDM845\n",
+			"Qualcomm SDM845",
+		},
+		{"empty", "processor\t: 0\n", ""},
+	}
+
+	dir, err := ioutil.TempDir("", "cpuinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, c := range cases {
+		path := filepath.Join(dir, c.name)
+		if err := ioutil.WriteFile(path, []byte(c.cpuinfo), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := cpuModel(path); got != c.want {
+			t.Errorf("%s: model = %q, want %q", c.name, got, c.want)
+		}
+	}
+	if got := cpuModel(filepath.Join(dir, "missing")); got != "" {
+		t.Errorf("model = %q for a missing file", got)
+	}
+}
@@ -9,9 +9,14 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 	"unsafe"
 
 	"github.com/Unknwon/com"
+	"github.com/abhiutd/snpe-predictor/dlc"
 	"github.com/pkg/errors"
 	"github.com/rai-project/dlframework"
 	"github.com/rai-project/dlframework/framework/feature"
@@ -30,6 +35,8 @@ const (
 	GPU          = 9
 	NNAPI        = 10
 	DSP          = 11
+	// pick the fastest runtime by a trial at load time, see SelectRuntime
+	AUTO = 12
 )
 
 // Predictor Structure definition
@@ -37,6 +44,28 @@ type PredictorData struct {
 	ctx   C.PredictorContext
 	mode  int
 	batch int
+	// serializes access to the native context, which keeps a single output buffer
+	mu sync.Mutex
+
+	model      string
+	options    *Options
+	inputShape []int
+	// every input of the network, without data
+	inputs []Tensor
+	// identifies the predictor in native log messages
+	logID C.int
+	// runtime the network runs on, after falling back to CPU
+	runtime string
+	// how the runtime was chosen when loaded with the AUTO mode
+	autoDecision *RuntimeDecision
+	// where loads and predictions are recorded, see metrics.go
+	metrics *metrics
+
+	// lifecycle, see lifecycle.go
+	state     int32
+	err       error
+	ready     chan struct{}
+	readyOnce sync.Once
 }
 
 // Make access to mode and batch public
@@ -47,28 +76,234 @@ func (pd *PredictorData) Inc() {
 
 // Create new Predictor Structure
 func NewPredictorData() *PredictorData {
-	return &PredictorData{}
+	return newPredictorData("", NewOptions())
+}
+
+func newPredictorData(model string, options *Options) *PredictorData {
+	return &PredictorData{
+		model:   model,
+		options: options,
+		mode:    options.mode,
+		batch:   options.batch,
+		metrics: predictorMetrics,
+		ready:   make(chan struct{}),
+	}
 }
 
 // Create new predictor
 func New(model string, mode, batch int, verbose bool, profile bool) (*PredictorData, error) {
+	return NewWithOptions(model, Mode(mode), Batch(batch), Verbose(verbose), Profile(profile))
+}
+
+// Create new predictor from a set of options
+func NewWithOptions(model string, opts ...Option) (*PredictorData, error) {
+	p := Declare(model, opts...)
+	if err := Load(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
 
-	modelFile := model
+// Build the native network, called with p.mu held
+func loadNative(p *PredictorData) error {
+	options := p.options
+
+	modelFile := p.model
 	if !com.IsFile(modelFile) {
-		return nil, errors.Errorf("file %s not found", modelFile)
+		return errors.Errorf("file %s not found", modelFile)
+	}
+	// catch files SNPE cannot open before they reach native code
+	if err := verifyChecksums(modelFile, options); err != nil {
+		return err
+	}
+	if err := dlc.Validate(modelFile); err != nil {
+		return err
 	}
 
-	return &PredictorData{
-		ctx: C.NewSnpe(
-			C.CString(modelFile),
-			C.int(batch),
-			C.int(mode),
-			C.bool(verbose),
-			C.bool(profile),
-		),
-		mode:  mode,
-		batch: batch,
-	}, nil
+	cOpts := C.SnpeOptions{
+		batch:               C.int(options.batch),
+		mode:                C.int(options.mode),
+		verbose:             C.bool(options.verbose),
+		profile:             C.bool(options.profile),
+		performance_profile: C.int(options.perfProfile),
+		execution_priority:  C.int(options.priority),
+		cpu_fixed_point:     C.bool(options.cpuFixedPoint),
+	}
+
+	if n := len(options.outputLayers); n > 0 {
+		// the array lives in C memory since it holds pointers
+		layers := (*[1 << 20]*C.char)(C.malloc(C.size_t(n) * C.size_t(unsafe.Sizeof((*C.char)(nil)))))[:n:n]
+		for ii, name := range options.outputLayers {
+			layers[ii] = C.CString(name)
+		}
+		defer func() {
+			for _, l := range layers {
+				C.free(unsafe.Pointer(l))
+			}
+			C.free(unsafe.Pointer(&layers[0]))
+		}()
+		cOpts.output_layers = &layers[0]
+		cOpts.num_output_layers = C.int(n)
+	}
+
+	var cache *initCacheEntry
+	if options.initCache {
+		var err error
+		cache, err = newInitCacheEntry(modelFile, options)
+		if err != nil {
+			return err
+		}
+		if err := cache.prepare(); err != nil {
+			return err
+		}
+		cOpts.init_cache = C.bool(true)
+		if cache.exists() {
+			// the cached container holds the model as well as the cache records
+			modelFile = cache.file
+		} else {
+			temp, err := cache.tempFile()
+			if err != nil {
+				return err
+			}
+			cOpts.init_cache_file = C.CString(temp)
+			defer C.free(unsafe.Pointer(cOpts.init_cache_file))
+		}
+	}
+
+	p.runtime = RuntimeName(effectiveMode(options.mode))
+	p.logID = registerNativeLog(p)
+	cOpts.log_id = p.logID
+
+	ctx, err := newNative(modelFile, cOpts)
+	if err != nil && cache != nil && modelFile == cache.file {
+		// the cached container cannot be loaded, rebuild it from the original DLC
+		log.WithError(err).WithField("init_cache", cache.file).Warn("dropping unusable init cache")
+		cache.remove()
+		modelFile = p.model
+		temp, tempErr := cache.tempFile()
+		if tempErr != nil {
+			unregisterNativeLog(p.logID)
+			return tempErr
+		}
+		cOpts.init_cache_file = C.CString(temp)
+		defer C.free(unsafe.Pointer(cOpts.init_cache_file))
+		ctx, err = newNative(modelFile, cOpts)
+	}
+	if err != nil {
+		if cache != nil {
+			cache.discard()
+		}
+		unregisterNativeLog(p.logID)
+		return errors.Wrapf(err, "failed to create predictor for %s", p.model)
+	}
+
+	if cOpts.init_cache_file != nil {
+		if err := cache.commit(); err != nil {
+			log.WithError(err).Warn("failed to persist the init cache")
+		}
+	}
+
+	var dims [8]C.int
+	rank := int(C.GetInputShapeSnpe(ctx, &dims[0], C.int(len(dims))))
+	if rank > len(dims) {
+		rank = len(dims)
+	}
+	p.inputShape = make([]int, rank)
+	for ii := 0; ii < rank; ii++ {
+		p.inputShape[ii] = int(dims[ii])
+	}
+
+	count := int(C.GetInputCountSnpe(ctx))
+	p.inputs = make([]Tensor, count)
+	for ii := 0; ii < count; ii++ {
+		rank := int(C.GetInputShapeAtSnpe(ctx, C.int(ii), &dims[0], C.int(len(dims))))
+		if rank > len(dims) {
+			rank = len(dims)
+		}
+		shape := make([]int, rank)
+		for jj := range shape {
+			shape[jj] = int(dims[jj])
+		}
+		p.inputs[ii] = Tensor{
+			Name:  C.GoString(C.GetInputNameSnpe(ctx, C.int(ii))),
+			Shape: shape,
+		}
+	}
+
+	p.ctx = ctx
+	return nil
+}
+
+// Build a native predictor from a DLC file
+func newNative(modelFile string, cOpts C.SnpeOptions) (C.PredictorContext, error) {
+	cModelFile := C.CString(modelFile)
+	defer C.free(unsafe.Pointer(cModelFile))
+
+	var cErr *C.char
+	ctx := C.NewSnpe(cModelFile, cOpts, &cErr)
+	if ctx == nil {
+		if cErr == nil {
+			return nil, errors.New("unknown error")
+		}
+		defer C.free(unsafe.Pointer(cErr))
+		return nil, errors.New(C.GoString(cErr))
+	}
+	return ctx, nil
+}
+
+// Version of the SNPE library the predictor is linked against
+func LibraryVersion() string {
+	return C.GoString(C.GetLibraryVersionSnpe())
+}
+
+// Whether the runtime of a hardware mode is available on this device
+func IsRuntimeAvailable(mode int) bool {
+	return bool(C.IsRuntimeAvailableSnpe(C.int(mode)))
+}
+
+// Name of the SNPE runtime a hardware mode runs on
+func RuntimeName(mode int) string {
+	switch {
+	case mode >= CPU_1_thread && mode <= CPU_8_thread:
+		return "CPU"
+	case mode == GPU:
+		return "GPU"
+	case mode == NNAPI:
+		return "NNAPI"
+	case mode == DSP:
+		return "DSP"
+	case mode == AUTO:
+		return "AUTO"
+	}
+	return "unknown"
+}
+
+// Hardware mode of a runtime name as returned by RuntimeName, or of a mode number
+func ParseRuntime(name string) (int, error) {
+	switch strings.ToUpper(name) {
+	case "CPU":
+		return CPU_1_thread, nil
+	case "GPU":
+		return GPU, nil
+	case "NNAPI":
+		return NNAPI, nil
+	case "DSP":
+		return DSP, nil
+	case "AUTO":
+		return AUTO, nil
+	}
+	if mode, err := strconv.Atoi(name); err == nil && mode >= CPU_1_thread && mode <= AUTO {
+		return mode, nil
+	}
+	return 0, errors.Errorf("unknown runtime %s", name)
+}
+
+// The native predictor falls back to CPU when a runtime is not available
+func effectiveMode(mode int) int {
+	if !IsRuntimeAvailable(mode) {
+		return CPU_1_thread
+	}
+	return mode
 }
 
 // Initialize TFLite
@@ -78,22 +313,182 @@ func init() {
 
 // Run inference
 func Predict(p *PredictorData, data []byte, quantize bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return predict(p, data, quantize)
+}
+
+// Run inference and return a copy of the raw output
+func predictRaw(p *PredictorData, data []byte, quantize bool) ([]float32, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := predict(p, data, quantize); err != nil {
+		return nil, err
+	}
+	return readOutput(p)
+}
+
+func predict(p *PredictorData, data []byte, quantize bool) (err error) {
+	defer func(start time.Time) {
+		p.metrics.observePrediction(p, time.Since(start), err)
+	}(time.Now())
+
+	if state := p.State(); state != StateReady {
+		return errors.Errorf("predictor is %s", state)
+	}
 
 	if len(data) == 0 {
 		return fmt.Errorf("image data is empty")
 	}
 
+	// the native single input path feeds the first input only
+	if n := len(p.inputs); n != 1 {
+		return errors.Errorf("the model has %d inputs, use PredictInputs", n)
+	}
+
+	if size := 4 * shapeSize(p.inputShape); !quantize && len(data) < size {
+		return errors.Errorf("input has %d bytes but the model expects %d", len(data), size)
+	}
+
 	ptr_quantize := (*C.int)(unsafe.Pointer(&data[0]))
 	ptr_float := (*C.float)(unsafe.Pointer(&data[0]))
-	if quantize == true {
-		C.PredictSnpe(p.ctx, ptr_quantize, ptr_float, true)
-	} else {
-		C.PredictSnpe(p.ctx, ptr_quantize, ptr_float, false)
+	var cErr *C.char
+	if !C.PredictSnpe(p.ctx, ptr_quantize, ptr_float, C.bool(quantize), &cErr) {
+		if cErr == nil {
+			return errors.New("failed to run inference")
+		}
+		defer C.free(unsafe.Pointer(cErr))
+		return errors.New(C.GoString(cErr))
+	}
+
+	return nil
+}
+
+// Run inference on a network with several inputs, given by name
+func PredictInputs(p *PredictorData, inputs []Tensor) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return predictInputs(p, inputs)
+}
+
+func predictInputs(p *PredictorData, inputs []Tensor) (err error) {
+	defer func(start time.Time) {
+		p.metrics.observePrediction(p, time.Since(start), err)
+	}(time.Now())
+	if state := p.State(); state != StateReady {
+		return errors.Errorf("predictor is %s", state)
+	}
+
+	// the native side takes the inputs one after the other in network order
+	var data []float32
+	for _, in := range p.inputs {
+		t, err := FindTensor(inputs, in.Name)
+		if err != nil {
+			return errors.Wrap(err, "missing network input")
+		}
+		if size := shapeSize(in.Shape); len(t.Data) != size {
+			return errors.Errorf("input %s has %d values but the model expects %d", in.Name, len(t.Data), size)
+		}
+		data = append(data, t.Data...)
+	}
+	if len(data) == 0 {
+		return errors.New("input data is empty")
 	}
 
+	var cErr *C.char
+	if !C.PredictInputsSnpe(p.ctx, (*C.float)(unsafe.Pointer(&data[0])), C.int(len(data)), &cErr) {
+		if cErr == nil {
+			return errors.New("failed to run inference")
+		}
+		defer C.free(unsafe.Pointer(cErr))
+		return errors.New(C.GoString(cErr))
+	}
 	return nil
 }
 
+// Copy the output of the last inference out of the native context
+func readOutput(p *PredictorData) ([]float32, error) {
+	if p.ctx == nil {
+		return nil, errors.New("empty predictor context")
+	}
+
+	predLen := int(C.GetPredLenSnpe(p.ctx))
+	if predLen == 0 {
+		return nil, errors.New("null predLen")
+	}
+
+	cPredictions := C.GetPredictionsSnpe(p.ctx)
+	if cPredictions == nil {
+		return nil, errors.New("empty predictions")
+	}
+
+	slice := (*[1 << 28]float32)(unsafe.Pointer(cPredictions))[:predLen:predLen]
+	output := make([]float32, predLen)
+	copy(output, slice)
+
+	return output, nil
+}
+
+// Run inference and return a copy of every output tensor
+func predictTensors(p *PredictorData, data []byte, quantize bool) ([]Tensor, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := predict(p, data, quantize); err != nil {
+		return nil, err
+	}
+	return readOutputTensors(p)
+}
+
+// Return the output tensors of the last inference
+func ReadOutputTensors(p *PredictorData) ([]Tensor, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return readOutputTensors(p)
+}
+
+func readOutputTensors(p *PredictorData) ([]Tensor, error) {
+	if p.ctx == nil {
+		return nil, errors.New("empty predictor context")
+	}
+
+	count := int(C.GetOutputCountSnpe(p.ctx))
+	if count == 0 {
+		return nil, errors.New("no output tensors")
+	}
+
+	tensors := make([]Tensor, count)
+	for ii := 0; ii < count; ii++ {
+		idx := C.int(ii)
+
+		var dims [8]C.int
+		rank := int(C.GetOutputShapeSnpe(p.ctx, idx, &dims[0], C.int(len(dims))))
+		if rank > len(dims) {
+			rank = len(dims)
+		}
+		shape := make([]int, rank)
+		for jj := range shape {
+			shape[jj] = int(dims[jj])
+		}
+
+		size := int(C.GetOutputSizeSnpe(p.ctx, idx))
+		data := make([]float32, size)
+		if size > 0 {
+			cData := C.GetOutputDataSnpe(p.ctx, idx)
+			if cData == nil {
+				return nil, errors.Errorf("empty output tensor %d", ii)
+			}
+			copy(data, (*[1 << 28]float32)(unsafe.Pointer(cData))[:size:size])
+		}
+
+		tensors[ii] = Tensor{
+			Name:  C.GoString(C.GetOutputNameSnpe(p.ctx, idx)),
+			Shape: shape,
+			Data:  data,
+		}
+	}
+	return tensors, nil
+}
+
 // Return Top-5 predicted label
 func ReadPredictionOutput(p *PredictorData, labelFile string) (string, error) {
 
@@ -159,7 +554,26 @@ func ReadPredictionOutput(p *PredictorData, labelFile string) (string, error) {
 
 }
 
+// Release a native predictor
+func deleteNative(ctx C.PredictorContext) {
+	if ctx != nil {
+		C.DeleteSnpe(ctx)
+	}
+}
+
 // Delete the predictor
 func Close(p *PredictorData) {
-	C.DeleteSnpe(p.ctx)
+	if p.State() == StateLoading {
+		<-p.Ready()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx != nil {
+		C.DeleteSnpe(p.ctx)
+		p.ctx = nil
+		unregisterNativeLog(p.logID)
+		p.metrics.closed()
+	}
+	p.setState(StateClosed)
+	p.closeReady()
 }
@@ -7,16 +7,87 @@ extern "C" {
 
 #include <stddef.h>
 #include <stdbool.h>
+#include <stdint.h>
 
 typedef void *PredictorContext;
 
-PredictorContext NewSnpe(char *model_file, int batch, int mode, bool verbose, bool profile);
+typedef struct {
+  int batch;
+  int mode;
+  bool verbose;
+  bool profile;
+  // let SNPE generate and use init cache records
+  bool init_cache;
+  // where to save the container with the generated cache records, NULL to skip
+  char *init_cache_file;
+  // layers whose outputs are returned, none for the final output
+  char **output_layers;
+  int num_output_layers;
+  // identifies the predictor in the messages passed to goSnpeLog
+  int log_id;
+  // one of SNPE_PROFILE_*
+  int performance_profile;
+  // one of SNPE_PRIORITY_*
+  int execution_priority;
+  // run the CPU runtime in fixed point mode on quantized models
+  bool cpu_fixed_point;
+} SnpeOptions;
+
+enum {
+  SNPE_PROFILE_DEFAULT = 0,
+  SNPE_PROFILE_BALANCED = 1,
+  SNPE_PROFILE_HIGH_PERFORMANCE = 2,
+  SNPE_PROFILE_POWER_SAVER = 3,
+  SNPE_PROFILE_SYSTEM_SETTINGS = 4,
+  SNPE_PROFILE_SUSTAINED_HIGH_PERFORMANCE = 5,
+  SNPE_PROFILE_BURST = 6,
+};
+
+enum {
+  SNPE_PRIORITY_NORMAL = 0,
+  SNPE_PRIORITY_HIGH = 1,
+  SNPE_PRIORITY_LOW = 2,
+};
+
+// severity of the native log messages
+enum {
+  SNPE_LOG_DEBUG = 0,
+  SNPE_LOG_INFO = 1,
+  SNPE_LOG_WARN = 2,
+  SNPE_LOG_ERROR = 3,
+};
+
+// messages below the level are dropped before reaching Go
+void SetLogLevelSnpe(int level);
+
+// on failure NULL is returned and error points to a message the caller frees
+PredictorContext NewSnpe(char *model_file, SnpeOptions opts, char **error);
+
+const char *GetLibraryVersionSnpe();
+
+bool IsRuntimeAvailableSnpe(int mode);
+
+// SNPE runtimes reported by IsRuntimeTypeAvailableSnpe
+enum {
+  SNPE_RUNTIME_CPU = 0,
+  SNPE_RUNTIME_GPU = 1,
+  SNPE_RUNTIME_GPU_FLOAT16 = 2,
+  SNPE_RUNTIME_DSP = 3,
+  SNPE_RUNTIME_AIP = 4,
+};
+
+bool IsRuntimeTypeAvailableSnpe(int runtime);
 
 void SetModeSnpe(int mode);
 
 void InitSnpe();
 
-void PredictSnpe(PredictorContext pred, int* inputData_quantize, float* inputData_float, bool quantize);
+// run a network with a single input, on failure error points to a message the caller frees
+bool PredictSnpe(PredictorContext pred, int* inputData_quantize, float* inputData_float, bool quantize, char **error);
+
+// run a network with several inputs stored one after the other in the
+// order of GetInputNameSnpe, on failure error points to a message the caller frees
+bool PredictInputsSnpe(PredictorContext pred, float* data, int size, char **error);
 
 float* GetPredictionsSnpe(PredictorContext pred);
 
@@ -28,8 +99,26 @@ int GetHeightSnpe(PredictorContext pred);
 
 int GetChannelsSnpe(PredictorContext pred);
 
+int GetInputShapeSnpe(PredictorContext pred, int *dims, int max_dims);
+
+int GetInputCountSnpe(PredictorContext pred);
+
+const char *GetInputNameSnpe(PredictorContext pred, int index);
+
+int GetInputShapeAtSnpe(PredictorContext pred, int index, int *dims, int max_dims);
+
 int GetPredLenSnpe(PredictorContext pred);
 
+int GetOutputCountSnpe(PredictorContext pred);
+
+const char *GetOutputNameSnpe(PredictorContext pred, int index);
+
+int GetOutputShapeSnpe(PredictorContext pred, int index, int *dims, int max_dims);
+
+int GetOutputSizeSnpe(PredictorContext pred, int index);
+
+float *GetOutputDataSnpe(PredictorContext pred, int index);
+
 void SetInputSnpe_float(float* out, float* in, int image_height, int image_width, int image_channels, int model_height, int model_width, int model_channels);
 
 void SetInputSnpe_quantize_8_unsigned(uint8_t* out, int* in, int image_height, int image_width, int image_channels, int model_height, int model_width, int model_channels);
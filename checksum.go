@@ -0,0 +1,137 @@
+package snpe
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rai-project/dlframework"
+)
+
+// ChecksumError is returned when a file does not match its expected digest
+type ChecksumError struct {
+	Path      string
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch for %s: expected %s, got %s (truncated or corrupted file?)",
+		e.Algorithm, e.Path, e.Expected, e.Actual)
+}
+
+// Verify a file against an md5 or sha256 digest given as hex, optionally
+// prefixed by the algorithm (md5:..., sha256:...). An empty digest is not checked.
+func VerifyChecksum(path, digest string) error {
+	algorithm, expected, err := parseDigest(digest)
+	if err != nil {
+		return errors.Wrapf(err, "invalid checksum for %s", path)
+	}
+	if expected == "" {
+		return nil
+	}
+
+	// hash the file once while streaming it, DLC files can be large
+	actual, err := fileDigest(path, algorithm)
+	if err != nil {
+		return err
+	}
+	if actual == expected {
+		return nil
+	}
+	return &ChecksumError{
+		Path:      path,
+		Algorithm: algorithm,
+		Expected:  expected,
+		Actual:    actual,
+	}
+}
+
+// Verify the model and label files of a manifest
+func VerifyManifest(m *dlframework.ModelManifest, modelFile, labelFile string) error {
+	if err := VerifyChecksum(modelFile, m.GetModel().GetGraphChecksum()); err != nil {
+		return err
+	}
+	if labelFile == "" {
+		return nil
+	}
+	return VerifyChecksum(labelFile, manifestLabelsChecksum(m))
+}
+
+// MLModelScope manifests carry the checksum of the labels (features) file as an attribute
+func manifestLabelsChecksum(m *dlframework.ModelManifest) string {
+	return m.GetAttributes()["features_checksum"]
+}
+
+// Verify the files configured through the options, called before the network is built
+func verifyChecksums(modelFile string, opts *Options) error {
+	modelChecksum, labelsChecksum := opts.modelChecksum, opts.labelsChecksum
+	if m := opts.manifest; m != nil {
+		if modelChecksum == "" {
+			modelChecksum = m.GetModel().GetGraphChecksum()
+		}
+		if labelsChecksum == "" {
+			labelsChecksum = manifestLabelsChecksum(m)
+		}
+	}
+	if err := VerifyChecksum(modelFile, modelChecksum); err != nil {
+		return err
+	}
+	if opts.labels == "" {
+		return nil
+	}
+	return VerifyChecksum(opts.labels, labelsChecksum)
+}
+
+func parseDigest(digest string) (string, string, error) {
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if digest == "" {
+		return "", "", nil
+	}
+	if kv := strings.SplitN(digest, ":", 2); len(kv) == 2 {
+		algorithm, hash := kv[0], kv[1]
+		if algorithm != "md5" && algorithm != "sha256" {
+			return "", "", errors.Errorf("unsupported checksum algorithm %s", algorithm)
+		}
+		if len(hash) != hashLen(algorithm) {
+			return "", "", errors.Errorf("%s checksum must have %d hex digits", algorithm, hashLen(algorithm))
+		}
+		return algorithm, hash, nil
+	}
+	switch len(digest) {
+	case hashLen("md5"):
+		return "md5", digest, nil
+	case hashLen("sha256"):
+		return "sha256", digest, nil
+	}
+	return "", "", errors.Errorf("checksum %s is neither md5 nor sha256", digest)
+}
+
+func hashLen(algorithm string) int {
+	if algorithm == "md5" {
+		return 2 * md5.Size
+	}
+	return 2 * sha256.Size
+}
+
+func fileDigest(path, algorithm string) (string, error) {
+	if algorithm == "sha256" {
+		return fileSHA256(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "failed to hash %s", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
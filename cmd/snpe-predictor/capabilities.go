@@ -0,0 +1,28 @@
+// +build cgo
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	snpe "github.com/abhiutd/snpe-predictor"
+)
+
+func init() {
+	register("capabilities", "print the SNPE version, available runtimes and CPU topology", capabilities)
+}
+
+func capabilities(args []string) int {
+	fs := newFlagSet("capabilities", "")
+	fs.Parse(args)
+
+	buf, err := json.MarshalIndent(snpe.Capabilities(), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(buf))
+	return 0
+}
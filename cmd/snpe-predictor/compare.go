@@ -0,0 +1,114 @@
+// +build cgo
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	snpe "github.com/abhiutd/snpe-predictor"
+)
+
+func init() {
+	register("compare", "run inputs on several runtimes and compare their outputs", compare)
+}
+
+func compare(args []string) int {
+	fs := newFlagSet("compare", "[flags] model.dlc input.raw...")
+	reference := fs.String("reference", "cpu", "runtime the others are compared to")
+	runtimes := fs.String("runtimes", "gpu,dsp", "comma separated runtimes to compare")
+	topK := fs.Int("topk", 5, "number of top classes compared")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	tol := toleranceFlags(fs, snpe.Tolerances{})
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return 2
+	}
+
+	opts := snpe.ConsistencyOptions{
+		TopK:       *topK,
+		Tolerances: *tol,
+	}
+	var err error
+	if opts.Reference, err = snpe.ParseRuntime(*reference); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	for _, name := range strings.Split(*runtimes, ",") {
+		mode, err := snpe.ParseRuntime(strings.TrimSpace(name))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		opts.Runtimes = append(opts.Runtimes, mode)
+	}
+
+	// inputs are raw float32 tensors as fed to Predict
+	var inputs [][]byte
+	for _, path := range fs.Args()[1:] {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		inputs = append(inputs, data)
+	}
+
+	report, err := snpe.CheckConsistency(fs.Arg(0), inputs, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printConsistency(report, fs.Args()[1:])
+	}
+	if report.Flagged > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Register the tolerance flags with the given defaults, 0 disables a check
+func toleranceFlags(fs *flag.FlagSet, def snpe.Tolerances) *snpe.Tolerances {
+	tol := &snpe.Tolerances{}
+	fs.Float64Var(&tol.MaxAbsError, "max-abs", def.MaxAbsError, "maximum absolute error")
+	fs.Float64Var(&tol.MaxRelError, "max-rel", def.MaxRelError, "maximum relative error")
+	fs.Float64Var(&tol.MaxKL, "max-kl", def.MaxKL, "maximum Kullback-Leibler divergence")
+	fs.Float64Var(&tol.MaxJensenShannon, "max-js", def.MaxJensenShannon, "maximum Jensen-Shannon divergence")
+	fs.Float64Var(&tol.MaxHellinger, "max-hellinger", def.MaxHellinger, "maximum Hellinger distance")
+	fs.Float64Var(&tol.MinCorrelation, "min-correlation", def.MinCorrelation, "minimum correlation")
+	fs.Float64Var(&tol.MinTopKAgreement, "min-topk", def.MinTopKAgreement, "minimum share of the reference top-k classes found")
+	return tol
+}
+
+func printConsistency(report *snpe.ConsistencyReport, inputs []string) {
+	fmt.Printf("model:     %s\nreference: %s\n", report.Model, report.Reference)
+	if len(report.Skipped) > 0 {
+		fmt.Printf("skipped:   %s (not available)\n", strings.Join(report.Skipped, ", "))
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "INPUT\tRUNTIME\tOUTPUT\tMAX ABS\tMAX REL\tKL\tJS\tHELLINGER\tCORR\tTOP-K\tTOP-1\t")
+	for _, in := range report.Inputs {
+		for _, c := range in.Outputs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%.3g\t%.3g\t%.3g\t%.3g\t%.3g\t%.4f\t%.2f\t%v\t%s\n",
+				inputs[in.Input], c.Runtime, c.Output, c.MaxAbsError, c.MaxRelError,
+				c.KL, c.JensenShannon, c.Hellinger, c.Correlation, c.TopKAgreement, c.Top1Match,
+				strings.Join(c.Violations, ", "))
+		}
+	}
+	w.Flush()
+	fmt.Printf("\n%d of %d inputs exceed the tolerances\n", report.Flagged, len(report.Inputs))
+}
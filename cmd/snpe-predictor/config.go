@@ -0,0 +1,36 @@
+// +build cgo
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	snpe "github.com/abhiutd/snpe-predictor"
+	"github.com/rai-project/config"
+)
+
+func init() {
+	register("config", "print the effective snpe configuration", printConfig)
+}
+
+func printConfig(args []string) int {
+	fs := newFlagSet("config", "[flags]")
+	file := fs.String("config", "", "configuration file, searched in the usual locations when empty")
+	fs.Parse(args)
+
+	opts := []config.Option{config.AppName("snpe-predictor")}
+	if *file != "" {
+		opts = append(opts, config.ConfigFileAbsolutePath(*file))
+	}
+	config.Init(opts...)
+
+	buf, err := json.MarshalIndent(snpe.EffectiveConfig(), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(buf))
+	return 0
+}
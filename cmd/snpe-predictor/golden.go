@@ -0,0 +1,128 @@
+// +build cgo
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	snpe "github.com/abhiutd/snpe-predictor"
+)
+
+func init() {
+	register("golden", "record golden outputs of a model or verify them for regressions", golden)
+}
+
+func golden(args []string) int {
+	if len(args) == 0 || (args[0] != "record" && args[0] != "verify") {
+		fmt.Fprintf(os.Stderr, "usage: %s golden record|verify [flags] model.dlc [input.raw...]\n", os.Args[0])
+		return 2
+	}
+	if args[0] == "record" {
+		return goldenRecord(args[1:])
+	}
+	return goldenVerify(args[1:])
+}
+
+func goldenRecord(args []string) int {
+	fs := newFlagSet("golden record", "[flags] model.dlc input.raw...")
+	dir := fs.String("dir", "golden", "directory of the golden set")
+	runtime := fs.String("runtime", "cpu", "runtime the outputs are recorded on")
+	quantize := fs.Bool("quantize", false, "inputs are quantized")
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return 2
+	}
+
+	p, err := goldenPredictor(fs.Arg(0), *runtime)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer snpe.Close(p)
+
+	var inputs []snpe.GoldenInput
+	for _, path := range fs.Args()[1:] {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		base := filepath.Base(path)
+		inputs = append(inputs, snpe.GoldenInput{
+			Name: strings.TrimSuffix(base, filepath.Ext(base)),
+			Data: data,
+		})
+	}
+
+	set, err := snpe.RecordGolden(*dir, p, inputs, *quantize)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("recorded %d inputs of %s on %s with SNPE %s into %s\n",
+		len(set.Cases), set.Model, set.Runtime, set.SNPEVersion, *dir)
+	return 0
+}
+
+func goldenVerify(args []string) int {
+	fs := newFlagSet("golden verify", "[flags] model.dlc")
+	dir := fs.String("dir", "golden", "directory of the golden set")
+	runtime := fs.String("runtime", "", "runtime to verify on, defaults to the recorded one")
+	topK := fs.Int("topk", 5, "number of top classes compared")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	tol := toleranceFlags(fs, snpe.Tolerances{
+		MaxAbsError:      1e-4,
+		MinTopKAgreement: 1,
+	})
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	if *runtime == "" {
+		set, err := snpe.LoadGolden(*dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		*runtime = set.Runtime
+	}
+	p, err := goldenPredictor(fs.Arg(0), *runtime)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer snpe.Close(p)
+
+	report, err := snpe.VerifyGolden(*dir, p, *tol, *topK)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		report.WriteTo(os.Stdout)
+	}
+	if report.Regressions > 0 {
+		return 1
+	}
+	return 0
+}
+
+func goldenPredictor(model, runtime string) (*snpe.PredictorData, error) {
+	mode, err := snpe.ParseRuntime(runtime)
+	if err != nil {
+		return nil, err
+	}
+	return snpe.NewWithOptions(model, snpe.Mode(mode))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/abhiutd/snpe-predictor/dlc"
+)
+
+func init() {
+	register("inspect", "list the records and model metadata of a DLC file", inspect)
+}
+
+func inspect(args []string) int {
+	fs := newFlagSet("inspect", "[-json] [-verify] model.dlc...")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	verify := fs.Bool("verify", false, "read every record to detect truncated or corrupted files")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, path := range fs.Args() {
+		if err := inspectFile(path, *asJSON, *verify); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func inspectFile(path string, asJSON, verify bool) error {
+	c, err := dlc.Open(path)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if verify {
+		if err := c.Verify(); err != nil {
+			return err
+		}
+	}
+
+	info := c.Info()
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			*dlc.Container
+			Info      dlc.ModelInfo `json:"info"`
+			InitCache bool          `json:"init_cache"`
+		}{c, info, c.HasInitCache()})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "File:\t%s\n", path)
+	fmt.Fprintf(w, "Converter:\t%s\n", info.Converter)
+	fmt.Fprintf(w, "Converter version:\t%s\n", info.ConverterVersion)
+	if info.Copyright != "" {
+		fmt.Fprintf(w, "Copyright:\t%s\n", info.Copyright)
+	}
+	fmt.Fprintf(w, "Init cache:\t%v\n", c.HasInitCache())
+	if q := info.Quantization; q != nil {
+		fmt.Fprintf(w, "Quantization:\tweights %d bit, activations %d bit, bias %d bit, enhanced %v\n",
+			q.WeightsBitwidth, q.ActivationBitwidth, q.BiasBitwidth, q.EnhancedQuantizer)
+	} else {
+		fmt.Fprintf(w, "Quantization:\tnone\n")
+	}
+	w.Flush()
+
+	fmt.Println("\nInputs:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, t := range info.Inputs {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", t.Name, formatShape(t.Shape), t.Type, t.Encoding)
+	}
+	w.Flush()
+
+	fmt.Println("\nOutputs:")
+	for _, t := range info.Outputs {
+		fmt.Printf("  %s\n", t.Name)
+	}
+
+	fmt.Println("\nLayers: not available, the layer table and per-tensor encodings of the model record are not decoded")
+
+	fmt.Println("\nRecords:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "  name\tsize\tcompressed\tcrc32\t\n")
+	for _, r := range c.Records {
+		fmt.Fprintf(w, "  %s\t%d\t%d\t%08x\t\n", r.Name, r.Size, r.CompressedSize, r.CRC32)
+	}
+	w.Flush()
+
+	return nil
+}
+
+func formatShape(shape []int) string {
+	if len(shape) == 0 {
+		return "?"
+	}
+	dims := make([]string, len(shape))
+	for ii, d := range shape {
+		dims[ii] = fmt.Sprint(d)
+	}
+	return strings.Join(dims, "x")
+}
@@ -0,0 +1,194 @@
+package snpe
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/k0kubun/pp"
+	"github.com/rai-project/config"
+	"github.com/rai-project/godotenv"
+	"github.com/rai-project/vipertags"
+)
+
+// Environment variable naming the .env file read before the snpe section
+const envFileVariable = "SNPE_ENV_FILE"
+
+type snpeConfig struct {
+	// runtimes tried in order, the first one available on the device is used
+	RuntimeOrder []string `json:"runtime_order" config:"snpe.runtime_order" env:"SNPE_RUNTIME_ORDER" default:"dsp gpu cpu"`
+	// directory relative model paths are resolved against
+	ModelDir  string `json:"model_dir" config:"snpe.model_dir" env:"SNPE_MODEL_DIR"`
+	CacheDir  string `json:"cache_dir" config:"snpe.cache_dir" env:"SNPE_CACHE_DIR"`
+	InitCache bool   `json:"init_cache" config:"snpe.init_cache" env:"SNPE_INIT_CACHE" default:"false"`
+	// number of threads of the CPU runtime, 1 to 8
+	Threads            int    `json:"threads" config:"snpe.threads" env:"SNPE_THREADS" default:"1"`
+	PerformanceProfile string `json:"performance_profile" config:"snpe.performance_profile" env:"SNPE_PERFORMANCE_PROFILE" default:"default"`
+	ExecutionPriority  string `json:"execution_priority" config:"snpe.execution_priority" env:"SNPE_EXECUTION_PRIORITY" default:"normal"`
+	CPUFixedPoint      bool   `json:"cpu_fixed_point" config:"snpe.cpu_fixed_point" env:"SNPE_CPU_FIXED_POINT" default:"false"`
+	LogLevel           string `json:"log_level" config:"snpe.log_level" env:"SNPE_LOG_LEVEL" default:"info"`
+	// minimum level of the messages of the native predictor
+	NativeLogLevel string `json:"native_log_level" config:"snpe.native_log_level" env:"SNPE_NATIVE_LOG_LEVEL" default:"info"`
+	Verbose        bool   `json:"verbose" config:"snpe.verbose" env:"SNPE_VERBOSE" default:"false"`
+	Profile        bool   `json:"profile" config:"snpe.profile" env:"SNPE_PROFILE" default:"false"`
+	// .env file read before the section, existing variables take precedence
+	EnvFile string        `json:"env_file" config:"-"`
+	done    chan struct{} `json:"-" config:"-"`
+}
+
+var (
+	// Config holds the snpe section of the configuration
+	Config = &snpeConfig{
+		done: make(chan struct{}),
+	}
+)
+
+func (snpeConfig) ConfigName() string {
+	return "SNPE"
+}
+
+func (c *snpeConfig) SetDefaults() {
+	vipertags.SetDefaults(c)
+}
+
+func (c *snpeConfig) Read() {
+	defer close(c.done)
+	c.EnvFile = os.Getenv(envFileVariable)
+	if c.EnvFile == "" {
+		c.EnvFile = ".env"
+	}
+	if _, err := os.Stat(c.EnvFile); err == nil {
+		if err := godotenv.Load(c.EnvFile); err != nil {
+			log.WithError(err).WithField("env_file", c.EnvFile).Error("failed to read the env file")
+		}
+	} else {
+		c.EnvFile = ""
+	}
+	vipertags.Fill(c)
+	c.RuntimeOrder = splitList(c.RuntimeOrder)
+	if c.Threads < CPU_1_thread || c.Threads > CPU_8_thread {
+		c.Threads = CPU_1_thread
+	}
+}
+
+func (c snpeConfig) Wait() {
+	<-c.done
+}
+
+// Whether the section has been read, the zero values are in effect until then
+func (c snpeConfig) isRead() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c snpeConfig) String() string {
+	return pp.Sprintln(c)
+}
+
+func (c snpeConfig) Debug() {
+	log.Debug("SNPE Config = ", c)
+}
+
+// Hardware mode of the first available runtime of the configured order,
+// CPU with the configured threads when none is
+func (c snpeConfig) Mode() int {
+	for _, name := range c.RuntimeOrder {
+		mode, err := ParseRuntime(name)
+		if err != nil {
+			log.WithError(err).Warn("ignoring runtime of snpe.runtime_order")
+			continue
+		}
+		if mode >= CPU_1_thread && mode <= CPU_8_thread {
+			return c.threads()
+		}
+		if mode == AUTO {
+			return AUTO
+		}
+		if IsRuntimeAvailable(mode) {
+			return mode
+		}
+	}
+	return c.threads()
+}
+
+// CPU mode of the configured threads, a single thread when the section is unread
+func (c snpeConfig) threads() int {
+	if c.Threads < CPU_1_thread || c.Threads > CPU_8_thread {
+		return CPU_1_thread
+	}
+	return c.Threads
+}
+
+// Path of a model, relative paths are resolved against the model directory
+func (c snpeConfig) ModelPath(model string) string {
+	if c.ModelDir == "" || filepath.IsAbs(model) {
+		return model
+	}
+	return filepath.Join(c.ModelDir, model)
+}
+
+// Options of a predictor built from the configuration, NewOptions starts
+// from them once the configuration is read and the options it is given
+// take precedence
+func ConfigOptions() []Option {
+	opts := []Option{
+		Mode(Config.Mode()),
+		Verbose(Config.Verbose),
+		Profile(Config.Profile),
+		InitCache(Config.InitCache),
+		CacheDir(Config.CacheDir),
+		CPUFixedPoint(Config.CPUFixedPoint),
+	}
+	if profile, err := ParsePerfProfile(Config.PerformanceProfile); err == nil {
+		opts = append(opts, PerformanceProfile(profile))
+	} else {
+		log.WithError(err).Warn("ignoring snpe.performance_profile")
+	}
+	if priority, err := ParsePriority(Config.ExecutionPriority); err == nil {
+		opts = append(opts, ExecutionPriority(priority))
+	} else {
+		log.WithError(err).Warn("ignoring snpe.execution_priority")
+	}
+	return opts
+}
+
+// Configuration in effect, keyed by configuration key, for diagnostics
+func EffectiveConfig() map[string]interface{} {
+	mode := Config.Mode()
+	return map[string]interface{}{
+		"snpe.runtime_order":       Config.RuntimeOrder,
+		"snpe.runtime":             RuntimeName(mode),
+		"snpe.mode":                mode,
+		"snpe.model_dir":           Config.ModelDir,
+		"snpe.cache_dir":           Config.CacheDir,
+		"snpe.init_cache":          Config.InitCache,
+		"snpe.threads":             Config.Threads,
+		"snpe.performance_profile": Config.PerformanceProfile,
+		"snpe.execution_priority":  Config.ExecutionPriority,
+		"snpe.cpu_fixed_point":     Config.CPUFixedPoint,
+		"snpe.log_level":           Config.LogLevel,
+		"snpe.native_log_level":    Config.NativeLogLevel,
+		"snpe.verbose":             Config.Verbose,
+		"snpe.profile":             Config.Profile,
+		"snpe.env_file":            Config.EnvFile,
+	}
+}
+
+// Lists given as a single comma or space separated value are split
+func splitList(values []string) []string {
+	var res []string
+	for _, v := range values {
+		for _, s := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }) {
+			res = append(res, strings.ToLower(s))
+		}
+	}
+	return res
+}
+
+func init() {
+	config.Register(Config)
+}
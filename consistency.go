@@ -0,0 +1,309 @@
+package snpe
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/rai-project/dlframework"
+	"github.com/rai-project/dlframework/framework/feature"
+)
+
+// Tolerances an output must stay within, zero values are not checked
+type Tolerances struct {
+	MaxAbsError      float64 `json:"max_abs_error,omitempty"`
+	MaxRelError      float64 `json:"max_rel_error,omitempty"`
+	MaxKL            float64 `json:"max_kl,omitempty"`
+	MaxJensenShannon float64 `json:"max_js,omitempty"`
+	MaxHellinger     float64 `json:"max_hellinger,omitempty"`
+	MinCorrelation   float64 `json:"min_correlation,omitempty"`
+	// share of the reference top-K classes found in the top-K of the runtime
+	MinTopKAgreement float64 `json:"min_topk_agreement,omitempty"`
+}
+
+// ConsistencyOptions configures a cross-runtime comparison
+type ConsistencyOptions struct {
+	// hardware mode the others are compared to, defaults to CPU_1_thread
+	Reference int
+	// hardware modes compared to the reference
+	Runtimes []int
+	// number of top classes compared, defaults to 5
+	TopK int
+	Tolerances
+	Quantize bool
+	// options used to build every predictor, the mode is overridden
+	ModelOptions []Option
+}
+
+// OutputComparison holds the differences of one output between the
+// reference and another runtime. The divergences are computed on the
+// outputs seen as distributions, softmax is applied to outputs that are not.
+type OutputComparison struct {
+	Output        string   `json:"output"`
+	Runtime       string   `json:"runtime"`
+	Mode          int      `json:"mode"`
+	MaxAbsError   float64  `json:"max_abs_error"`
+	MaxRelError   float64  `json:"max_rel_error"`
+	KL            float64  `json:"kl"`
+	JensenShannon float64  `json:"js"`
+	Hellinger     float64  `json:"hellinger"`
+	Correlation   float64  `json:"correlation"`
+	TopKAgreement float64  `json:"topk_agreement"`
+	Top1Match     bool     `json:"top1_match"`
+	Violations    []string `json:"violations,omitempty"`
+}
+
+// InputConsistency is the comparison of every output for one input
+type InputConsistency struct {
+	Input   int                `json:"input"`
+	Outputs []OutputComparison `json:"outputs"`
+	Flagged bool               `json:"flagged"`
+}
+
+// ConsistencyReport is the result of a cross-runtime comparison
+type ConsistencyReport struct {
+	Model     string             `json:"model"`
+	Reference string             `json:"reference"`
+	Runtimes  []string           `json:"runtimes"`
+	Skipped   []string           `json:"skipped,omitempty"`
+	Inputs    []InputConsistency `json:"inputs"`
+	// number of inputs exceeding a tolerance
+	Flagged int `json:"flagged"`
+}
+
+// Run the same inputs on the reference and the other runtimes and compare
+// every output. Runtimes not available on the device are skipped.
+func CheckConsistency(model string, inputs [][]byte, opts ConsistencyOptions) (*ConsistencyReport, error) {
+	if len(inputs) == 0 {
+		return nil, errors.New("no inputs to compare")
+	}
+	if opts.Reference == 0 {
+		opts.Reference = CPU_1_thread
+	}
+	if opts.TopK <= 0 {
+		opts.TopK = 5
+	}
+
+	report := &ConsistencyReport{
+		Model:     model,
+		Reference: RuntimeName(opts.Reference),
+		Inputs:    make([]InputConsistency, len(inputs)),
+	}
+	for ii := range report.Inputs {
+		report.Inputs[ii].Input = ii
+	}
+
+	reference, err := runOnRuntime(model, inputs, opts.Reference, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, mode := range opts.Runtimes {
+		name := RuntimeName(mode)
+		if !IsRuntimeAvailable(mode) {
+			log.WithField("runtime", name).Warn("runtime not available, skipping it")
+			report.Skipped = append(report.Skipped, name)
+			continue
+		}
+		outputs, err := runOnRuntime(model, inputs, mode, opts)
+		if err != nil {
+			return nil, err
+		}
+		report.Runtimes = append(report.Runtimes, name)
+		for ii := range inputs {
+			comparisons, err := CompareOutputs(reference[ii], outputs[ii], opts.TopK, opts.Tolerances)
+			if err != nil {
+				return nil, errors.Wrapf(err, "input %d on %s", ii, name)
+			}
+			for jj := range comparisons {
+				comparisons[jj].Runtime = name
+				comparisons[jj].Mode = mode
+			}
+			report.Inputs[ii].Outputs = append(report.Inputs[ii].Outputs, comparisons...)
+		}
+	}
+
+	for ii := range report.Inputs {
+		for _, c := range report.Inputs[ii].Outputs {
+			if len(c.Violations) > 0 {
+				report.Inputs[ii].Flagged = true
+			}
+		}
+		if report.Inputs[ii].Flagged {
+			report.Flagged++
+		}
+	}
+	return report, nil
+}
+
+// Outputs of every input on one runtime
+func runOnRuntime(model string, inputs [][]byte, mode int, opts ConsistencyOptions) ([][]Tensor, error) {
+	modelOpts := append(append([]Option(nil), opts.ModelOptions...), Mode(mode))
+	p, err := NewWithOptions(model, modelOpts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load %s on %s", model, RuntimeName(mode))
+	}
+	defer Close(p)
+
+	outputs := make([][]Tensor, len(inputs))
+	for ii, data := range inputs {
+		if outputs[ii], err = predictTensors(p, data, opts.Quantize); err != nil {
+			return nil, errors.Wrapf(err, "input %d on %s", ii, RuntimeName(mode))
+		}
+	}
+	return outputs, nil
+}
+
+// Compare the outputs of a runtime to the reference outputs, matched by name
+func CompareOutputs(reference, outputs []Tensor, topK int, tol Tolerances) ([]OutputComparison, error) {
+	res := make([]OutputComparison, 0, len(reference))
+	for _, ref := range reference {
+		got, err := FindTensor(outputs, ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		if len(got.Data) != len(ref.Data) {
+			return nil, errors.Errorf("output %s has %d values, the reference %d", ref.Name, len(got.Data), len(ref.Data))
+		}
+		c, err := compareOutput(ref.Data, got.Data, topK)
+		if err != nil {
+			return nil, errors.Wrapf(err, "output %s", ref.Name)
+		}
+		c.Output = ref.Name
+		c.Violations = tol.violations(c)
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+func compareOutput(ref, got []float32, topK int) (OutputComparison, error) {
+	var c OutputComparison
+	if len(ref) == 0 {
+		return c, nil
+	}
+
+	var maxRef float64
+	for _, v := range ref {
+		maxRef = math.Max(maxRef, math.Abs(float64(v)))
+	}
+	// relative errors of values close to zero are meaningless
+	floor := math.Max(1e-3*maxRef, 1e-12)
+	for ii := range ref {
+		diff := math.Abs(float64(ref[ii]) - float64(got[ii]))
+		c.MaxAbsError = math.Max(c.MaxAbsError, diff)
+		c.MaxRelError = math.Max(c.MaxRelError, diff/math.Max(math.Abs(float64(ref[ii])), floor))
+	}
+
+	p, q := distributionFeatures(ref), distributionFeatures(got)
+	var err error
+	if c.KL, err = p.KullbackLeiblerDivergence(q); err != nil {
+		return c, err
+	}
+	if c.JensenShannon, err = p.JensenShannon(q); err != nil {
+		return c, err
+	}
+	c.Hellinger = hellinger(p.ProbabilitiesFloat64(), q.ProbabilitiesFloat64())
+	if c.Correlation, err = p.Correlation(q); err != nil {
+		return c, err
+	}
+
+	refTop, gotTop := topIndices(ref, topK), topIndices(got, topK)
+	found := 0
+	for _, r := range refTop {
+		for _, g := range gotTop {
+			if r == g {
+				found++
+				break
+			}
+		}
+	}
+	c.TopKAgreement = float64(found) / float64(len(refTop))
+	c.Top1Match = refTop[0] == gotTop[0]
+	return c, nil
+}
+
+func (t Tolerances) violations(c OutputComparison) []string {
+	var res []string
+	// written so that NaN values are flagged as well
+	check := func(name string, value, limit float64, max bool) {
+		if limit == 0 {
+			return
+		}
+		if max && !(value <= limit) {
+			res = append(res, fmt.Sprintf("%s %g > %g", name, value, limit))
+		}
+		if !max && !(value >= limit) {
+			res = append(res, fmt.Sprintf("%s %g < %g", name, value, limit))
+		}
+	}
+	check("max_abs_error", c.MaxAbsError, t.MaxAbsError, true)
+	check("max_rel_error", c.MaxRelError, t.MaxRelError, true)
+	check("kl", c.KL, t.MaxKL, true)
+	check("js", c.JensenShannon, t.MaxJensenShannon, true)
+	check("hellinger", c.Hellinger, t.MaxHellinger, true)
+	check("correlation", c.Correlation, t.MinCorrelation, false)
+	check("topk_agreement", c.TopKAgreement, t.MinTopKAgreement, false)
+	return res
+}
+
+// Output as probability features: outputs that are not a distribution go
+// through a softmax, and zeros are smoothed so that divergences stay finite
+func distributionFeatures(values []float32) dlframework.Features {
+	probs := make([]float32, len(values))
+	var sum float64
+	isDistribution := true
+	for _, v := range values {
+		if v < 0 {
+			isDistribution = false
+		}
+		sum += float64(v)
+	}
+	if isDistribution && math.Abs(sum-1) < 1e-3 {
+		copy(probs, values)
+	} else {
+		softmax(probs, values)
+	}
+
+	const epsilon = 1e-10
+	var total float64
+	for _, v := range probs {
+		total += float64(v) + epsilon
+	}
+	features := make(dlframework.Features, len(probs))
+	for ii, v := range probs {
+		features[ii] = feature.New(feature.Probability(float32((float64(v) + epsilon) / total)))
+	}
+	return features
+}
+
+// Hellinger distance of two distributions. The sqrt(1 - BC) form of
+// dlframework turns NaN when rounding puts BC above one, even for
+// identical outputs, the sum of squares cannot go negative.
+func hellinger(p, q []float64) float64 {
+	var sum float64
+	for ii := range p {
+		d := math.Sqrt(p[ii]) - math.Sqrt(q[ii])
+		sum += d * d
+	}
+	return math.Sqrt(sum / 2)
+}
+
+// Indices of the k largest values, largest first. NaN values rank last,
+// comparing them would leave the order undefined.
+func topIndices(values []float32, k int) []int {
+	idx := make([]int, len(values))
+	for ii := range idx {
+		idx[ii] = ii
+	}
+	sort.SliceStable(idx, func(ii, jj int) bool {
+		a, b := values[idx[ii]], values[idx[jj]]
+		if a != a {
+			return false
+		}
+		return b != b || a > b
+	})
+	if k < len(idx) {
+		idx = idx[:k]
+	}
+	return idx
+}
@@ -0,0 +1,205 @@
+package snpe
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestCompareOutputIdentical(t *testing.T) {
+	ref := []float32{0.1, 2, -1, 0.5}
+	c, err := compareOutput(ref, ref, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxAbsError != 0 || c.MaxRelError != 0 {
+		t.Errorf("errors %v, %v, want 0", c.MaxAbsError, c.MaxRelError)
+	}
+	if !closeTo(c.KL, 0) || !closeTo(c.JensenShannon, 0) || !closeTo(c.Hellinger, 0) {
+		t.Errorf("divergences %v, %v, %v, want 0", c.KL, c.JensenShannon, c.Hellinger)
+	}
+	if !closeTo(c.Correlation, 1) || c.TopKAgreement != 1 || !c.Top1Match {
+		t.Errorf("correlation %v, top-K %v, top-1 %v", c.Correlation, c.TopKAgreement, c.Top1Match)
+	}
+	strict := Tolerances{MaxAbsError: 1e-6, MaxRelError: 1e-6, MaxKL: 1e-6, MaxJensenShannon: 1e-6,
+		MaxHellinger: 1e-3, MinCorrelation: 0.999, MinTopKAgreement: 1}
+	if v := strict.violations(c); len(v) != 0 {
+		t.Errorf("violations %q for identical outputs", v)
+	}
+}
+
+func TestCompareOutputErrors(t *testing.T) {
+	// the relative error of values close to zero is measured against a
+	// thousandth of the largest reference value
+	c, err := compareOutput([]float32{1000, 0, 10}, []float32{1000, 0.5, 11}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !closeTo(c.MaxAbsError, 1) {
+		t.Errorf("MaxAbsError = %v, want 1", c.MaxAbsError)
+	}
+	if !closeTo(c.MaxRelError, 0.5) {
+		t.Errorf("MaxRelError = %v, want 0.5", c.MaxRelError)
+	}
+	if v := (Tolerances{MaxAbsError: 0.1, MaxRelError: 1}).violations(c); !reflect.DeepEqual(v, []string{"max_abs_error 1 > 0.1"}) {
+		t.Errorf("violations = %q", v)
+	}
+}
+
+func TestCompareOutputTopK(t *testing.T) {
+	ref := []float32{0.5, 0.3, 0.15, 0.05, 0}
+	got := []float32{0.5, 0.05, 0.15, 0.3, 0}
+	c, err := compareOutput(ref, got, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the top 3 are {0, 1, 2} and {0, 3, 2}
+	if !closeTo(c.TopKAgreement, 2.0/3) || !c.Top1Match {
+		t.Errorf("top-K %v, top-1 %v, want 2/3 and a match", c.TopKAgreement, c.Top1Match)
+	}
+	v := Tolerances{MinTopKAgreement: 0.9}.violations(c)
+	if len(v) != 1 || !strings.HasPrefix(v[0], "topk_agreement 0.666") {
+		t.Errorf("violations = %q", v)
+	}
+
+	c, _ = compareOutput(ref, []float32{0, 0.3, 0.15, 0.05, 0.5}, 1)
+	if c.Top1Match || c.TopKAgreement != 0 {
+		t.Errorf("top-1 %v, top-K %v for a different top class", c.Top1Match, c.TopKAgreement)
+	}
+}
+
+func TestCompareOutputNaN(t *testing.T) {
+	nan := float32(math.NaN())
+	c, err := compareOutput([]float32{1, 2, 3}, []float32{1, nan, 3}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tol := range []Tolerances{
+		{MaxAbsError: 1},
+		{MaxRelError: 1},
+		{MaxKL: 1},
+		{MaxJensenShannon: 1},
+		{MaxHellinger: 1},
+		{MinCorrelation: 0.5},
+	} {
+		if v := tol.violations(c); len(v) != 1 || !strings.Contains(v[0], "NaN") {
+			t.Errorf("%+v: violations = %q, want the NaN flagged", tol, v)
+		}
+	}
+	// unset tolerances are not checked
+	if v := (Tolerances{}).violations(c); len(v) != 0 {
+		t.Errorf("violations = %q without tolerances", v)
+	}
+	// the NaN ranks last instead of leaving the order undefined
+	if c.TopKAgreement != 0.5 || !c.Top1Match {
+		t.Errorf("top-K %v, top-1 %v, want 0.5 and a match", c.TopKAgreement, c.Top1Match)
+	}
+}
+
+func TestHellinger(t *testing.T) {
+	p := []float64{0.5, 0.5, 0}
+	if got := hellinger(p, p); got != 0 {
+		t.Errorf("hellinger(p, p) = %v, want 0", got)
+	}
+	if got := hellinger(p, []float64{0, 0, 1}); !closeTo(got, 1) {
+		t.Errorf("hellinger of disjoint distributions = %v, want 1", got)
+	}
+	if got := hellinger([]float64{1, 0}, []float64{0.5, 0.5}); !closeTo(got, math.Sqrt(1-math.Sqrt(0.5))) {
+		t.Errorf("hellinger = %v, want %v", got, math.Sqrt(1-math.Sqrt(0.5)))
+	}
+}
+
+func TestDistributionFeatures(t *testing.T) {
+	probs := func(values []float32) []float64 {
+		var res []float64
+		for _, f := range distributionFeatures(values) {
+			res = append(res, float64(f.GetProbability()))
+		}
+		return res
+	}
+	near := func(a, b []float64) bool {
+		for ii := range a {
+			if math.Abs(a[ii]-b[ii]) > 1e-5 {
+				return false
+			}
+		}
+		return len(a) == len(b)
+	}
+
+	// a distribution is used as it is
+	if got, want := probs([]float32{0.7, 0.2, 0.1}), []float64{0.7, 0.2, 0.1}; !near(got, want) {
+		t.Errorf("distribution = %v, want %v", got, want)
+	}
+	// logits, negative values or sums other than one go through a softmax
+	e := math.E
+	softmaxed := []float64{e * e / (e*e + e + 1), e / (e*e + e + 1), 1 / (e*e + e + 1)}
+	if got := probs([]float32{2, 1, 0}); !near(got, softmaxed) {
+		t.Errorf("logits = %v, want %v", got, softmaxed)
+	}
+	if got := probs([]float32{1, 0, -1}); !near(got, softmaxed) {
+		t.Errorf("negative logits = %v, want %v", got, softmaxed)
+	}
+	if got := probs([]float32{0.5, 0.2, 0.1}); near(got, []float64{0.5, 0.2, 0.1}) {
+		t.Errorf("values summing to 0.8 = %v, want a softmax", got)
+	}
+	// zeros are smoothed so that the divergences stay finite
+	for _, p := range probs([]float32{1, 0, 0}) {
+		if p <= 0 {
+			t.Errorf("probability %v, want a smoothed zero", p)
+		}
+	}
+	c, err := compareOutput([]float32{1, 0, 0}, []float32{0, 1, 0}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.IsInf(c.KL, 0) || math.IsNaN(c.KL) || c.KL <= 0 {
+		t.Errorf("KL = %v, want a finite divergence", c.KL)
+	}
+}
+
+func TestTopIndices(t *testing.T) {
+	nan := float32(math.NaN())
+	cases := []struct {
+		values []float32
+		k      int
+		want   []int
+	}{
+		{[]float32{0.1, 0.5, 0.3, 0.5}, 2, []int{1, 3}},
+		{[]float32{0.1, 0.5, 0.3}, 5, []int{1, 2, 0}},
+		{[]float32{nan, 0.1, nan, 0.2}, 3, []int{3, 1, 0}},
+		{[]float32{-1, -2}, 1, []int{0}},
+	}
+	for _, c := range cases {
+		if got := topIndices(c.values, c.k); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("topIndices(%v, %d) = %v, want %v", c.values, c.k, got, c.want)
+		}
+	}
+}
+
+func TestCompareOutputs(t *testing.T) {
+	ref := []Tensor{{Name: "a", Data: []float32{1, 2}}, {Name: "b", Data: []float32{3}}}
+	got := []Tensor{{Name: "b", Data: []float32{3}}, {Name: "a", Data: []float32{1, 4}}}
+	res, err := CompareOutputs(ref, got, 1, Tolerances{MaxAbsError: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// outputs are matched by name, in the order of the reference
+	if len(res) != 2 || res[0].Output != "a" || res[1].Output != "b" {
+		t.Fatalf("comparisons = %+v", res)
+	}
+	if len(res[0].Violations) != 1 || len(res[1].Violations) != 0 {
+		t.Errorf("violations %q and %q, want only a flagged", res[0].Violations, res[1].Violations)
+	}
+
+	if _, err := CompareOutputs(ref, got[:1], 1, Tolerances{}); err == nil {
+		t.Error("expected an error for a missing output")
+	}
+	if _, err := CompareOutputs(ref, []Tensor{{Name: "a", Data: []float32{1}}, got[0]}, 1, Tolerances{}); err == nil {
+		t.Error("expected an error for outputs of different sizes")
+	}
+}
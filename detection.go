@@ -0,0 +1,537 @@
+package snpe
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rai-project/dlframework"
+	"github.com/rai-project/dlframework/framework/feature"
+)
+
+// Format of the region features produced by the detection decoders,
+// the region data is the JSON encoding of a BoundingBox
+const BoundingBoxFormat = "bounding_box"
+
+// BoundingBox in coordinates normalized to [0, 1] of the input image
+type BoundingBox struct {
+	XMin float32 `json:"xmin"`
+	YMin float32 `json:"ymin"`
+	XMax float32 `json:"xmax"`
+	YMax float32 `json:"ymax"`
+}
+
+// Detection is a single detected object
+type Detection struct {
+	Box   BoundingBox `json:"box"`
+	Index int         `json:"index"`
+	Label string      `json:"label"`
+	Score float32     `json:"score"`
+}
+
+// SSDOptions configures the decoding of SSD style detection outputs.
+//
+// Models with the detection post processing in the graph output boxes
+// (ymin, xmin, ymax, xmax), scores and classes per detection, padded with
+// zeros up to a fixed count, and the number of valid detections. Models
+// without it output box encodings relative to anchors and a score per
+// anchor and class, in which case Anchors must be given.
+type SSDOptions struct {
+	// output tensor names, found by name (box, score, class) when empty
+	Boxes   string
+	Scores  string
+	Classes string
+	// number of valid detections per image, found by name (num_detections)
+	// when empty, every detection is valid when the model has no such output
+	NumDetections string
+	// anchors as (ycenter, xcenter, height, width), enables anchor decoding
+	Anchors [][4]float32
+	// box encoding scales, default to 10, 10, 5, 5
+	YScale, XScale, HScale, WScale float32
+	// skip the first class of the scores when decoding anchors
+	Background bool
+	// offset added to the class index before the label lookup
+	LabelOffset int
+
+	ScoreThreshold float32
+	// IoU above which overlapping boxes of the same class are suppressed, defaults to 0.5
+	IOUThreshold float32
+	// keep at most that many detections per image, 0 keeps all
+	MaxDetections int
+	// labels indexed by class, defaults to the label file of the predictor
+	Labels []string
+}
+
+// YOLOLayer is one output grid of a YOLO model
+type YOLOLayer struct {
+	Output string
+	// anchor (width, height) in input pixels for every box of a grid cell
+	Anchors [][2]float32
+}
+
+// YOLOOptions configures the decoding of YOLO style grid outputs of shape
+// [batch, grid height, grid width, anchors * (5 + classes)]
+type YOLOOptions struct {
+	Layers []YOLOLayer
+	// input size of the network in pixels, used to normalize the anchors
+	InputWidth  int
+	InputHeight int
+	// class scores go through a sigmoid (YOLOv3) instead of a softmax (YOLOv2)
+	SigmoidClasses bool
+
+	ScoreThreshold float32
+	// IoU above which overlapping boxes of the same class are suppressed, defaults to 0.5
+	IOUThreshold  float32
+	MaxDetections int
+	Labels        []string
+}
+
+// Decode the detections of an SSD model from the last inference
+func ReadSSDOutput(p *PredictorData, opts SSDOptions) ([]dlframework.Features, error) {
+	tensors, err := ReadOutputTensors(p)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Labels, err = predictorLabels(p, opts.Labels); err != nil {
+		return nil, err
+	}
+	dets, err := DecodeSSD(tensors, opts)
+	if err != nil {
+		return nil, err
+	}
+	return detectionsFeatures(dets), nil
+}
+
+// Decode the detections of a YOLO model from the last inference
+func ReadYOLOOutput(p *PredictorData, opts YOLOOptions) ([]dlframework.Features, error) {
+	tensors, err := ReadOutputTensors(p)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Labels, err = predictorLabels(p, opts.Labels); err != nil {
+		return nil, err
+	}
+	dets, err := DecodeYOLO(tensors, opts)
+	if err != nil {
+		return nil, err
+	}
+	return detectionsFeatures(dets), nil
+}
+
+// Decode SSD outputs into the detections of every image of the batch
+func DecodeSSD(tensors []Tensor, opts SSDOptions) ([][]Detection, error) {
+	boxes, err := findTensor(tensors, opts.Boxes, "box")
+	if err != nil {
+		return nil, err
+	}
+	scores, err := findTensor(tensors, opts.Scores, "score")
+	if err != nil {
+		return nil, err
+	}
+	if boxes.lastDim() != 4 {
+		return nil, errors.Errorf("boxes tensor %s must have 4 coordinates per box, got shape %v", boxes.Name, boxes.Shape)
+	}
+
+	numBoxes := len(boxes.Data) / 4
+	batch := 1
+	if len(boxes.Shape) >= 3 {
+		batch = boxes.Shape[0]
+	}
+	if numBoxes == 0 || batch <= 0 || numBoxes%batch != 0 {
+		return nil, errors.Errorf("boxes tensor %s of shape %v holds no boxes for a batch of %d", boxes.Name, boxes.Shape, batch)
+	}
+	perImage := numBoxes / batch
+
+	res := make([][]Detection, batch)
+	for b := 0; b < batch; b++ {
+		var dets []Detection
+		if len(opts.Anchors) > 0 {
+			if dets, err = decodeSSDAnchors(boxes, scores, b, perImage, opts); err != nil {
+				return nil, err
+			}
+		} else {
+			classes, err := findTensor(tensors, opts.Classes, "class")
+			if err != nil {
+				return nil, err
+			}
+			count, err := numDetections(tensors, opts.NumDetections, b, perImage)
+			if err != nil {
+				return nil, err
+			}
+			if dets, err = decodeSSDBoxes(boxes, scores, classes, b, perImage, count, opts); err != nil {
+				return nil, err
+			}
+		}
+		res[b] = NonMaxSuppression(dets, defaultIOU(opts.IOUThreshold), opts.MaxDetections)
+	}
+	return res, nil
+}
+
+// Number of valid detections of an image, the slots past it are padding
+func numDetections(tensors []Tensor, name string, b, n int) (int, error) {
+	if name == "" && len(matchTensors(tensors, "num_detections")) == 0 {
+		return n, nil
+	}
+	t, err := findTensor(tensors, name, "num_detections")
+	if err != nil {
+		return 0, err
+	}
+	if len(t.Data) <= b {
+		return 0, errors.Errorf("detection count tensor %s has no entry for image %d", t.Name, b)
+	}
+	count := int(t.Data[b])
+	if count < 0 {
+		count = 0
+	}
+	if count > n {
+		count = n
+	}
+	return count, nil
+}
+
+// Boxes already decoded by the detection post processing of the graph,
+// the first count of the n slots of the image are valid
+func decodeSSDBoxes(boxes, scores, classes *Tensor, b, n, count int, opts SSDOptions) ([]Detection, error) {
+	if len(scores.Data) < (b+1)*n || len(classes.Data) < (b+1)*n {
+		return nil, errors.New("scores and classes do not match the number of boxes")
+	}
+	var dets []Detection
+	for ii := b * n; ii < b*n+count; ii++ {
+		score := scores.Data[ii]
+		if score < opts.ScoreThreshold {
+			continue
+		}
+		class := int(classes.Data[ii]) + opts.LabelOffset
+		dets = append(dets, Detection{
+			Box:   clampBox(boxes.Data[4*ii+1], boxes.Data[4*ii], boxes.Data[4*ii+3], boxes.Data[4*ii+2]),
+			Index: class,
+			Label: labelAt(opts.Labels, class),
+			Score: score,
+		})
+	}
+	return dets, nil
+}
+
+// Box encodings relative to anchors with a score per class
+func decodeSSDAnchors(boxes, scores *Tensor, b, n int, opts SSDOptions) ([]Detection, error) {
+	if len(opts.Anchors) != n {
+		return nil, errors.Errorf("got %d anchors for %d boxes", len(opts.Anchors), n)
+	}
+	numBoxes := len(boxes.Data) / 4
+	if numBoxes == 0 || len(scores.Data)%numBoxes != 0 {
+		return nil, errors.New("scores do not match the number of boxes")
+	}
+	numClasses := len(scores.Data) / numBoxes
+	if numClasses == 0 {
+		return nil, errors.New("scores do not match the number of boxes")
+	}
+	yScale, xScale := defaultScale(opts.YScale, 10), defaultScale(opts.XScale, 10)
+	hScale, wScale := defaultScale(opts.HScale, 5), defaultScale(opts.WScale, 5)
+	firstClass := 0
+	if opts.Background {
+		firstClass = 1
+	}
+
+	var dets []Detection
+	for ii := 0; ii < n; ii++ {
+		row := (b*n + ii)
+		enc := boxes.Data[4*row : 4*row+4]
+		a := opts.Anchors[ii]
+		yc := enc[0]/yScale*a[2] + a[0]
+		xc := enc[1]/xScale*a[3] + a[1]
+		h := float32(math.Exp(float64(enc[2]/hScale))) * a[2]
+		w := float32(math.Exp(float64(enc[3]/wScale))) * a[3]
+		box := clampBox(xc-w/2, yc-h/2, xc+w/2, yc+h/2)
+
+		for c := firstClass; c < numClasses; c++ {
+			score := scores.Data[row*numClasses+c]
+			if score < opts.ScoreThreshold {
+				continue
+			}
+			class := c - firstClass + opts.LabelOffset
+			dets = append(dets, Detection{
+				Box:   box,
+				Index: class,
+				Label: labelAt(opts.Labels, class),
+				Score: score,
+			})
+		}
+	}
+	return dets, nil
+}
+
+// Decode YOLO grid outputs into the detections of every image of the batch
+func DecodeYOLO(tensors []Tensor, opts YOLOOptions) ([][]Detection, error) {
+	if len(opts.Layers) == 0 {
+		return nil, errors.New("no YOLO output layers configured")
+	}
+	if opts.InputWidth <= 0 || opts.InputHeight <= 0 {
+		return nil, errors.New("the YOLO input size is required")
+	}
+
+	var res [][]Detection
+	for _, layer := range opts.Layers {
+		t, err := FindTensor(tensors, layer.Output)
+		if err != nil {
+			return nil, err
+		}
+		if len(t.Shape) != 4 {
+			return nil, errors.Errorf("YOLO output %s must be [batch, height, width, channels], got %v", t.Name, t.Shape)
+		}
+		batch, gridH, gridW, channels := t.Shape[0], t.Shape[1], t.Shape[2], t.Shape[3]
+		numAnchors := len(layer.Anchors)
+		if numAnchors == 0 || channels%numAnchors != 0 || channels/numAnchors <= 5 {
+			return nil, errors.Errorf("YOLO output %s with %d channels does not match %d anchors", t.Name, channels, numAnchors)
+		}
+		numClasses := channels/numAnchors - 5
+		if len(t.Data) < batch*gridH*gridW*channels {
+			return nil, errors.Errorf("YOLO output %s has %d values for shape %v", t.Name, len(t.Data), t.Shape)
+		}
+		for len(res) < batch {
+			res = append(res, nil)
+		}
+
+		probs := make([]float32, numClasses)
+		for b := 0; b < batch; b++ {
+			for row := 0; row < gridH; row++ {
+				for col := 0; col < gridW; col++ {
+					cell := t.Data[((b*gridH+row)*gridW+col)*channels:]
+					for a := 0; a < numAnchors; a++ {
+						v := cell[a*(5+numClasses) : (a+1)*(5+numClasses)]
+						objectness := sigmoid(v[4])
+						if objectness < opts.ScoreThreshold {
+							continue
+						}
+						xc := (float32(col) + sigmoid(v[0])) / float32(gridW)
+						yc := (float32(row) + sigmoid(v[1])) / float32(gridH)
+						w := float32(math.Exp(float64(v[2]))) * layer.Anchors[a][0] / float32(opts.InputWidth)
+						h := float32(math.Exp(float64(v[3]))) * layer.Anchors[a][1] / float32(opts.InputHeight)
+
+						if opts.SigmoidClasses {
+							for c := range probs {
+								probs[c] = sigmoid(v[5+c])
+							}
+						} else {
+							softmax(probs, v[5:])
+						}
+						for c, p := range probs {
+							score := objectness * p
+							if score < opts.ScoreThreshold {
+								continue
+							}
+							res[b] = append(res[b], Detection{
+								Box:   clampBox(xc-w/2, yc-h/2, xc+w/2, yc+h/2),
+								Index: c,
+								Label: labelAt(opts.Labels, c),
+								Score: score,
+							})
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for b := range res {
+		res[b] = NonMaxSuppression(res[b], defaultIOU(opts.IOUThreshold), opts.MaxDetections)
+	}
+	return res, nil
+}
+
+// Class aware non-maximum suppression: a detection is dropped when it
+// overlaps a higher scoring detection of the same class by more than the
+// IoU threshold. The result is sorted by decreasing score.
+func NonMaxSuppression(dets []Detection, iouThreshold float32, maxDetections int) []Detection {
+	sorted := append([]Detection(nil), dets...)
+	sort.SliceStable(sorted, func(ii, jj int) bool {
+		return sorted[ii].Score > sorted[jj].Score
+	})
+
+	kept := []Detection{}
+	for _, d := range sorted {
+		if maxDetections > 0 && len(kept) >= maxDetections {
+			break
+		}
+		suppressed := false
+		for _, k := range kept {
+			if k.Index == d.Index && IoU(k.Box, d.Box) > iouThreshold {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// Intersection over union of two boxes
+func IoU(a, b BoundingBox) float32 {
+	iw := min32(a.XMax, b.XMax) - max32(a.XMin, b.XMin)
+	ih := min32(a.YMax, b.YMax) - max32(a.YMin, b.YMin)
+	if iw <= 0 || ih <= 0 {
+		return 0
+	}
+	inter := iw * ih
+	union := (a.XMax-a.XMin)*(a.YMax-a.YMin) + (b.XMax-b.XMin)*(b.YMax-b.YMin) - inter
+	if union <= 0 {
+		return 0
+	}
+	return inter / union
+}
+
+// Convert detections into region features, one list per image
+func detectionsFeatures(dets [][]Detection) []dlframework.Features {
+	features := make([]dlframework.Features, len(dets))
+	for ii, ds := range dets {
+		features[ii] = make(dlframework.Features, len(ds))
+		for jj, d := range ds {
+			features[ii][jj] = DetectionFeature(d)
+		}
+	}
+	return features
+}
+
+// Region feature of a detection, the label and class index are kept in the metadata
+func DetectionFeature(d Detection) *dlframework.Feature {
+	data, _ := json.Marshal(d.Box)
+	return feature.New(
+		feature.Region(&dlframework.Region{
+			Data:   data,
+			Format: BoundingBoxFormat,
+		}),
+		feature.Probability(d.Score),
+		feature.AppendMetadata("label", d.Label),
+		feature.AppendMetadata("index", strconv.Itoa(d.Index)),
+	)
+}
+
+// Find a tensor by name, or by the hint when no name is given, see matchTensors
+func findTensor(tensors []Tensor, name, hint string) (*Tensor, error) {
+	if name != "" {
+		return FindTensor(tensors, name)
+	}
+	switch matches := matchTensors(tensors, hint); len(matches) {
+	case 0:
+		return nil, errors.Errorf("no output tensor with %s in its name", hint)
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, len(matches))
+		for ii, t := range matches {
+			names[ii] = t.Name
+		}
+		return nil, errors.Errorf("several output tensors match %s: %s, give the name", hint, strings.Join(names, ", "))
+	}
+}
+
+// Tensors whose name matches the hint the closest. The last path segment
+// of the name, without the output index, is compared: names equal to the
+// hint (or its plural) come first, then names ending with _hint, and only
+// then names containing the hint anywhere. TF SSD exports such as
+// MultiClassNonMaxSuppression_scores contain "class" but end with "scores".
+func matchTensors(tensors []Tensor, hint string) []*Tensor {
+	forms := []string{hint, hint + "s", hint + "es"}
+	var exact, suffix, contains []*Tensor
+	for ii := range tensors {
+		t := &tensors[ii]
+		name := strings.ToLower(t.Name)
+		segment := name[strings.LastIndex(name, "/")+1:]
+		if colon := strings.LastIndex(segment, ":"); colon >= 0 {
+			segment = segment[:colon]
+		}
+		switch {
+		case hasForm(segment, forms, ""):
+			exact = append(exact, t)
+		case hasForm(segment, forms, "_"):
+			suffix = append(suffix, t)
+		case strings.Contains(name, hint):
+			contains = append(contains, t)
+		}
+	}
+	switch {
+	case len(exact) > 0:
+		return exact
+	case len(suffix) > 0:
+		return suffix
+	}
+	return contains
+}
+
+// Whether the segment is one of the forms, or ends with the separator followed by one
+func hasForm(segment string, forms []string, sep string) bool {
+	for _, f := range forms {
+		if sep == "" && segment == f || sep != "" && strings.HasSuffix(segment, sep+f) {
+			return true
+		}
+	}
+	return false
+}
+
+func clampBox(xmin, ymin, xmax, ymax float32) BoundingBox {
+	return BoundingBox{
+		XMin: clamp01(xmin),
+		YMin: clamp01(ymin),
+		XMax: clamp01(xmax),
+		YMax: clamp01(ymax),
+	}
+}
+
+func defaultIOU(v float32) float32 {
+	if v <= 0 {
+		return 0.5
+	}
+	return v
+}
+
+func defaultScale(v, def float32) float32 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+func sigmoid(x float32) float32 {
+	return float32(1 / (1 + math.Exp(-float64(x))))
+}
+
+// Softmax of in written to out
+func softmax(out, in []float32) {
+	max := in[0]
+	for _, v := range in[:len(out)] {
+		if v > max {
+			max = v
+		}
+	}
+	var sum float64
+	for ii := range out {
+		e := math.Exp(float64(in[ii] - max))
+		out[ii] = float32(e)
+		sum += e
+	}
+	for ii := range out {
+		out[ii] = float32(float64(out[ii]) / sum)
+	}
+}
+
+func clamp01(v float32) float32 {
+	return max32(0, min32(1, v))
+}
+
+func min32(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
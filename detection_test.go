@@ -0,0 +1,226 @@
+package snpe
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-4
+}
+
+func nearBox(a, b BoundingBox) bool {
+	return near(a.XMin, b.XMin) && near(a.YMin, b.YMin) && near(a.XMax, b.XMax) && near(a.YMax, b.YMax)
+}
+
+// Outputs of a TF SSD export with the post processing in the graph, the
+// second image has a single valid detection
+func ssdTensors() []Tensor {
+	prefix := "Postprocessor/BatchMultiClassNonMaxSuppression"
+	return []Tensor{
+		{Name: prefix + "_scores", Shape: []int{2, 3}, Data: []float32{0.9, 0.8, 0.1, 0.7, 0.6, 0}},
+		{Name: prefix + "_classes", Shape: []int{2, 3}, Data: []float32{1, 2, 3, 4, 4, 0}},
+		{Name: prefix + "_boxes", Shape: []int{2, 3, 4}, Data: []float32{
+			// ymin, xmin, ymax, xmax
+			0.1, 0.2, 0.3, 0.4,
+			0.5, 0.5, 0.9, 0.9,
+			0, 0, 1, 1,
+			0.1, 0.1, 0.2, 0.2,
+			0.6, 0.6, 0.8, 0.8,
+			0, 0, 0, 0,
+		}},
+		{Name: "num_detections:0", Shape: []int{2}, Data: []float32{3, 1}},
+	}
+}
+
+func TestFindTensor(t *testing.T) {
+	tensors := ssdTensors()
+	cases := []struct {
+		hint string
+		want string
+	}{
+		// the scores name contains "class" as well
+		{"class", "Postprocessor/BatchMultiClassNonMaxSuppression_classes"},
+		{"score", "Postprocessor/BatchMultiClassNonMaxSuppression_scores"},
+		{"box", "Postprocessor/BatchMultiClassNonMaxSuppression_boxes"},
+		{"num_detections", "num_detections:0"},
+	}
+	for _, c := range cases {
+		got, err := findTensor(tensors, "", c.hint)
+		if err != nil {
+			t.Errorf("findTensor(%q): %v", c.hint, err)
+			continue
+		}
+		if got.Name != c.want {
+			t.Errorf("findTensor(%q) = %s, want %s", c.hint, got.Name, c.want)
+		}
+	}
+
+	// names containing the hint are used when nothing ends with it
+	pose := []Tensor{{Name: "MobilenetV1/heatmap_2/BiasAdd"}, {Name: "MobilenetV1/offset_2/BiasAdd"}}
+	if got, err := findTensor(pose, "", "heatmap"); err != nil || got.Name != pose[0].Name {
+		t.Errorf("findTensor(heatmap) = %v, %v", got, err)
+	}
+
+	ambiguous := []Tensor{{Name: "a/detection_scores"}, {Name: "b/detection_scores"}}
+	if _, err := findTensor(ambiguous, "", "score"); err == nil {
+		t.Error("expected an error for two matching tensors")
+	}
+	if got, err := findTensor(ambiguous, "b/detection_scores", "score"); err != nil || got != &ambiguous[1] {
+		t.Errorf("findTensor by name = %v, %v", got, err)
+	}
+	if _, err := findTensor(pose, "", "score"); err == nil {
+		t.Error("expected an error for a missing tensor")
+	}
+}
+
+func TestDecodeSSDBoxes(t *testing.T) {
+	res, err := DecodeSSD(ssdTensors(), SSDOptions{
+		ScoreThreshold: 0.5,
+		Labels:         []string{"background", "person", "bicycle", "car", "dog"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("got detections for %d images, want 2", len(res))
+	}
+
+	first := res[0]
+	if len(first) != 2 {
+		t.Fatalf("image 0: %d detections, want 2 above the threshold", len(first))
+	}
+	if d := first[0]; d.Index != 1 || d.Label != "person" || !near(d.Score, 0.9) ||
+		!nearBox(d.Box, BoundingBox{XMin: 0.2, YMin: 0.1, XMax: 0.4, YMax: 0.3}) {
+		t.Errorf("image 0 detection 0 = %+v", d)
+	}
+	if d := first[1]; d.Index != 2 || d.Label != "bicycle" {
+		t.Errorf("image 0 detection 1 = %+v", d)
+	}
+
+	// the padding past num_detections is ignored
+	if len(res[1]) != 1 || res[1][0].Index != 4 || !near(res[1][0].Score, 0.7) {
+		t.Errorf("image 1 = %+v, want the single valid detection", res[1])
+	}
+}
+
+func TestDecodeSSDAnchors(t *testing.T) {
+	// one image, two anchors and three classes including the background
+	tensors := []Tensor{
+		{Name: "raw_outputs/box_encodings", Shape: []int{1, 2, 4}, Data: []float32{
+			0, 0, 0, 0,
+			// moves the center down by a tenth of the anchor and doubles the height
+			1, 0, 5 * float32(math.Ln2), 0,
+		}},
+		{Name: "raw_outputs/class_scores", Shape: []int{1, 2, 3}, Data: []float32{
+			0.9, 0.8, 0.1,
+			0.1, 0.2, 0.7,
+		}},
+	}
+	res, err := DecodeSSD(tensors, SSDOptions{
+		Anchors:        [][4]float32{{0.5, 0.5, 0.2, 0.2}, {0.5, 0.5, 0.2, 0.2}},
+		Background:     true,
+		ScoreThreshold: 0.5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dets := res[0]
+	if len(dets) != 2 {
+		t.Fatalf("%d detections, want 2", len(dets))
+	}
+	// the background score of the first anchor is skipped
+	if d := dets[0]; d.Index != 0 || !near(d.Score, 0.8) || !nearBox(d.Box, BoundingBox{XMin: 0.4, YMin: 0.4, XMax: 0.6, YMax: 0.6}) {
+		t.Errorf("detection 0 = %+v", d)
+	}
+	if d := dets[1]; d.Index != 1 || !near(d.Score, 0.7) || !nearBox(d.Box, BoundingBox{XMin: 0.4, YMin: 0.32, XMax: 0.6, YMax: 0.72}) {
+		t.Errorf("detection 1 = %+v", d)
+	}
+
+	if _, err := DecodeSSD(tensors, SSDOptions{Anchors: [][4]float32{{0.5, 0.5, 0.2, 0.2}}}); err == nil {
+		t.Error("expected an error for fewer anchors than boxes")
+	}
+}
+
+func TestDecodeYOLO(t *testing.T) {
+	// a 1x1 grid with one anchor and two classes
+	t0 := Tensor{Name: "yolo", Shape: []int{1, 1, 1, 7}, Data: []float32{0, 0, 0, 0, 10, 0, float32(math.Log(3))}}
+	res, err := DecodeYOLO([]Tensor{t0}, YOLOOptions{
+		Layers:         []YOLOLayer{{Output: "yolo", Anchors: [][2]float32{{50, 20}}}},
+		InputWidth:     100,
+		InputHeight:    100,
+		ScoreThreshold: 0.5,
+		Labels:         []string{"cat", "dog"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || len(res[0]) != 1 {
+		t.Fatalf("detections = %+v, want one", res)
+	}
+	// softmax of the classes gives 0.25 and 0.75
+	d := res[0][0]
+	if d.Index != 1 || d.Label != "dog" || !near(d.Score, 0.75*sigmoid(10)) {
+		t.Errorf("detection = %+v", d)
+	}
+	if !nearBox(d.Box, BoundingBox{XMin: 0.25, YMin: 0.4, XMax: 0.75, YMax: 0.6}) {
+		t.Errorf("box = %+v", d.Box)
+	}
+
+	t0.Data = t0.Data[:6]
+	if _, err := DecodeYOLO([]Tensor{t0}, YOLOOptions{
+		Layers:     []YOLOLayer{{Output: "yolo", Anchors: [][2]float32{{50, 20}}}},
+		InputWidth: 100, InputHeight: 100,
+	}); err == nil {
+		t.Error("expected an error for a truncated output")
+	}
+}
+
+func TestNonMaxSuppression(t *testing.T) {
+	box := BoundingBox{XMin: 0, YMin: 0, XMax: 1, YMax: 1}
+	shifted := BoundingBox{XMin: 0.1, YMin: 0, XMax: 1, YMax: 1}
+	apart := BoundingBox{XMin: 2, YMin: 2, XMax: 3, YMax: 3}
+	dets := []Detection{
+		{Box: shifted, Index: 0, Score: 0.6},
+		{Box: box, Index: 0, Score: 0.9},
+		// overlaps the best box but is of another class
+		{Box: box, Index: 1, Score: 0.8},
+		{Box: apart, Index: 0, Score: 0.5},
+	}
+
+	kept := NonMaxSuppression(dets, 0.5, 0)
+	if len(kept) != 3 {
+		t.Fatalf("kept %+v, want 3 detections", kept)
+	}
+	for ii, want := range []float32{0.9, 0.8, 0.5} {
+		if kept[ii].Score != want {
+			t.Errorf("detection %d score %v, want %v", ii, kept[ii].Score, want)
+		}
+	}
+
+	if kept := NonMaxSuppression(dets, 0.5, 2); len(kept) != 2 {
+		t.Errorf("kept %d detections, want the maximum of 2", len(kept))
+	}
+	// a threshold above the overlap keeps the shifted box
+	if kept := NonMaxSuppression(dets, 0.95, 0); len(kept) != 4 {
+		t.Errorf("kept %d detections, want 4", len(kept))
+	}
+}
+
+func TestIoU(t *testing.T) {
+	a := BoundingBox{XMin: 0, YMin: 0, XMax: 2, YMax: 2}
+	cases := []struct {
+		b    BoundingBox
+		want float32
+	}{
+		{a, 1},
+		{BoundingBox{XMin: 1, YMin: 0, XMax: 3, YMax: 2}, 1.0 / 3},
+		{BoundingBox{XMin: 2, YMin: 2, XMax: 3, YMax: 3}, 0},
+		{BoundingBox{XMin: 0.5, YMin: 0.5, XMax: 1.5, YMax: 1.5}, 0.25},
+	}
+	for _, c := range cases {
+		if got := IoU(a, c.b); !near(got, c.want) {
+			t.Errorf("IoU(%+v) = %v, want %v", c.b, got, c.want)
+		}
+	}
+}
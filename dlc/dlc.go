@@ -0,0 +1,204 @@
+// Package dlc reads SNPE deep learning container (.dlc) files without the SNPE SDK.
+//
+// A DLC is a ZIP archive of records. The network definition lives in the
+// "model" record, the weights in "model.params" and the converter details in
+// the "dlc.metadata" text record. Init caching adds further records to the
+// archive.
+//
+// The layer table inside the "model" record is an undocumented
+// serialization and is not decoded yet: the reader reports no layers and no
+// per-tensor quantization encodings. The network inputs and outputs and the
+// quantizer settings are recovered from the converter and quantizer command
+// lines stored in the metadata record instead.
+package dlc
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Names of the well known records
+const (
+	ModelRecord    = "model"
+	ParamsRecord   = "model.params"
+	MetadataRecord = "dlc.metadata"
+)
+
+// Record is a single entry of the container
+type Record struct {
+	Name           string `json:"name"`
+	Size           uint64 `json:"size"`
+	CompressedSize uint64 `json:"compressed_size"`
+	CRC32          uint32 `json:"crc32"`
+	Compressed     bool   `json:"compressed"`
+}
+
+// Container is an opened DLC file
+type Container struct {
+	Path     string            `json:"path,omitempty"`
+	Records  []Record          `json:"records"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	closer io.Closer
+	files  map[string]*zip.File
+}
+
+// Open a DLC file and read its record table and metadata
+func Open(path string) (*Container, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", path)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "failed to stat %s", path)
+	}
+	c, err := NewReader(f, st.Size())
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "invalid DLC %s", path)
+	}
+	c.Path = path
+	c.closer = f
+	return c, nil
+}
+
+// Read a DLC from an in memory or otherwise seekable source
+func NewReader(r io.ReaderAt, size int64) (*Container, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "not a DLC container")
+	}
+
+	c := &Container{
+		files: map[string]*zip.File{},
+	}
+	for _, f := range zr.File {
+		c.files[f.Name] = f
+		c.Records = append(c.Records, Record{
+			Name:           f.Name,
+			Size:           f.UncompressedSize64,
+			CompressedSize: f.CompressedSize64,
+			CRC32:          f.CRC32,
+			Compressed:     f.Method != zip.Store,
+		})
+	}
+	sort.Slice(c.Records, func(ii, jj int) bool {
+		return c.Records[ii].Name < c.Records[jj].Name
+	})
+
+	if _, ok := c.files[ModelRecord]; !ok {
+		return nil, errors.Errorf("missing %s record", ModelRecord)
+	}
+
+	if _, ok := c.files[MetadataRecord]; ok {
+		data, err := c.ReadRecord(MetadataRecord)
+		if err != nil {
+			return nil, err
+		}
+		c.Metadata = parseMetadata(data)
+	}
+
+	return c, nil
+}
+
+// Release the underlying file
+func (c *Container) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
+
+// Whether the container has a record with the given name
+func (c *Container) HasRecord(name string) bool {
+	_, ok := c.files[name]
+	return ok
+}
+
+// Read the full content of a record, the record checksum is verified
+func (c *Container) ReadRecord(name string) ([]byte, error) {
+	f, ok := c.files[name]
+	if !ok {
+		return nil, errors.Errorf("record %s not found", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open record %s", name)
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read record %s", name)
+	}
+	return data, nil
+}
+
+// Read every record to check that none of them is truncated or corrupted
+func (c *Container) Verify() error {
+	for _, r := range c.Records {
+		f := c.files[r.Name]
+		rc, err := f.Open()
+		if err != nil {
+			return errors.Wrapf(err, "failed to open record %s", r.Name)
+		}
+		_, err = io.Copy(ioutil.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return errors.Wrapf(err, "record %s is corrupted", r.Name)
+		}
+	}
+	return nil
+}
+
+// Whether the container carries init cache records generated by SNPE
+func (c *Container) HasInitCache() bool {
+	for _, r := range c.Records {
+		switch r.Name {
+		case ModelRecord, ParamsRecord, MetadataRecord:
+			continue
+		}
+		if strings.Contains(strings.ToLower(r.Name), "cache") {
+			return true
+		}
+	}
+	return false
+}
+
+// Check that a file is a readable DLC container
+func Validate(path string) error {
+	c, err := Open(path)
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// The metadata record is made of key=value lines
+func parseMetadata(data []byte) map[string]string {
+	md := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			md[line] = ""
+			continue
+		}
+		md[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return md
+}
@@ -0,0 +1,287 @@
+package dlc
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TensorInfo describes a network input or output
+type TensorInfo struct {
+	Name string `json:"name"`
+	// dimensions as given to the converter, empty when they come from the source model
+	Shape []int `json:"shape,omitempty"`
+	// input type (image, default, opaque) and encoding (bgr, rgb, ...) given to the converter
+	Type     string `json:"type,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// QuantizationInfo describes how snpe-dlc-quantize processed the model
+type QuantizationInfo struct {
+	Command            string `json:"command"`
+	WeightsBitwidth    int    `json:"weights_bitwidth"`
+	ActivationBitwidth int    `json:"activation_bitwidth"`
+	BiasBitwidth       int    `json:"bias_bitwidth"`
+	EnhancedQuantizer  bool   `json:"enhanced_quantizer"`
+}
+
+// ModelInfo is the model description recovered from the container metadata
+type ModelInfo struct {
+	Converter        string            `json:"converter,omitempty"`
+	ConverterCommand string            `json:"converter_command,omitempty"`
+	ConverterVersion string            `json:"converter_version,omitempty"`
+	Copyright        string            `json:"copyright,omitempty"`
+	Inputs           []TensorInfo      `json:"inputs,omitempty"`
+	Outputs          []TensorInfo      `json:"outputs,omitempty"`
+	Quantization     *QuantizationInfo `json:"quantization,omitempty"`
+}
+
+// The default bit width used by snpe-dlc-quantize
+const defaultBitwidth = 8
+
+// Converter flags taking an input name followed by a value
+var pairFlags = map[string]bool{
+	"input_dim":      true,
+	"input_type":     true,
+	"input_encoding": true,
+}
+
+var (
+	reprPairRe   = regexp.MustCompile(`\[\s*'([^']*)'\s*,\s*'([^']*)'\s*\]`)
+	reprStringRe = regexp.MustCompile(`'([^']*)'`)
+)
+
+// Decode the model description from the converter and quantizer metadata
+func (c *Container) Info() ModelInfo {
+	info := ModelInfo{
+		ConverterCommand: c.metadata("converter-command"),
+		ConverterVersion: c.metadata("converter-version"),
+		Copyright:        c.metadata("model-copyright"),
+	}
+
+	args := parseCommand(info.ConverterCommand)
+	if len(args.positional) > 0 {
+		info.Converter = args.positional[0]
+	}
+
+	types := args.pairs("input_type")
+	encodings := args.pairs("input_encoding")
+	for _, dim := range args.pairs("input_dim") {
+		info.Inputs = append(info.Inputs, TensorInfo{
+			Name:     dim[0],
+			Shape:    parseShape(dim[1]),
+			Type:     lookupPair(types, dim[0]),
+			Encoding: lookupPair(encodings, dim[0]),
+		})
+	}
+	for _, name := range args.list("out_node", "out_name", "output_node") {
+		info.Outputs = append(info.Outputs, TensorInfo{Name: name})
+	}
+
+	if cmd := c.metadata("quantizer-command"); cmd != "" {
+		q := parseCommand(cmd)
+		info.Quantization = &QuantizationInfo{
+			Command:            cmd,
+			WeightsBitwidth:    q.int("weights_bitwidth", q.int("bitwidth", defaultBitwidth)),
+			ActivationBitwidth: q.int("act_bitwidth", q.int("bitwidth", defaultBitwidth)),
+			BiasBitwidth:       q.int("bias_bitwidth", defaultBitwidth),
+			EnhancedQuantizer:  q.bool("use_enhanced_quantizer"),
+		}
+	}
+
+	return info
+}
+
+// Metadata keys are written with dashes or underscores depending on the SNPE release
+func (c *Container) metadata(key string) string {
+	if v, ok := c.Metadata[key]; ok {
+		return v
+	}
+	return c.Metadata[strings.Replace(key, "-", "_", -1)]
+}
+
+// Converter commands are recorded either as the command line
+// (--input_dim data 1,224,224,3) or as the parsed arguments
+// (input_dim=[['data', '1,224,224,3']])
+type commandArgs struct {
+	positional []string
+	flags      map[string][][]string
+	repr       map[string]string
+}
+
+func parseCommand(cmd string) commandArgs {
+	args := commandArgs{
+		flags: map[string][][]string{},
+		repr:  map[string]string{},
+	}
+	tokens := splitCommand(cmd)
+	for ii := 0; ii < len(tokens); ii++ {
+		tok := tokens[ii]
+		switch {
+		case strings.HasPrefix(tok, "-"):
+			name := normalizeFlag(strings.TrimLeft(tok, "-"))
+			var values []string
+			if eq := strings.Index(name, "="); eq >= 0 {
+				values = append(values, name[eq+1:])
+				name = name[:eq]
+			}
+			for len(values) == 0 || pairFlags[name] && len(values) < 2 {
+				if ii+1 >= len(tokens) || strings.HasPrefix(tokens[ii+1], "-") {
+					break
+				}
+				ii++
+				values = append(values, tokens[ii])
+			}
+			args.flags[name] = append(args.flags[name], values)
+		case strings.Contains(tok, "="):
+			kv := strings.SplitN(tok, "=", 2)
+			args.repr[normalizeFlag(kv[0])] = kv[1]
+		default:
+			args.positional = append(args.positional, tok)
+		}
+	}
+	return args
+}
+
+// Pairs of values such as input name and dimensions
+func (a commandArgs) pairs(name string) [][2]string {
+	var res [][2]string
+	for _, values := range a.flags[name] {
+		if len(values) == 2 {
+			res = append(res, [2]string{values[0], values[1]})
+		}
+	}
+	for _, m := range reprPairRe.FindAllStringSubmatch(a.repr[name], -1) {
+		res = append(res, [2]string{m[1], m[2]})
+	}
+	return res
+}
+
+// Values of a repeated argument, trying each of the given names
+func (a commandArgs) list(names ...string) []string {
+	var res []string
+	for _, name := range names {
+		for _, values := range a.flags[name] {
+			res = append(res, values...)
+		}
+		for _, m := range reprStringRe.FindAllStringSubmatch(a.repr[name], -1) {
+			res = append(res, m[1])
+		}
+	}
+	return res
+}
+
+func (a commandArgs) value(name string) (string, bool) {
+	if values, ok := a.flags[name]; ok {
+		if len(values) == 0 || len(values[0]) == 0 {
+			return "", true
+		}
+		return values[0][0], true
+	}
+	v, ok := a.repr[name]
+	return strings.Trim(v, "'\""), ok
+}
+
+func (a commandArgs) int(name string, def int) int {
+	v, ok := a.value(name)
+	if !ok {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return i
+}
+
+func (a commandArgs) bool(name string) bool {
+	v, ok := a.value(name)
+	if !ok {
+		return false
+	}
+	return v == "" || strings.EqualFold(v, "true")
+}
+
+func normalizeFlag(name string) string {
+	name = strings.Replace(name, "-", "_", -1)
+	switch name {
+	case "d":
+		return "input_dim"
+	case "i":
+		return "input_network"
+	case "o":
+		return "output_path"
+	}
+	return name
+}
+
+func lookupPair(pairs [][2]string, key string) string {
+	for _, p := range pairs {
+		if p[0] == key {
+			return p[1]
+		}
+	}
+	return ""
+}
+
+// Split a command line on white space outside of quotes and brackets
+func splitCommand(cmd string) []string {
+	var (
+		tokens []string
+		cur    strings.Builder
+		quote  rune
+		depth  int
+	)
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, r := range cmd {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+				if depth > 0 {
+					cur.WriteRune(r)
+				}
+				continue
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			if depth > 0 {
+				cur.WriteRune(r)
+			}
+			continue
+		case r == '[':
+			depth++
+		case r == ']':
+			if depth > 0 {
+				depth--
+			}
+		case (r == ' ' || r == '\t' || r == '\n') && depth == 0:
+			flush()
+			continue
+		}
+		cur.WriteRune(r)
+	}
+	flush()
+	return tokens
+}
+
+func parseShape(s string) []int {
+	var shape []int
+	for _, d := range strings.Split(s, ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		i, err := strconv.Atoi(d)
+		if err != nil {
+			return nil
+		}
+		shape = append(shape, i)
+	}
+	return shape
+}
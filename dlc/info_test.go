@@ -0,0 +1,207 @@
+package dlc
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// Metadata records as written by the SNPE 1.x converters and quantizer
+const (
+	tfMetadata = `converter-command=snpe-tensorflow-to-dlc adjust_nms_features_dims=False allow_unconsumed_nodes=False copyright_file=None debug=-1 enable_strict_validation=False input_dim=[['input', '1,224,224,3']] input_encoding=[['input', 'bgr']] input_network=mobilenet_v1_1.0_224_frozen.pb input_type=[['input', 'image']] model_version=None out_node=['MobilenetV1/Predictions/Reshape_1'] output_path=mobilenet_v1.dlc show_unconsumed_nodes=False udl=None
+converter-version=1.32.0.555
+model-copyright=N/A
+quantizer-command=snpe-dlc-quantize help=false version=false verbose=false quiet=false silent=false debug=[] debug1=[] debug2=[] debug3=[] log-mask=[] log-file=[] log-dir=[] log-file-include-hostname=false input_dlc=[mobilenet_v1.dlc] input_list=[raw_list.txt] no_weight_quantization=false output_dlc=[mobilenet_v1_quantized.dlc] enable_hta=false use_enhanced_quantizer=true optimizations=[] override_params=false bitwidth=8 bias_bitwidth=32 act_bitwidth=16
+`
+	onnxMetadata = `converter_command=snpe-onnx-to-dlc --input_network resnet50.onnx --input_dim data 1,3,224,224 --input_dim mask 1,224 --input_encoding data rgb --out_node resnetv17_dense0_fwd --output_path resnet50.dlc
+converter_version=1.32.0.555
+`
+)
+
+func newTestContainer(t *testing.T, records map[string]string) *Container {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range records {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestInfo(t *testing.T) {
+	cases := []struct {
+		name     string
+		metadata string
+		want     ModelInfo
+	}{
+		{
+			name:     "parsed arguments",
+			metadata: tfMetadata,
+			want: ModelInfo{
+				Converter:        "snpe-tensorflow-to-dlc",
+				ConverterVersion: "1.32.0.555",
+				Copyright:        "N/A",
+				Inputs: []TensorInfo{
+					{Name: "input", Shape: []int{1, 224, 224, 3}, Type: "image", Encoding: "bgr"},
+				},
+				Outputs: []TensorInfo{{Name: "MobilenetV1/Predictions/Reshape_1"}},
+				Quantization: &QuantizationInfo{
+					WeightsBitwidth:    8,
+					ActivationBitwidth: 16,
+					BiasBitwidth:       32,
+					EnhancedQuantizer:  true,
+				},
+			},
+		},
+		{
+			name:     "command line",
+			metadata: onnxMetadata,
+			want: ModelInfo{
+				Converter:        "snpe-onnx-to-dlc",
+				ConverterVersion: "1.32.0.555",
+				Inputs: []TensorInfo{
+					{Name: "data", Shape: []int{1, 3, 224, 224}, Encoding: "rgb"},
+					{Name: "mask", Shape: []int{1, 224}},
+				},
+				Outputs: []TensorInfo{{Name: "resnetv17_dense0_fwd"}},
+			},
+		},
+		{
+			name: "no metadata",
+		},
+	}
+	for _, c := range cases {
+		records := map[string]string{ModelRecord: "", ParamsRecord: ""}
+		if c.metadata != "" {
+			records[MetadataRecord] = c.metadata
+		}
+		info := newTestContainer(t, records).Info()
+		// the commands are returned verbatim
+		info.ConverterCommand = ""
+		if info.Quantization != nil {
+			info.Quantization.Command = ""
+		}
+		if !reflect.DeepEqual(info, c.want) {
+			t.Errorf("%s: Info() = %+v, want %+v", c.name, info, c.want)
+		}
+	}
+}
+
+func TestNewReaderRequiresModel(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.Create(ParamsRecord)
+	zw.Close()
+	if _, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err == nil {
+		t.Error("expected an error for a container without a model record")
+	}
+	if _, err := NewReader(bytes.NewReader([]byte("not a zip")), 9); err == nil {
+		t.Error("expected an error for a file that is not a container")
+	}
+}
+
+func TestRecords(t *testing.T) {
+	c := newTestContainer(t, map[string]string{
+		ModelRecord:                "model",
+		ParamsRecord:               "weights",
+		MetadataRecord:             onnxMetadata,
+		"gpu_init_cache.0.records": "cache",
+	})
+	var names []string
+	for _, r := range c.Records {
+		names = append(names, r.Name)
+	}
+	if want := []string{MetadataRecord, "gpu_init_cache.0.records", ModelRecord, ParamsRecord}; !reflect.DeepEqual(names, want) {
+		t.Errorf("records = %q, want %q", names, want)
+	}
+	if !c.HasInitCache() {
+		t.Error("init cache record not detected")
+	}
+	if data, err := c.ReadRecord(ParamsRecord); err != nil || string(data) != "weights" {
+		t.Errorf("ReadRecord = %q, %v", data, err)
+	}
+	if err := c.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	cases := []struct {
+		cmd  string
+		want []string
+	}{
+		{"snpe-onnx-to-dlc --input_network model.onnx", []string{"snpe-onnx-to-dlc", "--input_network", "model.onnx"}},
+		{"  a \t b\n", []string{"a", "b"}},
+		{`input_dim=[['input', '1,224,224,3']] out_node=['a b']`, []string{`input_dim=[['input', '1,224,224,3']]`, `out_node=['a b']`}},
+		{`--out_node "with space" 'single quoted'`, []string{"--out_node", "with space", "single quoted"}},
+		{"nested=[[1, [2, 3]], 4] next", []string{"nested=[[1, [2, 3]], 4]", "next"}},
+		{"", nil},
+	}
+	for _, c := range cases {
+		if got := splitCommand(c.cmd); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", c.cmd, got, c.want)
+		}
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	args := parseCommand("snpe-caffe-to-dlc -d data 1,3,227,227 --out_node=prob --out_node fc7 --enable_strict_validation --input_type data image")
+	if want := []string{"snpe-caffe-to-dlc"}; !reflect.DeepEqual(args.positional, want) {
+		t.Errorf("positional = %q, want %q", args.positional, want)
+	}
+	if got, want := args.pairs("input_dim"), [][2]string{{"data", "1,3,227,227"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("input_dim = %q, want %q", got, want)
+	}
+	if got, want := args.list("out_node"), []string{"prob", "fc7"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("out_node = %q, want %q", got, want)
+	}
+	if !args.bool("enable_strict_validation") {
+		t.Error("flag without a value is not set")
+	}
+	if args.bool("allow_unconsumed_nodes") {
+		t.Error("missing flag is set")
+	}
+	if got, want := args.pairs("input_type"), [][2]string{{"data", "image"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("input_type = %q, want %q", got, want)
+	}
+
+	q := parseCommand("snpe-dlc-quantize input_dlc=[model.dlc] bitwidth=4 use_enhanced_quantizer=False")
+	if got := q.int("bitwidth", defaultBitwidth); got != 4 {
+		t.Errorf("bitwidth = %d, want 4", got)
+	}
+	if got := q.int("act_bitwidth", defaultBitwidth); got != defaultBitwidth {
+		t.Errorf("act_bitwidth = %d, want the default", got)
+	}
+	if q.bool("use_enhanced_quantizer") {
+		t.Error("use_enhanced_quantizer=False is set")
+	}
+}
+
+func TestParseShape(t *testing.T) {
+	cases := []struct {
+		s    string
+		want []int
+	}{
+		{"1,224,224,3", []int{1, 224, 224, 3}},
+		{" 1, 3 ,224 ", []int{1, 3, 224}},
+		{"1,,3", []int{1, 3}},
+		{"1,x,3", nil},
+		{"", nil},
+	}
+	for _, c := range cases {
+		if got := parseShape(c.s); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseShape(%q) = %v, want %v", c.s, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package snpe
+
+import (
+	"github.com/abhiutd/snpe-predictor/embedding"
+	"github.com/pkg/errors"
+)
+
+// Run inference and return the L2 normalized embedding of every input of
+// the batch, read from the output of the named layer (see OutputLayers)
+func PredictEmbeddings(p *PredictorData, data []byte, output string) ([][]float32, error) {
+	tensors, err := predictTensors(p, data, false)
+	if err != nil {
+		return nil, err
+	}
+	return embeddings(tensors, output)
+}
+
+// L2 normalized embeddings of the last inference, output is the tensor
+// name and defaults to the first output
+func ReadEmbeddings(p *PredictorData, output string) ([][]float32, error) {
+	tensors, err := ReadOutputTensors(p)
+	if err != nil {
+		return nil, err
+	}
+	return embeddings(tensors, output)
+}
+
+func embeddings(tensors []Tensor, output string) ([][]float32, error) {
+	t := &tensors[0]
+	if output != "" {
+		var err error
+		if t, err = FindTensor(tensors, output); err != nil {
+			return nil, err
+		}
+	}
+
+	// everything but the batch dimension is flattened, which
+	// covers pooling layers of shape [batch, 1, 1, channels]
+	batch := 1
+	if len(t.Shape) >= 2 {
+		batch = t.Shape[0]
+	}
+	if batch <= 0 || len(t.Data)%batch != 0 || len(t.Data) == 0 {
+		return nil, errors.Errorf("output %s of shape %v cannot be split into %d embeddings", t.Name, t.Shape, batch)
+	}
+	dim := len(t.Data) / batch
+	res := make([][]float32, batch)
+	for ii := range res {
+		res[ii] = embedding.Normalize(t.Data[ii*dim : (ii+1)*dim])
+	}
+	return res, nil
+}
@@ -0,0 +1,337 @@
+// Package embedding keeps embedding vectors in an in-memory index searched
+// by cosine similarity or inner product, with persistence to disk.
+package embedding
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Metric scores the similarity of two vectors, higher is closer
+type Metric uint32
+
+const (
+	// Cosine similarity, vectors are L2 normalized when added
+	Cosine Metric = iota
+	// Inner product of the vectors as given
+	InnerProduct
+)
+
+func (m Metric) String() string {
+	switch m {
+	case Cosine:
+		return "cosine"
+	case InnerProduct:
+		return "inner_product"
+	}
+	return "unknown"
+}
+
+// Header of the index files
+const indexMagic = "SNPEEMB1"
+
+// Limits that keep a corrupt index file from allocating gigabytes
+const (
+	// longest id in bytes
+	MaxIDLength = 4096
+	// largest vector dimension
+	MaxDim = 1 << 16
+)
+
+// Result is an indexed vector matching a query
+type Result struct {
+	ID    string  `json:"id"`
+	Score float32 `json:"score"`
+}
+
+// Index is a flat index searched exhaustively, which is exact and fast
+// enough for the galleries of on-device search
+type Index struct {
+	dim    int
+	metric Metric
+
+	mu      sync.RWMutex
+	ids     []string
+	vectors []float32
+	rows    map[string]int
+}
+
+// Create empty index of vectors of the given dimension
+func NewIndex(dim int, metric Metric) (*Index, error) {
+	if dim <= 0 || dim > MaxDim {
+		return nil, errors.Errorf("invalid embedding dimension %d", dim)
+	}
+	if metric != Cosine && metric != InnerProduct {
+		return nil, errors.Errorf("unknown metric %d", metric)
+	}
+	return &Index{
+		dim:    dim,
+		metric: metric,
+		rows:   map[string]int{},
+	}, nil
+}
+
+// Dimension of the indexed vectors
+func (x *Index) Dim() int {
+	return x.dim
+}
+
+// Similarity the index is searched by
+func (x *Index) Metric() Metric {
+	return x.metric
+}
+
+// Number of indexed vectors
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.ids)
+}
+
+// Add a vector, replacing the vector previously added under the same id
+func (x *Index) Add(id string, vector []float32) error {
+	if len(vector) != x.dim {
+		return errors.Errorf("vector of dimension %d added to an index of dimension %d", len(vector), x.dim)
+	}
+	if len(id) > MaxIDLength {
+		return errors.Errorf("id of %d bytes is longer than %d bytes", len(id), MaxIDLength)
+	}
+	v := vector
+	if x.metric == Cosine {
+		v = Normalize(vector)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if row, ok := x.rows[id]; ok {
+		copy(x.vectors[row*x.dim:], v)
+		return nil
+	}
+	x.rows[id] = len(x.ids)
+	x.ids = append(x.ids, id)
+	x.vectors = append(x.vectors, v...)
+	return nil
+}
+
+// Remove a vector, returns whether it was indexed
+func (x *Index) Remove(id string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	row, ok := x.rows[id]
+	if !ok {
+		return false
+	}
+	// move the last vector into the hole
+	last := len(x.ids) - 1
+	if row != last {
+		x.ids[row] = x.ids[last]
+		copy(x.vectors[row*x.dim:(row+1)*x.dim], x.vectors[last*x.dim:])
+		x.rows[x.ids[row]] = row
+	}
+	x.ids = x.ids[:last]
+	x.vectors = x.vectors[:last*x.dim]
+	delete(x.rows, id)
+	return true
+}
+
+// Vector indexed under an id
+func (x *Index) Get(id string) ([]float32, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	row, ok := x.rows[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]float32(nil), x.vectors[row*x.dim:(row+1)*x.dim]...), true
+}
+
+// The k vectors most similar to the query, best first
+func (x *Index) Search(query []float32, k int) ([]Result, error) {
+	if len(query) != x.dim {
+		return nil, errors.Errorf("query of dimension %d for an index of dimension %d", len(query), x.dim)
+	}
+	if k <= 0 {
+		return nil, nil
+	}
+	q := query
+	if x.metric == Cosine {
+		q = Normalize(query)
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	// min heap of the best results so far
+	h := &resultHeap{}
+	for row, id := range x.ids {
+		score := dot(q, x.vectors[row*x.dim:(row+1)*x.dim])
+		if h.Len() < k {
+			heap.Push(h, Result{ID: id, Score: score})
+		} else if score > (*h)[0].Score {
+			(*h)[0] = Result{ID: id, Score: score}
+			heap.Fix(h, 0)
+		}
+	}
+	res := make([]Result, h.Len())
+	for ii := len(res) - 1; ii >= 0; ii-- {
+		res[ii] = heap.Pop(h).(Result)
+	}
+	return res, nil
+}
+
+// Write the index to a file, replacing it atomically
+func (x *Index) Save(path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", path)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err := x.Write(w); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "failed to write %s", path)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "failed to write %s", path)
+	}
+	return errors.Wrapf(os.Rename(tmp.Name(), path), "failed to write %s", path)
+}
+
+// Serialize the index: a header with the metric, dimension and count,
+// then the length prefixed id and the vector of every entry, little endian
+func (x *Index) Write(w io.Writer) error {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if _, err := io.WriteString(w, indexMagic); err != nil {
+		return errors.Wrap(err, "failed to write index")
+	}
+	header := []uint32{uint32(x.metric), uint32(x.dim), uint32(len(x.ids))}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return errors.Wrap(err, "failed to write index")
+	}
+	for row, id := range x.ids {
+		if err := binary.Write(w, binary.LittleEndian, uint32(len(id))); err != nil {
+			return errors.Wrap(err, "failed to write index")
+		}
+		if _, err := io.WriteString(w, id); err != nil {
+			return errors.Wrap(err, "failed to write index")
+		}
+		if err := binary.Write(w, binary.LittleEndian, x.vectors[row*x.dim:(row+1)*x.dim]); err != nil {
+			return errors.Wrap(err, "failed to write index")
+		}
+	}
+	return nil
+}
+
+// Read an index file written by Save
+func LoadIndex(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer f.Close()
+	x, err := ReadIndex(bufio.NewReader(f))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+	return x, nil
+}
+
+// Deserialize an index written by Write
+func ReadIndex(r io.Reader) (*Index, error) {
+	magic := make([]byte, len(indexMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != indexMagic {
+		return nil, errors.New("not an embedding index")
+	}
+	var header [3]uint32
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, errors.Wrap(err, "truncated index header")
+	}
+	if header[1] > MaxDim {
+		return nil, errors.Errorf("invalid embedding dimension %d", header[1])
+	}
+	x, err := NewIndex(int(header[1]), Metric(header[0]))
+	if err != nil {
+		return nil, err
+	}
+	count := int(header[2])
+	vector := make([]float32, x.dim)
+	for ii := 0; ii < count; ii++ {
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, errors.Wrapf(err, "truncated index entry %d", ii)
+		}
+		if n > MaxIDLength {
+			return nil, errors.Errorf("index entry %d has an id of %d bytes", ii, n)
+		}
+		id := make([]byte, n)
+		if _, err := io.ReadFull(r, id); err != nil {
+			return nil, errors.Wrapf(err, "truncated index entry %d", ii)
+		}
+		if _, ok := x.rows[string(id)]; ok {
+			return nil, errors.Errorf("index entry %d duplicates the id %q", ii, id)
+		}
+		if err := binary.Read(r, binary.LittleEndian, vector); err != nil {
+			return nil, errors.Wrapf(err, "truncated index entry %d", ii)
+		}
+		// vectors are stored as they were indexed
+		x.rows[string(id)] = len(x.ids)
+		x.ids = append(x.ids, string(id))
+		x.vectors = append(x.vectors, vector...)
+	}
+	return x, nil
+}
+
+// Copy of the vector scaled to unit L2 norm, zero vectors are returned as is
+func Normalize(v []float32) []float32 {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	res := make([]float32, len(v))
+	if sum == 0 {
+		copy(res, v)
+		return res
+	}
+	inv := 1 / math.Sqrt(sum)
+	for ii, f := range v {
+		res[ii] = float32(float64(f) * inv)
+	}
+	return res
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for ii := range a {
+		sum += a[ii] * b[ii]
+	}
+	return sum
+}
+
+type resultHeap []Result
+
+func (h resultHeap) Len() int            { return len(h) }
+func (h resultHeap) Less(i, j int) bool  { return h[i].Score < h[j].Score }
+func (h resultHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x interface{}) { *h = append(*h, x.(Result)) }
+func (h *resultHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
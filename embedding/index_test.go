@@ -0,0 +1,94 @@
+package embedding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndexSearch(t *testing.T) {
+	x, err := NewIndex(2, Cosine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.Add("right", []float32{1, 0})
+	x.Add("up", []float32{0, 3})
+	x.Add("diagonal", []float32{2, 2})
+	res, err := x.Search([]float32{1, 0.1}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0].ID != "right" || res[1].ID != "diagonal" {
+		t.Errorf("Search = %v", res)
+	}
+	if !x.Remove("right") || x.Len() != 2 {
+		t.Errorf("Remove left %d vectors", x.Len())
+	}
+	if v, ok := x.Get("up"); !ok || !reflect.DeepEqual(v, []float32{0, 1}) {
+		t.Errorf("Get after Remove = %v, %v", v, ok)
+	}
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	x, _ := NewIndex(3, InnerProduct)
+	x.Add("a", []float32{1, 2, 3})
+	x.Add("b", []float32{-1, 0, 0.5})
+	var buf bytes.Buffer
+	if err := x.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	y, err := ReadIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if y.Dim() != 3 || y.Metric() != InnerProduct || y.Len() != 2 {
+		t.Fatalf("read index of dimension %d, metric %s, %d vectors", y.Dim(), y.Metric(), y.Len())
+	}
+	for _, id := range []string{"a", "b"} {
+		want, _ := x.Get(id)
+		if got, ok := y.Get(id); !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("Get(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+// Index file with the given header followed by entries of a one value vector
+func rawIndex(dim, count uint32, ids ...string) *bytes.Buffer {
+	var buf bytes.Buffer
+	buf.WriteString(indexMagic)
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(Cosine), dim, count})
+	for _, id := range ids {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(id)))
+		buf.WriteString(id)
+		binary.Write(&buf, binary.LittleEndian, make([]float32, dim))
+	}
+	return &buf
+}
+
+func TestReadIndexRejectsCorruptFiles(t *testing.T) {
+	cases := map[string]*bytes.Buffer{
+		"huge dimension": rawIndex(1<<31, 0),
+		"zero dimension": rawIndex(0, 0),
+		"duplicate id":   rawIndex(1, 2, "a", "a"),
+		"truncated":      rawIndex(1, 3, "a", "b"),
+	}
+	// an id length past the limit must fail before the id is allocated
+	huge := rawIndex(1, 1)
+	binary.Write(huge, binary.LittleEndian, uint32(1<<31))
+	cases["huge id"] = huge
+
+	for name, buf := range cases {
+		if _, err := ReadIndex(buf); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAddRejectsLongIDs(t *testing.T) {
+	x, _ := NewIndex(1, Cosine)
+	if err := x.Add(strings.Repeat("x", MaxIDLength+1), []float32{1}); err == nil {
+		t.Error("expected an error for an id longer than MaxIDLength")
+	}
+}
@@ -0,0 +1,333 @@
+package snpe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Name of the manifest of a golden set
+const goldenManifest = "golden.json"
+
+// GoldenInput is an input recorded in a golden set
+type GoldenInput struct {
+	Name string
+	Data []byte
+}
+
+// GoldenTensor is a recorded output, stored as little endian float32
+type GoldenTensor struct {
+	Name  string `json:"name"`
+	Shape []int  `json:"shape"`
+	File  string `json:"file"`
+}
+
+// GoldenCase is an input along with the outputs it produced
+type GoldenCase struct {
+	Name    string         `json:"name"`
+	Input   string         `json:"input"`
+	Outputs []GoldenTensor `json:"outputs"`
+}
+
+// GoldenSet describes the outputs recorded for a model, kept in the
+// golden.json file of the set directory next to the input and output files
+type GoldenSet struct {
+	Model       string       `json:"model"`
+	ModelSHA256 string       `json:"model_sha256"`
+	Runtime     string       `json:"runtime"`
+	Mode        int          `json:"mode"`
+	SNPEVersion string       `json:"snpe_version"`
+	Quantize    bool         `json:"quantize"`
+	Created     time.Time    `json:"created"`
+	Cases       []GoldenCase `json:"cases"`
+}
+
+// GoldenCaseResult is the comparison of a case with its recorded outputs
+type GoldenCaseResult struct {
+	Name    string             `json:"name"`
+	Outputs []OutputComparison `json:"outputs"`
+	// recording and run disagree on the outputs themselves
+	Errors    []string `json:"errors,omitempty"`
+	Regressed bool     `json:"regressed"`
+}
+
+// GoldenReport is the result of verifying a golden set
+type GoldenReport struct {
+	Set *GoldenSet `json:"set"`
+	// model hash, runtime and SNPE version of the verification run
+	ModelSHA256 string `json:"model_sha256"`
+	Runtime     string `json:"runtime"`
+	SNPEVersion string `json:"snpe_version"`
+	// metadata that differs from the recording, informational only
+	Changes     []string           `json:"changes,omitempty"`
+	Cases       []GoldenCaseResult `json:"cases"`
+	Regressions int                `json:"regressions"`
+}
+
+// Run the inputs and record them along with every output tensor and the
+// model, runtime and SNPE version into the set directory
+func RecordGolden(dir string, p *PredictorData, inputs []GoldenInput, quantize bool) (*GoldenSet, error) {
+	if len(inputs) == 0 {
+		return nil, errors.New("no inputs to record")
+	}
+	modelHash, err := fileSHA256(p.model)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "inputs"), 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s", dir)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "outputs"), 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s", dir)
+	}
+
+	mode := effectiveMode(p.options.mode)
+	set := &GoldenSet{
+		Model:       filepath.Base(p.model),
+		ModelSHA256: modelHash,
+		Runtime:     RuntimeName(mode),
+		Mode:        mode,
+		SNPEVersion: LibraryVersion(),
+		Quantize:    quantize,
+		Created:     time.Now().UTC(),
+	}
+	seen := map[string]bool{}
+	for ii, in := range inputs {
+		name := goldenFileName(in.Name)
+		if name == "" {
+			name = fmt.Sprintf("input%d", ii)
+		}
+		if seen[name] {
+			return nil, errors.Errorf("duplicate input name %s", name)
+		}
+		seen[name] = true
+
+		outputs, err := predictTensors(p, in.Data, quantize)
+		if err != nil {
+			return nil, errors.Wrapf(err, "input %s", name)
+		}
+		c := GoldenCase{
+			Name:  name,
+			Input: filepath.Join("inputs", name+".raw"),
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, c.Input), in.Data, 0644); err != nil {
+			return nil, errors.Wrapf(err, "failed to record input %s", name)
+		}
+		for _, t := range outputs {
+			gt := GoldenTensor{
+				Name:  t.Name,
+				Shape: t.Shape,
+				File:  filepath.Join("outputs", name+"-"+goldenFileName(t.Name)+".raw"),
+			}
+			if err := writeFloats(filepath.Join(dir, gt.File), t.Data); err != nil {
+				return nil, errors.Wrapf(err, "failed to record output %s of %s", t.Name, name)
+			}
+			c.Outputs = append(c.Outputs, gt)
+		}
+		set.Cases = append(set.Cases, c)
+	}
+
+	buf, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode the golden set")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, goldenManifest), buf, 0644); err != nil {
+		return nil, errors.Wrapf(err, "failed to write %s", goldenManifest)
+	}
+	return set, nil
+}
+
+// Read the manifest of a golden set
+func LoadGolden(dir string) (*GoldenSet, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, goldenManifest))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read golden set %s", dir)
+	}
+	var set GoldenSet
+	if err := json.Unmarshal(buf, &set); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse golden set %s", dir)
+	}
+	return &set, nil
+}
+
+// Re-run the recorded inputs and compare the outputs with the recording
+func VerifyGolden(dir string, p *PredictorData, tol Tolerances, topK int) (*GoldenReport, error) {
+	set, err := LoadGolden(dir)
+	if err != nil {
+		return nil, err
+	}
+	if topK <= 0 {
+		topK = 5
+	}
+	modelHash, err := fileSHA256(p.model)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &GoldenReport{
+		Set:         set,
+		ModelSHA256: modelHash,
+		Runtime:     RuntimeName(effectiveMode(p.options.mode)),
+		SNPEVersion: LibraryVersion(),
+	}
+	if report.ModelSHA256 != set.ModelSHA256 {
+		report.Changes = append(report.Changes, fmt.Sprintf("model %s -> %s", shortHash(set.ModelSHA256), shortHash(report.ModelSHA256)))
+	}
+	if report.Runtime != set.Runtime {
+		report.Changes = append(report.Changes, fmt.Sprintf("runtime %s -> %s", set.Runtime, report.Runtime))
+	}
+	if report.SNPEVersion != set.SNPEVersion {
+		report.Changes = append(report.Changes, fmt.Sprintf("SNPE %s -> %s", set.SNPEVersion, report.SNPEVersion))
+	}
+
+	for _, c := range set.Cases {
+		res := GoldenCaseResult{Name: c.Name}
+		data, err := ioutil.ReadFile(filepath.Join(dir, c.Input))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read input %s", c.Name)
+		}
+		outputs, err := predictTensors(p, data, set.Quantize)
+		if err != nil {
+			res.Errors = append(res.Errors, err.Error())
+		}
+
+		var recorded []Tensor
+		for _, gt := range c.Outputs {
+			values, err := readFloats(filepath.Join(dir, gt.File))
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read output %s of %s", gt.Name, c.Name)
+			}
+			got, err := FindTensor(outputs, gt.Name)
+			switch {
+			case err != nil:
+				res.Errors = append(res.Errors, fmt.Sprintf("output %s is missing", gt.Name))
+			case !sameShape(got.Shape, gt.Shape):
+				res.Errors = append(res.Errors, fmt.Sprintf("output %s changed shape %v -> %v", gt.Name, gt.Shape, got.Shape))
+			default:
+				recorded = append(recorded, Tensor{Name: gt.Name, Shape: gt.Shape, Data: values})
+			}
+		}
+		for _, t := range outputs {
+			if _, err := FindTensor(recordedTensors(c), t.Name); err != nil {
+				res.Errors = append(res.Errors, fmt.Sprintf("new output %s", t.Name))
+			}
+		}
+
+		if len(recorded) > 0 {
+			comparisons, err := CompareOutputs(recorded, outputs, topK, tol)
+			if err != nil {
+				res.Errors = append(res.Errors, err.Error())
+			}
+			res.Outputs = comparisons
+		}
+		res.Regressed = len(res.Errors) > 0
+		for _, o := range res.Outputs {
+			if len(o.Violations) > 0 {
+				res.Regressed = true
+			}
+		}
+		if res.Regressed {
+			report.Regressions++
+		}
+		report.Cases = append(report.Cases, res)
+	}
+	return report, nil
+}
+
+// Human readable report
+func (r *GoldenReport) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "golden set: %s recorded %s on %s with SNPE %s\n",
+		r.Set.Model, r.Set.Created.Format(time.RFC3339), r.Set.Runtime, r.Set.SNPEVersion)
+	for _, c := range r.Changes {
+		fmt.Fprintf(&b, "changed: %s\n", c)
+	}
+	for _, c := range r.Cases {
+		status := "ok"
+		if c.Regressed {
+			status = "REGRESSED"
+		}
+		fmt.Fprintf(&b, "%-9s %s\n", status, c.Name)
+		for _, e := range c.Errors {
+			fmt.Fprintf(&b, "          %s\n", e)
+		}
+		for _, o := range c.Outputs {
+			fmt.Fprintf(&b, "          %s: max abs %.3g, max rel %.3g, kl %.3g, top-k %.2f",
+				o.Output, o.MaxAbsError, o.MaxRelError, o.KL, o.TopKAgreement)
+			if len(o.Violations) > 0 {
+				fmt.Fprintf(&b, " (%s)", strings.Join(o.Violations, ", "))
+			}
+			fmt.Fprintln(&b)
+		}
+	}
+	fmt.Fprintf(&b, "%d of %d inputs regressed\n", r.Regressions, len(r.Cases))
+	n, err := w.Write(b.Bytes())
+	return int64(n), err
+}
+
+func recordedTensors(c GoldenCase) []Tensor {
+	res := make([]Tensor, len(c.Outputs))
+	for ii, gt := range c.Outputs {
+		res[ii] = Tensor{Name: gt.Name}
+	}
+	return res
+}
+
+func writeFloats(path string, data []float32) error {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, data); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func readFloats(path string) ([]float32, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf)%4 != 0 {
+		return nil, errors.Errorf("%s is not a float32 tensor", path)
+	}
+	data := make([]float32, len(buf)/4)
+	err = binary.Read(bytes.NewReader(buf), binary.LittleEndian, data)
+	return data, err
+}
+
+func sameShape(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for ii := range a {
+		if a[ii] != b[ii] {
+			return false
+		}
+	}
+	return true
+}
+
+// Tensor and input names as file names
+func goldenFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
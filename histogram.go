@@ -0,0 +1,69 @@
+package snpe
+
+import (
+	"sort"
+	"sync"
+)
+
+// Histogram counts observations into fixed cumulative buckets
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramSnapshot is a point in time copy of a Histogram
+type HistogramSnapshot struct {
+	// upper bounds of the buckets, the implicit last bucket is +Inf
+	Bounds []float64 `json:"bounds"`
+	// cumulative number of observations less than or equal to each bound
+	Counts []uint64 `json:"counts"`
+	Sum    float64  `json:"sum"`
+	Count  uint64   `json:"count"`
+}
+
+// Create new histogram with the given bucket upper bounds
+func NewHistogram(bounds ...float64) *Histogram {
+	bs := append([]float64(nil), bounds...)
+	sort.Float64s(bs)
+	return &Histogram{
+		bounds: bs,
+		counts: make([]uint64, len(bs)),
+	}
+}
+
+// Record a single observation
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ii, b := range h.bounds {
+		if v <= b {
+			h.counts[ii]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Copy the current state of the histogram
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return HistogramSnapshot{
+		Bounds: append([]float64(nil), h.bounds...),
+		Counts: append([]uint64(nil), h.counts...),
+		Sum:    h.sum,
+		Count:  h.count,
+	}
+}
+
+// Buckets 1, 2, 4, ... up to and including max
+func exponentialBounds(max int) []float64 {
+	var bounds []float64
+	for ii := 1; ii < max; ii *= 2 {
+		bounds = append(bounds, float64(ii))
+	}
+	return append(bounds, float64(max))
+}
@@ -7,12 +7,21 @@ import (
 )
 
 var (
-	log *logrus.Entry
+	// replaced by the configured logger once config.Init has run
+	log = logrus.WithField("pkg", "go-snpe")
 )
 
 func init() {
 	config.AfterInit(func() {
-		log = logger.New().WithField("pkg", "go-snpe")
+		l := logger.New()
+		Config.Wait()
+		if level, err := logrus.ParseLevel(Config.LogLevel); err == nil {
+			l.Level = level
+		}
+		log = l.WithField("pkg", "go-snpe")
+		if level, err := logrus.ParseLevel(Config.NativeLogLevel); err == nil {
+			SetNativeLogLevel(level)
+		}
 	})
 
 }
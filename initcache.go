@@ -0,0 +1,174 @@
+package snpe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Unknwon/com"
+	"github.com/pkg/errors"
+)
+
+// Directory created next to the model when no cache directory is configured
+const initCacheDirName = "snpe_init_cache"
+
+// The init cache of a model is a copy of its DLC with the cache records
+// generated by SNPE added to it. Every model gets its own directory in the
+// cache and the file name is keyed by the model hash, the runtime and the
+// SNPE version, so any change to those yields a different file.
+type initCacheEntry struct {
+	dir  string
+	file string
+	// key parts caches of other runtimes and output layers share
+	modelHash string
+	version   string
+	// unique file SNPE writes the cache to, see tempFile
+	temp string
+}
+
+// Locate the init cache file of a model for the given options
+func newInitCacheEntry(model string, opts *Options) (*initCacheEntry, error) {
+	absModel, err := filepath.Abs(model)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve model path %s", model)
+	}
+
+	root := opts.cacheDir
+	if root == "" {
+		root = filepath.Join(filepath.Dir(absModel), initCacheDirName)
+	}
+
+	modelHash, err := fileSHA256(absModel)
+	if err != nil {
+		return nil, err
+	}
+	pathHash := sha256.Sum256([]byte(absModel))
+
+	dir := filepath.Join(root, fmt.Sprintf("%s-%x", filepath.Base(absModel), pathHash[:4]))
+	version := cacheKeySanitize(LibraryVersion())
+	key := strings.Join([]string{
+		modelHash[:16],
+		strings.ToLower(RuntimeName(effectiveMode(opts.mode))),
+		version,
+	}, "-")
+	// the cached network depends on the layers it outputs
+	if len(opts.outputLayers) > 0 {
+		layersHash := sha256.Sum256([]byte(strings.Join(opts.outputLayers, "\x00")))
+		key += fmt.Sprintf("-%x", layersHash[:4])
+	}
+
+	return &initCacheEntry{
+		dir:       dir,
+		file:      filepath.Join(dir, key+".dlc"),
+		modelHash: modelHash[:16],
+		version:   version,
+	}, nil
+}
+
+// Whether a cache was persisted for the current key
+func (e *initCacheEntry) exists() bool {
+	return com.IsFile(e.file)
+}
+
+// Where SNPE writes the cache before it is moved into place. Every load
+// gets its own file, so concurrent loads of the same model do not write
+// to the same path.
+func (e *initCacheEntry) tempFile() (string, error) {
+	if e.temp == "" {
+		f, err := ioutil.TempFile(e.dir, filepath.Base(e.file)+".*.tmp")
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to create init cache file in %s", e.dir)
+		}
+		f.Close()
+		e.temp = f.Name()
+	}
+	return e.temp, nil
+}
+
+// Make sure the cache directory exists and drop the caches generated for
+// a different model content or SNPE version. Caches of other runtimes and
+// output layers of the same model stay, as do caches being generated.
+func (e *initCacheEntry) prepare() error {
+	if err := os.MkdirAll(e.dir, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create init cache directory %s", e.dir)
+	}
+	files, err := filepath.Glob(filepath.Join(e.dir, "*.dlc"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if !e.stale(f) {
+			continue
+		}
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to remove stale init cache %s", f)
+		}
+	}
+	return nil
+}
+
+// Whether a cache file of the directory was keyed by another model hash or
+// SNPE version, files not named after a key are left alone
+func (e *initCacheEntry) stale(file string) bool {
+	parts := strings.Split(strings.TrimSuffix(filepath.Base(file), ".dlc"), "-")
+	if len(parts) < 3 {
+		return false
+	}
+	return parts[0] != e.modelHash || parts[2] != e.version
+}
+
+// Move a freshly generated cache into place
+func (e *initCacheEntry) commit() error {
+	if info, err := os.Stat(e.temp); err != nil || info.Size() == 0 {
+		e.discard()
+		return errors.Errorf("init cache %s was not generated", e.file)
+	}
+	if err := os.Rename(e.temp, e.file); err != nil {
+		e.discard()
+		return err
+	}
+	e.temp = ""
+	return nil
+}
+
+// Drop the cache, used when it can no longer be loaded
+func (e *initCacheEntry) remove() {
+	os.Remove(e.file)
+	e.discard()
+}
+
+// Drop the cache being generated, if any
+func (e *initCacheEntry) discard() {
+	if e.temp != "" {
+		os.Remove(e.temp)
+		e.temp = ""
+	}
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "failed to hash %s", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func cacheKeySanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,92 @@
+package snpe
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testInitCacheEntry(dir string) *initCacheEntry {
+	return &initCacheEntry{
+		dir:       dir,
+		file:      filepath.Join(dir, "0123456789abcdef-cpu-1.32.0.dlc"),
+		modelHash: "0123456789abcdef",
+		version:   "1.32.0",
+	}
+}
+
+func TestInitCacheConcurrentLoads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "initcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// two loads of the same model and settings
+	a, b := testInitCacheEntry(dir), testInitCacheEntry(dir)
+	tempA, err := a.tempFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tempB, err := b.tempFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tempA == tempB {
+		t.Fatalf("both loads write the init cache to %s", tempA)
+	}
+	if again, _ := a.tempFile(); again != tempA {
+		t.Errorf("tempFile changed from %s to %s within a load", tempA, again)
+	}
+	if err := a.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(tempB); err != nil {
+		t.Errorf("prepare removed a cache being generated: %v", err)
+	}
+
+	if err := ioutil.WriteFile(tempA, []byte("cache a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(tempB, []byte("cache b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.commit(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(a.file); err != nil || string(data) != "cache b" {
+		t.Errorf("cache = %q, %v, want the last committed one", data, err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	if len(files) != 0 {
+		t.Errorf("temporary files left behind: %v", files)
+	}
+}
+
+func TestInitCacheNotGenerated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "initcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e := testInitCacheEntry(dir)
+	temp, err := e.tempFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SNPE did not save anything to the file
+	if err := e.commit(); err == nil {
+		t.Error("expected an error for an empty init cache")
+	}
+	if e.exists() {
+		t.Error("empty init cache was moved into place")
+	}
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Errorf("empty init cache %s was not removed", temp)
+	}
+}
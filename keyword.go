@@ -0,0 +1,243 @@
+package snpe
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abhiutd/snpe-predictor/audio"
+	"github.com/pkg/errors"
+	"github.com/rai-project/dlframework"
+	"github.com/rai-project/dlframework/framework/feature"
+)
+
+// KeywordOptions configures keyword spotting over streaming audio
+type KeywordOptions struct {
+	// length of audio the model classifies, defaults to one second
+	Window time.Duration
+	// step between two inferences, defaults to 250ms
+	Stride time.Duration
+	// the model outputs logits rather than probabilities
+	Softmax bool
+	// number of inferences the scores are averaged over, defaults to 3
+	Smoothing int
+	// averaged score a keyword needs to be detected
+	Threshold float32
+	// a keyword is not reported again within that time, defaults to one second
+	Suppression time.Duration
+	// labels indexed by class, defaults to the label file of the predictor
+	Labels []string
+	// labels that are never reported, defaults to _silence_ and _unknown_
+	Ignore []string
+}
+
+// KeywordDetection is a keyword heard in the audio stream
+type KeywordDetection struct {
+	Keyword string
+	Index   int
+	Score   float32
+	// offset of the end of the detection window from the start of the stream
+	Time time.Duration
+}
+
+// KeywordSpotter slides a keyword spotting model over continuous audio
+type KeywordSpotter struct {
+	p        *PredictorData
+	frontend *audio.Frontend
+	opts     KeywordOptions
+	frames   int
+
+	mu sync.Mutex
+	// samples not consumed yet, buffer[0] is sample number offset of the stream
+	buffer   []float32
+	offset   int64
+	next     int64
+	history  [][]float32
+	reported map[int]int64
+}
+
+// Create keyword spotter, the number of frames the model takes is read
+// from its input shape [batch, frames, features(, 1)]
+func NewKeywordSpotter(p *PredictorData, frontend *audio.Frontend, opts KeywordOptions) (*KeywordSpotter, error) {
+	shape := InputShape(p)
+	if len(shape) < 3 {
+		return nil, errors.Errorf("expected an input of shape [batch, frames, features], got %v", shape)
+	}
+	frames, features := shape[1], shape[2]
+	if features != frontend.NumFeatures() {
+		return nil, errors.Errorf("the model takes %d features per frame but the front end computes %d", features, frontend.NumFeatures())
+	}
+	if shapeSize(shape) != frames*features {
+		return nil, errors.Errorf("input shape %v does not hold a single clip", shape)
+	}
+
+	if opts.Window <= 0 {
+		opts.Window = time.Second
+	}
+	if opts.Stride <= 0 {
+		opts.Stride = 250 * time.Millisecond
+	}
+	if opts.Smoothing <= 0 {
+		opts.Smoothing = 3
+	}
+	if opts.Suppression <= 0 {
+		opts.Suppression = time.Second
+	}
+	if opts.Ignore == nil {
+		opts.Ignore = []string{"_silence_", "_unknown_"}
+	}
+	var err error
+	if opts.Labels, err = predictorLabels(p, opts.Labels); err != nil {
+		return nil, err
+	}
+
+	return &KeywordSpotter{
+		p:        p,
+		frontend: frontend,
+		opts:     opts,
+		frames:   frames,
+		reported: map[int]int64{},
+	}, nil
+}
+
+// Compute the features of a clip sized to the input of the model, the
+// clip is resampled to the rate of the front end when needed
+func AudioInput(p *PredictorData, frontend *audio.Frontend, clip *audio.Clip) ([]float32, error) {
+	shape := InputShape(p)
+	if len(shape) < 3 {
+		return nil, errors.Errorf("expected an input of shape [batch, frames, features], got %v", shape)
+	}
+	if shape[2] != frontend.NumFeatures() {
+		return nil, errors.Errorf("the model takes %d features per frame but the front end computes %d", shape[2], frontend.NumFeatures())
+	}
+	samples := clip.Samples
+	if clip.SampleRate != frontend.SampleRate() {
+		samples = audio.Resample(samples, clip.SampleRate, frontend.SampleRate())
+	}
+	return frontend.Tensor(samples, shape[1]), nil
+}
+
+// Run inference on an audio clip
+func PredictAudio(p *PredictorData, frontend *audio.Frontend, clip *audio.Clip) error {
+	input, err := AudioInput(p, frontend, clip)
+	if err != nil {
+		return err
+	}
+	return Predict(p, float32Bytes(input), false)
+}
+
+// Feed samples at the sample rate of the front end and return the
+// keywords detected in them
+func (k *KeywordSpotter) Write(samples []float32) ([]KeywordDetection, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.buffer = append(k.buffer, samples...)
+	rate := int64(k.frontend.SampleRate())
+	window := int64(k.opts.Window.Seconds() * float64(rate))
+	stride := int64(k.opts.Stride.Seconds() * float64(rate))
+	if k.next == 0 {
+		k.next = window
+	}
+
+	var detections []KeywordDetection
+	for k.offset+int64(len(k.buffer)) >= k.next {
+		start := k.next - window - k.offset
+		clip := k.buffer[start : start+window]
+		scores, err := k.classify(clip)
+		if err != nil {
+			return detections, err
+		}
+		if d, ok := k.detect(scores, k.next); ok {
+			detections = append(detections, d)
+		}
+		k.next += stride
+	}
+
+	// keep what the next window needs
+	if drop := k.next - window - k.offset; drop > 0 {
+		if drop > int64(len(k.buffer)) {
+			drop = int64(len(k.buffer))
+		}
+		k.buffer = append(k.buffer[:0], k.buffer[drop:]...)
+		k.offset += drop
+	}
+	return detections, nil
+}
+
+// Run the model on a clip of the window length
+func (k *KeywordSpotter) classify(clip []float32) ([]float32, error) {
+	input := k.frontend.Tensor(clip, k.frames)
+	scores, err := predictRaw(k.p, float32Bytes(input), false)
+	if err != nil {
+		return nil, err
+	}
+	if k.opts.Softmax {
+		probs := make([]float32, len(scores))
+		softmax(probs, scores)
+		scores = probs
+	}
+	return scores, nil
+}
+
+// Average the scores over the last inferences and report the best keyword
+func (k *KeywordSpotter) detect(scores []float32, end int64) (KeywordDetection, bool) {
+	k.history = append(k.history, scores)
+	if len(k.history) > k.opts.Smoothing {
+		k.history = k.history[1:]
+	}
+	avg := make([]float32, len(scores))
+	for _, h := range k.history {
+		for ii := range avg {
+			if ii < len(h) {
+				avg[ii] += h[ii] / float32(len(k.history))
+			}
+		}
+	}
+
+	best := -1
+	for ii, s := range avg {
+		if k.ignored(ii) {
+			continue
+		}
+		if best < 0 || s > avg[best] {
+			best = ii
+		}
+	}
+	if best < 0 || avg[best] < k.opts.Threshold {
+		return KeywordDetection{}, false
+	}
+
+	rate := int64(k.frontend.SampleRate())
+	suppression := int64(k.opts.Suppression.Seconds() * float64(rate))
+	if last, ok := k.reported[best]; ok && end-last < suppression {
+		return KeywordDetection{}, false
+	}
+	k.reported[best] = end
+	return KeywordDetection{
+		Keyword: labelAt(k.opts.Labels, best),
+		Index:   best,
+		Score:   avg[best],
+		Time:    time.Duration(end) * time.Second / time.Duration(rate),
+	}, true
+}
+
+func (k *KeywordSpotter) ignored(index int) bool {
+	label := labelAt(k.opts.Labels, index)
+	for _, l := range k.opts.Ignore {
+		if label == l {
+			return true
+		}
+	}
+	return false
+}
+
+// Classification feature of a keyword detection with its time in the metadata
+func KeywordFeature(d KeywordDetection) *dlframework.Feature {
+	return feature.New(
+		feature.ClassificationIndex(int32(d.Index)),
+		feature.ClassificationLabel(d.Keyword),
+		feature.Probability(d.Score),
+		feature.AppendMetadata("time_ms", strconv.FormatInt(int64(d.Time/time.Millisecond), 10)),
+	)
+}
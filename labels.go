@@ -0,0 +1,42 @@
+package snpe
+
+import (
+	"bufio"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Read a label file with one label per line
+func ReadLabels(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open label file %s", path)
+	}
+	defer f.Close()
+
+	var labels []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		labels = append(labels, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read label file %s", path)
+	}
+	return labels, nil
+}
+
+// Labels given explicitly, or read from the label file of the predictor
+func predictorLabels(p *PredictorData, labels []string) ([]string, error) {
+	if labels != nil || p.options == nil || p.options.labels == "" {
+		return labels, nil
+	}
+	return ReadLabels(p.options.labels)
+}
+
+func labelAt(labels []string, index int) string {
+	if index < 0 || index >= len(labels) {
+		return ""
+	}
+	return labels[index]
+}
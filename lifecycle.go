@@ -0,0 +1,183 @@
+package snpe
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// State of a predictor in its lifecycle
+type State int32
+
+const (
+	// created but the network is not built yet
+	StateDeclared State = iota
+	// the network is being built
+	StateLoading
+	// the network is built and accepts predictions
+	StateReady
+	// building the network failed, see Err
+	StateFailed
+	// the native resources have been released
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateDeclared:
+		return "declared"
+	case StateLoading:
+		return "loading"
+	case StateReady:
+		return "ready"
+	case StateFailed:
+		return "failed"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// Declare a predictor without building its network, call Load or LoadAsync
+// to build it. Relative model paths are resolved against snpe.model_dir.
+func Declare(model string, opts ...Option) *PredictorData {
+	return newPredictorData(Config.ModelPath(model), NewOptions(opts...))
+}
+
+// Build the network of a declared predictor. Loading an already loaded
+// predictor waits for the first load and returns its result.
+func Load(p *PredictorData) error {
+	if !atomic.CompareAndSwapInt32(&p.state, int32(StateDeclared), int32(StateLoading)) {
+		switch state := p.State(); state {
+		case StateLoading:
+			<-p.Ready()
+			return p.Err()
+		case StateReady, StateFailed:
+			return p.Err()
+		default:
+			return errors.Errorf("predictor is %s", state)
+		}
+	}
+
+	// resolve the AUTO runtime before the predictor is built
+	if p.options.mode == AUTO {
+		decision, err := SelectRuntime(p.model, p.options)
+		if err != nil {
+			p.err = errors.Wrap(err, "failed to select a runtime")
+			p.setState(StateFailed)
+			p.closeReady()
+			return p.err
+		}
+		log.WithField("runtime", decision.Runtime).WithField("cached", decision.Cached).Debug("selected runtime")
+		p.autoDecision = decision
+		p.options.mode = decision.Mode
+		p.mode = decision.Mode
+	}
+
+	p.mu.Lock()
+	start := time.Now()
+	err := loadNative(p)
+	p.metrics.observeLoad(p, time.Since(start), err)
+	if err != nil {
+		p.err = err
+		p.setState(StateFailed)
+	} else {
+		p.setState(StateReady)
+	}
+	p.mu.Unlock()
+
+	p.closeReady()
+	return err
+}
+
+// Build the network of a declared predictor in the background.
+// The returned channel is closed once the predictor is ready or failed.
+func LoadAsync(p *PredictorData) <-chan struct{} {
+	go Load(p)
+	return p.Ready()
+}
+
+// Run n predictions on synthetic input of the network inputs so that
+// the first real prediction does not pay for lazy initialization
+func Warmup(p *PredictorData, n int) error {
+	inputs := syntheticInputs(p)
+	if len(inputs) == 0 {
+		return errors.New("unknown model inputs")
+	}
+	for _, in := range inputs {
+		if len(in.Data) == 0 {
+			return errors.Errorf("unknown shape of input %s", in.Name)
+		}
+	}
+
+	for ii := 0; ii < n; ii++ {
+		if err := PredictInputs(p, inputs); err != nil {
+			return errors.Wrapf(err, "warmup run %d failed", ii)
+		}
+	}
+	return nil
+}
+
+// Reproducible random inputs for every input of the network
+func syntheticInputs(p *PredictorData) []Tensor {
+	rng := rand.New(rand.NewSource(1))
+	inputs := Inputs(p)
+	for ii := range inputs {
+		data := make([]float32, shapeSize(inputs[ii].Shape))
+		for jj := range data {
+			data[jj] = rng.Float32()
+		}
+		inputs[ii].Data = data
+	}
+	return inputs
+}
+
+// Input dimensions of the network, available once the predictor is ready
+func InputShape(p *PredictorData) []int {
+	if p.State() != StateReady {
+		return nil
+	}
+	return append([]int(nil), p.inputShape...)
+}
+
+// Names and dimensions of every input of the network, available once the predictor is ready
+func Inputs(p *PredictorData) []Tensor {
+	if p.State() != StateReady {
+		return nil
+	}
+	inputs := make([]Tensor, len(p.inputs))
+	for ii, in := range p.inputs {
+		inputs[ii] = Tensor{Name: in.Name, Shape: append([]int(nil), in.Shape...)}
+	}
+	return inputs
+}
+
+// Current lifecycle state
+func (pd *PredictorData) State() State {
+	return State(atomic.LoadInt32(&pd.state))
+}
+
+// Closed once loading has finished, successfully or not
+func (pd *PredictorData) Ready() <-chan struct{} {
+	return pd.ready
+}
+
+// Error that made loading fail
+func (pd *PredictorData) Err() error {
+	if pd.State() == StateLoading {
+		return nil
+	}
+	return pd.err
+}
+
+func (pd *PredictorData) setState(s State) {
+	atomic.StoreInt32(&pd.state, int32(s))
+}
+
+func (pd *PredictorData) closeReady() {
+	pd.readyOnce.Do(func() {
+		close(pd.ready)
+	})
+}
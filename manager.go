@@ -0,0 +1,324 @@
+package snpe
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/abhiutd/snpe-predictor/artifact"
+	"github.com/abhiutd/snpe-predictor/dlc"
+	"github.com/pkg/errors"
+	"github.com/rai-project/dlframework"
+)
+
+// ErrManagerClosed is returned for models requested from a closed Manager
+var ErrManagerClosed = errors.New("manager is closed")
+
+// ModelLoader builds the predictor of a model manifest
+type ModelLoader func(m *dlframework.ModelManifest) (*PredictorData, error)
+
+// Loader that downloads the model files through the fetcher and builds
+// the predictor with the given options
+func FetchLoader(fetcher *artifact.Fetcher, opts ...Option) ModelLoader {
+	return func(m *dlframework.ModelManifest) (*PredictorData, error) {
+		files, err := fetcher.FetchModel(context.Background(), m)
+		if err != nil {
+			return nil, err
+		}
+		modelOpts := append([]Option{Manifest(m), Labels(files.Labels)}, opts...)
+		return NewWithOptions(files.Graph, modelOpts...)
+	}
+}
+
+// ManagedModel reports the state of a model held by a Manager
+type ManagedModel struct {
+	Name   string `json:"name"`
+	Loaded bool   `json:"loaded"`
+	// approximate native memory of the predictor in bytes
+	Memory int64 `json:"memory"`
+	// number of callers currently using the predictor
+	InUse int `json:"in_use"`
+}
+
+type managedModel struct {
+	name     string
+	manifest *dlframework.ModelManifest
+	p        *PredictorData
+	memory   int64
+	refs     int
+	// closed once a load started by Get finished
+	loading chan struct{}
+	err     error
+	// position in the LRU list while loaded
+	elem *list.Element
+}
+
+// Manager loads models on demand and keeps the approximate native memory
+// of the loaded predictors within a budget by closing the least recently
+// used ones. Models are keyed by their dlframework canonical name.
+type Manager struct {
+	budget int64
+	loader ModelLoader
+
+	mu     sync.Mutex
+	models map[string]*managedModel
+	lru    *list.List
+	used   int64
+	// models still in use when the manager is closed are closed on release
+	closed bool
+}
+
+// Create new model manager, a budget of 0 means unlimited
+func NewManager(budget int64, loader ModelLoader) *Manager {
+	return &Manager{
+		budget: budget,
+		loader: loader,
+		models: map[string]*managedModel{},
+		lru:    list.New(),
+	}
+}
+
+// Name a manifest is registered under. The canonical name needs the
+// framework to be registered with dlframework, otherwise name:version is used.
+func ModelName(m *dlframework.ModelManifest) string {
+	if name, err := m.CanonicalName(); err == nil {
+		return name
+	}
+	version := m.GetVersion()
+	if version == "" {
+		version = "latest"
+	}
+	return strings.ToLower(m.GetName()) + ":" + version
+}
+
+// Make a model available to Get, it is only loaded on first use
+func (m *Manager) Register(manifest *dlframework.ModelManifest) (string, error) {
+	if err := manifest.Validate(); err != nil {
+		return "", err
+	}
+	name := ModelName(manifest)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.models[name]; ok {
+		return "", errors.Errorf("the %s model has already been registered", name)
+	}
+	m.models[name] = &managedModel{
+		name:     name,
+		manifest: manifest,
+	}
+	return name, nil
+}
+
+// Get the predictor of a registered model, loading it when needed.
+// The predictor is not evicted until release is called.
+func (m *Manager) Get(name string) (p *PredictorData, release func(), err error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, nil, ErrManagerClosed
+	}
+	model, ok := m.models[name]
+	if !ok {
+		m.mu.Unlock()
+		return nil, nil, errors.Errorf("model %s not found in the manager", name)
+	}
+	model.refs++
+
+	for {
+		if model.p != nil {
+			m.lru.MoveToFront(model.elem)
+			p := model.p
+			m.mu.Unlock()
+			return p, m.releaseFunc(model), nil
+		}
+		if model.loading == nil {
+			break
+		}
+		// another caller is loading the model
+		loading := model.loading
+		m.mu.Unlock()
+		<-loading
+		m.mu.Lock()
+		if model.err != nil && model.p == nil {
+			err := model.err
+			model.refs--
+			m.mu.Unlock()
+			return nil, nil, err
+		}
+	}
+
+	model.loading = make(chan struct{})
+	model.err = nil
+	m.mu.Unlock()
+
+	p, err = m.loader(model.manifest)
+	var memory int64
+	if err == nil {
+		memory = EstimateMemory(p)
+	}
+
+	m.mu.Lock()
+	close(model.loading)
+	model.loading = nil
+	if err != nil {
+		model.err = err
+		model.refs--
+		m.mu.Unlock()
+		return nil, nil, errors.Wrapf(err, "failed to load model %s", name)
+	}
+	if m.closed {
+		// the manager was closed during the load
+		model.err = ErrManagerClosed
+		model.refs--
+		m.mu.Unlock()
+		Close(p)
+		return nil, nil, ErrManagerClosed
+	}
+
+	model.p = p
+	model.memory = memory
+	model.elem = m.lru.PushFront(model)
+	m.used += memory
+	evicted := m.evictLocked()
+	m.mu.Unlock()
+
+	closeAll(evicted)
+	return p, m.releaseFunc(model), nil
+}
+
+// Close the predictor of a model, it is reloaded on the next Get
+func (m *Manager) Evict(name string) error {
+	m.mu.Lock()
+	model, ok := m.models[name]
+	if !ok {
+		m.mu.Unlock()
+		return errors.Errorf("model %s not found in the manager", name)
+	}
+	if model.p == nil {
+		m.mu.Unlock()
+		return nil
+	}
+	if model.refs > 0 {
+		m.mu.Unlock()
+		return errors.Errorf("model %s is in use", name)
+	}
+	p := m.unloadLocked(model)
+	m.mu.Unlock()
+
+	Close(p)
+	return nil
+}
+
+// State of the registered models
+func (m *Manager) Models() []ManagedModel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]ManagedModel, 0, len(m.models))
+	for _, model := range m.models {
+		res = append(res, ManagedModel{
+			Name:   model.name,
+			Loaded: model.p != nil,
+			Memory: model.memory,
+			InUse:  model.refs,
+		})
+	}
+	return res
+}
+
+// Approximate native memory used by the loaded predictors
+func (m *Manager) MemoryUsage() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.used
+}
+
+// Close every loaded predictor. Predictors still in use are closed once
+// their last caller releases them, and Get fails from now on.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	var unloaded []*PredictorData
+	for _, model := range m.models {
+		if model.p != nil && model.refs == 0 {
+			unloaded = append(unloaded, m.unloadLocked(model))
+		}
+	}
+	m.mu.Unlock()
+
+	closeAll(unloaded)
+}
+
+func (m *Manager) releaseFunc(model *managedModel) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			model.refs--
+			var unloaded []*PredictorData
+			if m.closed && model.refs == 0 && model.p != nil {
+				unloaded = append(unloaded, m.unloadLocked(model))
+			}
+			// models kept over budget because they were in use can go now
+			unloaded = append(unloaded, m.evictLocked()...)
+			m.mu.Unlock()
+
+			closeAll(unloaded)
+		})
+	}
+}
+
+// Unload least recently used models that are not in use until the budget
+// is met, the returned predictors are closed by the caller once the lock
+// is released
+func (m *Manager) evictLocked() []*PredictorData {
+	if m.budget <= 0 {
+		return nil
+	}
+	var evicted []*PredictorData
+	for e := m.lru.Back(); e != nil && m.used > m.budget; {
+		prev := e.Prev()
+		model := e.Value.(*managedModel)
+		if model.refs == 0 {
+			log.WithField("model", model.name).WithField("memory", model.memory).Debug("evicting model")
+			evicted = append(evicted, m.unloadLocked(model))
+		}
+		e = prev
+	}
+	if m.used > m.budget {
+		log.WithField("used", m.used).WithField("budget", m.budget).Warn("models in use exceed the memory budget")
+	}
+	return evicted
+}
+
+// Detach the predictor of a model, closing it waits for in-flight
+// inference and is left to the caller outside the manager lock
+func (m *Manager) unloadLocked(model *managedModel) *PredictorData {
+	p := model.p
+	m.lru.Remove(model.elem)
+	m.used -= model.memory
+	model.p = nil
+	model.elem = nil
+	model.memory = 0
+	return p
+}
+
+func closeAll(ps []*PredictorData) {
+	for _, p := range ps {
+		Close(p)
+	}
+}
+
+// Approximate native memory held by a predictor: the unpacked DLC records
+// (network definition and weights) plus the input tensors
+func EstimateMemory(p *PredictorData) int64 {
+	var size int64
+	if c, err := dlc.Open(p.model); err == nil {
+		for _, r := range c.Records {
+			size += int64(r.Size)
+		}
+		c.Close()
+	}
+	return size + int64(4*shapeSize(p.inputShape))
+}
@@ -0,0 +1,121 @@
+package snpe
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/rai-project/dlframework"
+)
+
+// Manager whose loader builds unloaded predictors of the given memory, in bytes
+func newTestManager(budget int64, memory map[string]int) (*Manager, *[]*PredictorData) {
+	var mu sync.Mutex
+	var loaded []*PredictorData
+	m := NewManager(budget, func(manifest *dlframework.ModelManifest) (*PredictorData, error) {
+		p := newPredictorData(manifest.Name+".dlc", NewOptions())
+		p.inputShape = []int{memory[manifest.Name] / 4}
+		mu.Lock()
+		loaded = append(loaded, p)
+		mu.Unlock()
+		return p, nil
+	})
+	for name := range memory {
+		m.models[name] = &managedModel{name: name, manifest: &dlframework.ModelManifest{Name: name}}
+	}
+	return m, &loaded
+}
+
+func TestManagerEvictsUnusedModels(t *testing.T) {
+	m, _ := newTestManager(100, map[string]int{"a": 60, "b": 60})
+
+	a, releaseA, err := m.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a is in use and stays loaded over budget
+	b, releaseB, err := m.Get("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.State() == StateClosed {
+		t.Fatal("model in use was evicted")
+	}
+	if got := m.MemoryUsage(); got != 120 {
+		t.Errorf("MemoryUsage = %d, want 120", got)
+	}
+
+	// a is the least recently used model and goes once released
+	releaseA()
+	if a.State() != StateClosed || b.State() == StateClosed {
+		t.Errorf("a %s, b %s, want a closed and b loaded", a.State(), b.State())
+	}
+	if got := m.MemoryUsage(); got != 60 {
+		t.Errorf("MemoryUsage = %d, want 60", got)
+	}
+	releaseB()
+	if b.State() == StateClosed {
+		t.Error("model within the budget was evicted")
+	}
+}
+
+func TestManagerCloseWaitsForRelease(t *testing.T) {
+	m, _ := newTestManager(0, map[string]int{"a": 4, "b": 4})
+
+	a, releaseA, err := m.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, releaseB, err := m.Get("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseB()
+
+	m.Close()
+	if b.State() != StateClosed {
+		t.Errorf("unused model is %s after Close", b.State())
+	}
+	if a.State() == StateClosed {
+		t.Fatal("model in use was closed by Close")
+	}
+	if _, _, err := m.Get("b"); err != ErrManagerClosed {
+		t.Errorf("Get after Close: error = %v, want %v", err, ErrManagerClosed)
+	}
+
+	releaseA()
+	if a.State() != StateClosed {
+		t.Errorf("model is %s after its last release", a.State())
+	}
+	releaseA()
+	if models := m.Models(); len(models) != 2 || models[0].InUse != 0 || models[1].InUse != 0 {
+		t.Errorf("Models() = %+v, want nothing in use", models)
+	}
+}
+
+func TestManagerSharesLoads(t *testing.T) {
+	m, loaded := newTestManager(0, map[string]int{"a": 4})
+
+	var wg sync.WaitGroup
+	for ii := 0; ii < 8; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, release, err := m.Get("a")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			release()
+		}()
+	}
+	wg.Wait()
+	if len(*loaded) != 1 {
+		t.Errorf("model loaded %d times, want once", len(*loaded))
+	}
+	if err := m.Evict("a"); err != nil {
+		t.Fatal(err)
+	}
+	if (*loaded)[0].State() != StateClosed {
+		t.Error("evicted model was not closed")
+	}
+}
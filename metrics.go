@@ -0,0 +1,221 @@
+package snpe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Upper bounds in seconds of the load and execute latency buckets
+var secondsBounds = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+type metricKey struct {
+	model   string
+	runtime string
+}
+
+type fallbackKey struct {
+	model     string
+	requested string
+	runtime   string
+}
+
+// metrics of every predictor of the process
+type metrics struct {
+	mu               sync.Mutex
+	loads            map[metricKey]uint64
+	loadErrors       map[metricKey]uint64
+	predictions      map[metricKey]uint64
+	predictionErrors map[metricKey]uint64
+	fallbacks        map[fallbackKey]uint64
+	loadLatency      map[metricKey]*Histogram
+	executeLatency   map[metricKey]*Histogram
+
+	active int64
+}
+
+var predictorMetrics = newMetrics()
+
+func newMetrics() *metrics {
+	return &metrics{
+		loads:            map[metricKey]uint64{},
+		loadErrors:       map[metricKey]uint64{},
+		predictions:      map[metricKey]uint64{},
+		predictionErrors: map[metricKey]uint64{},
+		fallbacks:        map[fallbackKey]uint64{},
+		loadLatency:      map[metricKey]*Histogram{},
+		executeLatency:   map[metricKey]*Histogram{},
+	}
+}
+
+func (m *metrics) observeLoad(p *PredictorData, elapsed time.Duration, err error) {
+	key := p.metricKey()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loads[key]++
+	if err != nil {
+		m.loadErrors[key]++
+		return
+	}
+	histogram(m.loadLatency, key).Observe(elapsed.Seconds())
+	atomic.AddInt64(&m.active, 1)
+	if requested := RuntimeName(p.options.mode); requested != key.runtime {
+		m.fallbacks[fallbackKey{model: key.model, requested: requested, runtime: key.runtime}]++
+	}
+}
+
+func (m *metrics) observePrediction(p *PredictorData, elapsed time.Duration, err error) {
+	key := p.metricKey()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.predictions[key]++
+	if err != nil {
+		m.predictionErrors[key]++
+		return
+	}
+	histogram(m.executeLatency, key).Observe(elapsed.Seconds())
+}
+
+func (m *metrics) closed() {
+	atomic.AddInt64(&m.active, -1)
+}
+
+func histogram(hs map[metricKey]*Histogram, key metricKey) *Histogram {
+	h, ok := hs[key]
+	if !ok {
+		h = NewHistogram(secondsBounds...)
+		hs[key] = h
+	}
+	return h
+}
+
+// Labels the metrics of a predictor are reported under
+func (pd *PredictorData) metricKey() metricKey {
+	runtime := pd.runtime
+	if runtime == "" {
+		runtime = RuntimeName(pd.options.mode)
+	}
+	return metricKey{model: filepath.Base(pd.model), runtime: runtime}
+}
+
+// Write the metrics of every predictor in the Prometheus text format
+func WriteMetrics(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	predictorMetrics.write(bw)
+	return bw.Flush()
+}
+
+// HTTP handler serving the metrics in the Prometheus text format
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := WriteMetrics(w); err != nil {
+			log.WithError(err).Error("failed to write metrics")
+		}
+	})
+}
+
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeCounter(w, "snpe_loads_total", "Number of predictor loads.", m.loads)
+	writeCounter(w, "snpe_load_errors_total", "Number of failed predictor loads.", m.loadErrors)
+	writeCounter(w, "snpe_predictions_total", "Number of predictions.", m.predictions)
+	writeCounter(w, "snpe_prediction_errors_total", "Number of failed predictions.", m.predictionErrors)
+	writeHistograms(w, "snpe_load_duration_seconds", "Time to build a predictor.", m.loadLatency)
+	writeHistograms(w, "snpe_execute_duration_seconds", "Time to run a prediction.", m.executeLatency)
+
+	fmt.Fprintf(w, "# HELP snpe_runtime_fallbacks_total Number of loads that fell back to another runtime.\n")
+	fmt.Fprintf(w, "# TYPE snpe_runtime_fallbacks_total counter\n")
+	fallbacks := make([]fallbackKey, 0, len(m.fallbacks))
+	for k := range m.fallbacks {
+		fallbacks = append(fallbacks, k)
+	}
+	sort.Slice(fallbacks, func(ii, jj int) bool {
+		a, b := fallbacks[ii], fallbacks[jj]
+		if a.model != b.model {
+			return a.model < b.model
+		}
+		if a.requested != b.requested {
+			return a.requested < b.requested
+		}
+		return a.runtime < b.runtime
+	})
+	for _, k := range fallbacks {
+		fmt.Fprintf(w, "snpe_runtime_fallbacks_total{model=%s,requested=%s,runtime=%s} %d\n",
+			quoteLabel(k.model), quoteLabel(k.requested), quoteLabel(k.runtime), m.fallbacks[k])
+	}
+
+	fmt.Fprintf(w, "# HELP snpe_active_predictors Number of loaded predictors.\n")
+	fmt.Fprintf(w, "# TYPE snpe_active_predictors gauge\n")
+	fmt.Fprintf(w, "snpe_active_predictors %d\n", atomic.LoadInt64(&m.active))
+}
+
+func writeCounter(w io.Writer, name, help string, values map[metricKey]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, k.labels(), values[k])
+	}
+}
+
+func writeHistograms(w io.Writer, name, help string, hs map[metricKey]*Histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	keys := make([]metricKey, 0, len(hs))
+	for k := range hs {
+		keys = append(keys, k)
+	}
+	sortMetricKeys(keys)
+	for _, k := range keys {
+		s := hs[k].Snapshot()
+		labels := k.labels()
+		for ii, b := range s.Bounds {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(b), s.Counts[ii])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, s.Count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(s.Sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, s.Count)
+	}
+}
+
+func sortedKeys(values map[metricKey]uint64) []metricKey {
+	keys := make([]metricKey, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sortMetricKeys(keys)
+	return keys
+}
+
+func sortMetricKeys(keys []metricKey) {
+	sort.Slice(keys, func(ii, jj int) bool {
+		if keys[ii].model != keys[jj].model {
+			return keys[ii].model < keys[jj].model
+		}
+		return keys[ii].runtime < keys[jj].runtime
+	})
+}
+
+func (k metricKey) labels() string {
+	return "model=" + quoteLabel(k.model) + ",runtime=" + quoteLabel(k.runtime)
+}
+
+// Label value escaped as the text format requires
+func quoteLabel(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, "\n", `\n`, -1)
+	v = strings.Replace(v, `"`, `\"`, -1)
+	return `"` + v + `"`
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
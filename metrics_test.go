@@ -0,0 +1,121 @@
+package snpe
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Replace the process metrics with empty ones, the returned function restores them
+func resetMetrics() (*metrics, func()) {
+	saved := predictorMetrics
+	predictorMetrics = newMetrics()
+	return predictorMetrics, func() { predictorMetrics = saved }
+}
+
+func scrape(t *testing.T) []string {
+	srv := httptest.NewServer(MetricsHandler())
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(string(body), "\n")
+}
+
+func hasLine(lines []string, want string) bool {
+	for _, l := range lines {
+		if l == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMetricsHandler(t *testing.T) {
+	m, restore := resetMetrics()
+	defer restore()
+
+	gpu := &PredictorData{model: "/models/mobilenet.dlc", runtime: "GPU", options: NewOptions(Mode(GPU))}
+	fallback := &PredictorData{model: "/models/mobilenet.dlc", runtime: "CPU", options: NewOptions(Mode(DSP))}
+	failed := &PredictorData{model: "/models/mobilenet.dlc", options: NewOptions(Mode(GPU))}
+
+	m.observeLoad(gpu, 20*time.Millisecond, nil)
+	m.observeLoad(fallback, 40*time.Millisecond, nil)
+	m.observeLoad(failed, time.Millisecond, errors.New("load failed"))
+	m.observePrediction(gpu, 3*time.Millisecond, nil)
+	m.observePrediction(gpu, 200*time.Millisecond, nil)
+	m.observePrediction(gpu, 0, errors.New("execute failed"))
+	m.closed()
+
+	lines := scrape(t)
+	for _, want := range []string{
+		"# TYPE snpe_loads_total counter",
+		`snpe_loads_total{model="mobilenet.dlc",runtime="CPU"} 1`,
+		`snpe_loads_total{model="mobilenet.dlc",runtime="GPU"} 2`,
+		`snpe_load_errors_total{model="mobilenet.dlc",runtime="GPU"} 1`,
+		`snpe_predictions_total{model="mobilenet.dlc",runtime="GPU"} 3`,
+		`snpe_prediction_errors_total{model="mobilenet.dlc",runtime="GPU"} 1`,
+
+		// buckets are cumulative and only count the successful predictions
+		"# TYPE snpe_execute_duration_seconds histogram",
+		`snpe_execute_duration_seconds_bucket{model="mobilenet.dlc",runtime="GPU",le="0.0025"} 0`,
+		`snpe_execute_duration_seconds_bucket{model="mobilenet.dlc",runtime="GPU",le="0.005"} 1`,
+		`snpe_execute_duration_seconds_bucket{model="mobilenet.dlc",runtime="GPU",le="0.1"} 1`,
+		`snpe_execute_duration_seconds_bucket{model="mobilenet.dlc",runtime="GPU",le="0.25"} 2`,
+		`snpe_execute_duration_seconds_bucket{model="mobilenet.dlc",runtime="GPU",le="30"} 2`,
+		`snpe_execute_duration_seconds_bucket{model="mobilenet.dlc",runtime="GPU",le="+Inf"} 2`,
+		`snpe_execute_duration_seconds_sum{model="mobilenet.dlc",runtime="GPU"} 0.203`,
+		`snpe_execute_duration_seconds_count{model="mobilenet.dlc",runtime="GPU"} 2`,
+		`snpe_load_duration_seconds_bucket{model="mobilenet.dlc",runtime="CPU",le="0.025"} 0`,
+		`snpe_load_duration_seconds_bucket{model="mobilenet.dlc",runtime="CPU",le="0.05"} 1`,
+		`snpe_load_duration_seconds_count{model="mobilenet.dlc",runtime="GPU"} 1`,
+
+		`snpe_runtime_fallbacks_total{model="mobilenet.dlc",requested="DSP",runtime="CPU"} 1`,
+
+		"# TYPE snpe_active_predictors gauge",
+		"snpe_active_predictors 1",
+	} {
+		if !hasLine(lines, want) {
+			t.Errorf("scrape is missing %q", want)
+		}
+	}
+}
+
+func TestMetricsEmpty(t *testing.T) {
+	_, restore := resetMetrics()
+	defer restore()
+
+	lines := scrape(t)
+	for _, want := range []string{
+		"# TYPE snpe_loads_total counter",
+		"# TYPE snpe_load_duration_seconds histogram",
+		"snpe_active_predictors 0",
+	} {
+		if !hasLine(lines, want) {
+			t.Errorf("scrape is missing %q", want)
+		}
+	}
+	for _, l := range lines {
+		if strings.HasPrefix(l, "snpe_loads_total{") {
+			t.Errorf("unexpected sample %q", l)
+		}
+	}
+}
+
+func TestQuoteLabel(t *testing.T) {
+	if got, want := quoteLabel("a\"b\\c\nd"), `"a\"b\\c\nd"`; got != want {
+		t.Errorf("quoteLabel = %s, want %s", got, want)
+	}
+}
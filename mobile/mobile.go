@@ -0,0 +1,370 @@
+// Package mobile is the gomobile facade of the SNPE mPredictor.
+//
+// Its API only uses types gomobile can bind: strings, numbers, []byte,
+// pointers to exported structs and interfaces. Float inputs are passed as
+// little endian float32 bytes, which Java produces with
+//
+//	ByteBuffer buf = ByteBuffer.allocate(4 * n).order(ByteOrder.LITTLE_ENDIAN);
+//	buf.asFloatBuffer().put(floats);
+//	predictor.predict(buf.array());
+//
+// or through a FloatArray filled element by element. Every call returns an
+// error instead of panicking, which gomobile turns into a Java exception.
+package mobile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	snpe "github.com/abhiutd/snpe-predictor"
+	"github.com/pkg/errors"
+)
+
+// Config holds the settings of a predictor
+type Config struct {
+	// CPU, GPU, DSP or NNAPI
+	Runtime   string
+	Batch     int
+	Labels    string
+	InitCache bool
+	CacheDir  string
+	Verbose   bool
+	Profile   bool
+	// default, balanced, high_performance, power_saver, system_settings,
+	// sustained_high_performance or burst
+	PerformanceProfile string
+}
+
+// Create a configuration running on the CPU with a batch of one
+func NewConfig() *Config {
+	return &Config{
+		Runtime: "CPU",
+		Batch:   1,
+	}
+}
+
+// Result is a class along with its probability
+type Result struct {
+	Index       int
+	Label       string
+	Probability float32
+}
+
+// Results are sorted by decreasing probability
+type Results struct {
+	items []*Result
+}
+
+// Number of results
+func (r *Results) Len() int {
+	return len(r.items)
+}
+
+// Result at an index, nil when out of range
+func (r *Results) Get(index int) *Result {
+	if index < 0 || index >= len(r.items) {
+		return nil
+	}
+	return r.items[index]
+}
+
+// FloatArray is a float input filled element by element
+type FloatArray struct {
+	data []float32
+}
+
+// Create zero filled array
+func NewFloatArray(size int) *FloatArray {
+	if size < 0 {
+		size = 0
+	}
+	return &FloatArray{data: make([]float32, size)}
+}
+
+func (a *FloatArray) Len() int {
+	return len(a.data)
+}
+
+func (a *FloatArray) Get(index int) float32 {
+	if index < 0 || index >= len(a.data) {
+		return 0
+	}
+	return a.data[index]
+}
+
+func (a *FloatArray) Set(index int, value float32) {
+	if index >= 0 && index < len(a.data) {
+		a.data[index] = value
+	}
+}
+
+// Callback receives the outcome of an asynchronous prediction, it is
+// called on a background goroutine
+type Callback interface {
+	OnResult(results *Results)
+	OnError(message string)
+}
+
+// Predictor runs a DLC model
+type Predictor struct {
+	mu     sync.Mutex
+	p      *snpe.PredictorData
+	labels []string
+	// output tensors of the last prediction
+	outputs []snpe.Tensor
+}
+
+// Load a model
+func NewPredictor(model string, cfg *Config) (pred *Predictor, err error) {
+	defer recoverError(&err)
+	if cfg == nil {
+		cfg = NewConfig()
+	}
+	mode, err := snpe.ParseRuntime(cfg.Runtime)
+	if err != nil {
+		return nil, err
+	}
+	opts := []snpe.Option{
+		snpe.Mode(mode),
+		snpe.Batch(cfg.Batch),
+		snpe.Verbose(cfg.Verbose),
+		snpe.Profile(cfg.Profile),
+		snpe.InitCache(cfg.InitCache),
+		snpe.CacheDir(cfg.CacheDir),
+	}
+	if cfg.PerformanceProfile != "" {
+		profile, err := snpe.ParsePerfProfile(cfg.PerformanceProfile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, snpe.PerformanceProfile(profile))
+	}
+	pred = &Predictor{}
+	if cfg.Labels != "" {
+		opts = append(opts, snpe.Labels(cfg.Labels))
+		if pred.labels, err = snpe.ReadLabels(cfg.Labels); err != nil {
+			return nil, err
+		}
+	}
+	if pred.p, err = snpe.NewWithOptions(model, opts...); err != nil {
+		return nil, err
+	}
+	return pred, nil
+}
+
+// Number of input dimensions
+func (p *Predictor) InputRank() int {
+	return len(snpe.InputShape(p.p))
+}
+
+// Size of an input dimension
+func (p *Predictor) InputDim(index int) int {
+	shape := snpe.InputShape(p.p)
+	if index < 0 || index >= len(shape) {
+		return 0
+	}
+	return shape[index]
+}
+
+// Number of floats of the input
+func (p *Predictor) InputSize() int {
+	size := 1
+	for _, d := range snpe.InputShape(p.p) {
+		size *= d
+	}
+	return size
+}
+
+// Number of outputs of the last prediction
+func (p *Predictor) OutputCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.outputs)
+}
+
+// Name of an output of the last prediction
+func (p *Predictor) OutputName(index int) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if index < 0 || index >= len(p.outputs) {
+		return ""
+	}
+	return p.outputs[index].Name
+}
+
+// Number of dimensions of an output of the last prediction
+func (p *Predictor) OutputRank(index int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if index < 0 || index >= len(p.outputs) {
+		return 0
+	}
+	return len(p.outputs[index].Shape)
+}
+
+// Size of a dimension of an output of the last prediction
+func (p *Predictor) OutputDim(index, dim int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if index < 0 || index >= len(p.outputs) {
+		return 0
+	}
+	shape := p.outputs[index].Shape
+	if dim < 0 || dim >= len(shape) {
+		return 0
+	}
+	return shape[dim]
+}
+
+// Output of the last prediction as little endian float32 bytes
+func (p *Predictor) OutputData(index int) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if index < 0 || index >= len(p.outputs) {
+		return nil
+	}
+	data := p.outputs[index].Data
+	buf := make([]byte, 4*len(data))
+	for ii, v := range data {
+		binary.LittleEndian.PutUint32(buf[4*ii:], math.Float32bits(v))
+	}
+	return buf
+}
+
+// Run inference on little endian float32 bytes and return the classes of
+// the first output
+func (p *Predictor) Predict(data []byte) (res *Results, err error) {
+	defer recoverError(&err)
+	if len(data)%4 != 0 {
+		return nil, errors.Errorf("input has %d bytes, not a multiple of 4", len(data))
+	}
+	floats := make([]float32, len(data)/4)
+	for ii := range floats {
+		floats[ii] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*ii:]))
+	}
+	return p.predict(floats)
+}
+
+// Run inference on a float array and return the classes of the first output
+func (p *Predictor) PredictFloats(input *FloatArray) (res *Results, err error) {
+	defer recoverError(&err)
+	if input == nil {
+		return nil, errors.New("input is nil")
+	}
+	return p.predict(input.data)
+}
+
+// Run inference in the background, the callback receives the results or the
+// error. A panic in OnResult is passed to OnError, a panic in OnError is
+// dropped since it cannot be reported anywhere.
+func (p *Predictor) PredictAsync(data []byte, cb Callback) error {
+	if cb == nil {
+		return errors.New("callback is nil")
+	}
+	buf := append([]byte(nil), data...)
+	go func() {
+		res, err := p.Predict(buf)
+		if err != nil {
+			notifyError(cb, err)
+			return
+		}
+		if err := notifyResult(cb, res); err != nil {
+			notifyError(cb, err)
+		}
+	}()
+	return nil
+}
+
+func notifyResult(cb Callback, res *Results) (err error) {
+	defer recoverError(&err)
+	cb.OnResult(res)
+	return nil
+}
+
+func notifyError(cb Callback, err error) {
+	defer func() {
+		recover()
+	}()
+	cb.OnError(err.Error())
+}
+
+// Switch the performance profile, such as burst in the foreground and
+// power_saver in the background. The network is rebuilt, which takes about
+// as long as loading it.
+func (p *Predictor) SetPerformanceProfile(name string) (err error) {
+	defer recoverError(&err)
+	profile, err := snpe.ParsePerfProfile(name)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return snpe.SetPerformanceProfile(p.p, profile)
+}
+
+// Release the native predictor
+func (p *Predictor) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	snpe.Close(p.p)
+	p.outputs = nil
+}
+
+func (p *Predictor) predict(input []float32) (*Results, error) {
+	if size := p.InputSize(); len(input) != size {
+		return nil, errors.Errorf("input has %d floats but the model expects %d", len(input), size)
+	}
+	buf := make([]byte, 4*len(input))
+	for ii, v := range input {
+		binary.LittleEndian.PutUint32(buf[4*ii:], math.Float32bits(v))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := snpe.Predict(p.p, buf, false); err != nil {
+		return nil, err
+	}
+	outputs, err := snpe.ReadOutputTensors(p.p)
+	if err != nil {
+		return nil, err
+	}
+	p.outputs = outputs
+
+	first := outputs[0].Data
+	res := &Results{items: make([]*Result, len(first))}
+	for ii, prob := range first {
+		r := &Result{Index: ii, Probability: prob}
+		if ii < len(p.labels) {
+			r.Label = p.labels[ii]
+		}
+		res.items[ii] = r
+	}
+	sort.SliceStable(res.items, func(ii, jj int) bool {
+		return res.items[ii].Probability > res.items[jj].Probability
+	})
+	return res, nil
+}
+
+// Version of the SNPE library
+func Version() string {
+	return snpe.LibraryVersion()
+}
+
+// Whether a runtime (CPU, GPU, DSP) is available on this device
+func IsRuntimeAvailable(runtime string) bool {
+	mode, err := snpe.ParseRuntime(runtime)
+	if err != nil {
+		return false
+	}
+	return snpe.IsRuntimeAvailable(mode)
+}
+
+// Turn a panic into an error, a panic would abort the app
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		*err = errors.New(fmt.Sprint("snpe: ", r))
+	}
+}
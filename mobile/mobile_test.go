@@ -0,0 +1,38 @@
+package mobile
+
+import (
+	"testing"
+)
+
+type testCallback struct {
+	errors chan string
+	panics bool
+}
+
+func (c *testCallback) OnResult(results *Results) {}
+
+func (c *testCallback) OnError(message string) {
+	c.errors <- message
+	if c.panics {
+		panic("callback failed")
+	}
+}
+
+func TestPredictAsync(t *testing.T) {
+	p := &Predictor{}
+	if err := p.PredictAsync(nil, nil); err == nil {
+		t.Error("expected an error for a nil callback")
+	}
+
+	// the input is rejected before reaching the native predictor, a panic
+	// in OnError must not take the process down
+	for _, panics := range []bool{false, true} {
+		cb := &testCallback{errors: make(chan string, 1), panics: panics}
+		if err := p.PredictAsync(make([]byte, 3), cb); err != nil {
+			t.Fatal(err)
+		}
+		if msg := <-cb.errors; msg == "" {
+			t.Error("OnError received an empty message")
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package snpe
+
+// #include "cbits/predictor.hpp"
+import "C"
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// fields of the predictors the native code logs for, keyed by log id
+	nativeLogFields sync.Map
+	lastLogID       int32
+)
+
+// Minimum level of the messages of the native predictor, messages below
+// it are dropped before leaving native code. Levels finer than debug are
+// treated as debug and messages are never logged above error.
+func SetNativeLogLevel(level logrus.Level) {
+	var native C.int
+	switch {
+	case level >= logrus.DebugLevel:
+		native = C.SNPE_LOG_DEBUG
+	case level == logrus.InfoLevel:
+		native = C.SNPE_LOG_INFO
+	case level == logrus.WarnLevel:
+		native = C.SNPE_LOG_WARN
+	default:
+		native = C.SNPE_LOG_ERROR
+	}
+	C.SetLogLevelSnpe(native)
+}
+
+// Register the fields native messages of a predictor are logged with
+func registerNativeLog(p *PredictorData) C.int {
+	id := atomic.AddInt32(&lastLogID, 1)
+	nativeLogFields.Store(id, logrus.Fields{
+		"model":   filepath.Base(p.model),
+		"runtime": p.runtime,
+	})
+	return C.int(id)
+}
+
+func unregisterNativeLog(id C.int) {
+	nativeLogFields.Delete(int32(id))
+}
+
+//export goSnpeLog
+func goSnpeLog(id C.int, level C.int, msg *C.char) {
+	entry := log.WithField("source", "native")
+	if fields, ok := nativeLogFields.Load(int32(id)); ok {
+		entry = entry.WithFields(fields.(logrus.Fields))
+	}
+	text := C.GoString(msg)
+	switch level {
+	case C.SNPE_LOG_DEBUG:
+		entry.Debug(text)
+	case C.SNPE_LOG_INFO:
+		entry.Info(text)
+	case C.SNPE_LOG_WARN:
+		entry.Warn(text)
+	default:
+		entry.Error(text)
+	}
+}
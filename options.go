@@ -0,0 +1,175 @@
+package snpe
+
+import "github.com/rai-project/dlframework"
+
+// Options holds the settings used to build a predictor
+type Options struct {
+	mode      int
+	batch     int
+	verbose   bool
+	profile   bool
+	initCache bool
+	cacheDir  string
+	// layers whose outputs are returned instead of the final output
+	outputLayers []string
+	// selection of the AUTO runtime
+	auto AutoOptions
+	// fixed when the network is built, see Reconfigure
+	perfProfile   PerfProfile
+	priority      Priority
+	cpuFixedPoint bool
+
+	labels         string
+	modelChecksum  string
+	labelsChecksum string
+	manifest       *dlframework.ModelManifest
+}
+
+// Option changes a single predictor setting
+type Option func(o *Options)
+
+// Create new Options with the defaults applied, the defaults come from the
+// snpe configuration section once it has been read
+func NewOptions(opts ...Option) *Options {
+	options := &Options{
+		mode:  CPU_1_thread,
+		batch: 1,
+	}
+	if Config.isRead() {
+		for _, o := range ConfigOptions() {
+			o(options)
+		}
+	}
+	for _, o := range opts {
+		o(options)
+	}
+	return options
+}
+
+// Hardware mode the predictor runs on
+func Mode(mode int) Option {
+	return func(o *Options) {
+		o.mode = mode
+	}
+}
+
+// Batch size of the network
+func Batch(batch int) Option {
+	return func(o *Options) {
+		o.batch = batch
+	}
+}
+
+// Display model details
+func Verbose(verbose bool) Option {
+	return func(o *Options) {
+		o.verbose = verbose
+	}
+}
+
+// Enable operator level profiling
+func Profile(profile bool) Option {
+	return func(o *Options) {
+		o.profile = profile
+	}
+}
+
+// Enable SNPE init caching, the generated cache is persisted
+// and reused by later loads of the same model
+func InitCache(enable bool) Option {
+	return func(o *Options) {
+		o.initCache = enable
+	}
+}
+
+// Directory holding the init cache, defaults to a directory next to the model
+func CacheDir(dir string) Option {
+	return func(o *Options) {
+		o.cacheDir = dir
+	}
+}
+
+// Return the outputs of the named layers, such as the pooling layer
+// before the classifier, instead of the final output of the network
+func OutputLayers(layers ...string) Option {
+	return func(o *Options) {
+		o.outputLayers = append([]string(nil), layers...)
+	}
+}
+
+// Label file of the model, verified at load time when a checksum is known
+func Labels(path string) Option {
+	return func(o *Options) {
+		o.labels = path
+	}
+}
+
+// Expected md5 or sha256 digest of the DLC
+func ModelChecksum(digest string) Option {
+	return func(o *Options) {
+		o.modelChecksum = digest
+	}
+}
+
+// Expected md5 or sha256 digest of the label file
+func LabelsChecksum(digest string) Option {
+	return func(o *Options) {
+		o.labelsChecksum = digest
+	}
+}
+
+// Manifest the model was created from, its checksums are used
+// unless they are given explicitly
+func Manifest(m *dlframework.ModelManifest) Option {
+	return func(o *Options) {
+		o.manifest = m
+	}
+}
+
+func (o *Options) Mode() int {
+	return o.mode
+}
+
+func (o *Options) Batch() int {
+	return o.batch
+}
+
+func (o *Options) Verbose() bool {
+	return o.verbose
+}
+
+func (o *Options) Profile() bool {
+	return o.profile
+}
+
+func (o *Options) InitCache() bool {
+	return o.initCache
+}
+
+func (o *Options) CacheDir() string {
+	return o.cacheDir
+}
+
+func (o *Options) OutputLayers() []string {
+	return o.outputLayers
+}
+
+func (o *Options) Labels() string {
+	return o.labels
+}
+
+func (o *Options) Manifest() *dlframework.ModelManifest {
+	return o.manifest
+}
+
+func (o *Options) PerformanceProfile() PerfProfile {
+	return o.perfProfile
+}
+
+func (o *Options) ExecutionPriority() Priority {
+	return o.priority
+}
+
+func (o *Options) CPUFixedPoint() bool {
+	return o.cpuFixedPoint
+}
@@ -0,0 +1,185 @@
+package snpe
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PerfProfile trades latency for power, see the SNPE performance profiles
+type PerfProfile int
+
+const (
+	PerfDefault PerfProfile = iota
+	PerfBalanced
+	PerfHighPerformance
+	PerfPowerSaver
+	PerfSystemSettings
+	PerfSustainedHighPerformance
+	PerfBurst
+)
+
+var perfProfileNames = []string{
+	"default",
+	"balanced",
+	"high_performance",
+	"power_saver",
+	"system_settings",
+	"sustained_high_performance",
+	"burst",
+}
+
+func (p PerfProfile) String() string {
+	if p < 0 || int(p) >= len(perfProfileNames) {
+		return "unknown"
+	}
+	return perfProfileNames[p]
+}
+
+// Performance profile of a name as returned by String
+func ParsePerfProfile(name string) (PerfProfile, error) {
+	for ii, n := range perfProfileNames {
+		if strings.EqualFold(strings.Replace(name, "-", "_", -1), n) {
+			return PerfProfile(ii), nil
+		}
+	}
+	return PerfDefault, errors.Errorf("unknown performance profile %s", name)
+}
+
+// Priority hints the scheduling of the network against other networks
+// running on the same accelerator
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+	PriorityLow
+)
+
+var priorityNames = []string{"normal", "high", "low"}
+
+func (p Priority) String() string {
+	if p < 0 || int(p) >= len(priorityNames) {
+		return "unknown"
+	}
+	return priorityNames[p]
+}
+
+// Execution priority of a name as returned by String
+func ParsePriority(name string) (Priority, error) {
+	for ii, n := range priorityNames {
+		if strings.EqualFold(name, n) {
+			return Priority(ii), nil
+		}
+	}
+	return PriorityNormal, errors.Errorf("unknown execution priority %s", name)
+}
+
+// Performance profile of the runtime, such as burst while the app is in
+// the foreground and power saver in the background
+func PerformanceProfile(profile PerfProfile) Option {
+	return func(o *Options) {
+		o.perfProfile = profile
+	}
+}
+
+// Execution priority hint of the network
+func ExecutionPriority(priority Priority) Option {
+	return func(o *Options) {
+		o.priority = priority
+	}
+}
+
+// Run quantized models in fixed point on the CPU runtime
+func CPUFixedPoint(enable bool) Option {
+	return func(o *Options) {
+		o.cpuFixedPoint = enable
+	}
+}
+
+// Change the settings of a loaded predictor. SNPE fixes them when the
+// network is built, so the network is rebuilt, which the init cache makes
+// cheaper, and the rebuild is reported as a load in the metrics. The
+// predictor keeps running with its previous settings when the rebuild
+// fails. The runtime and the batch size cannot be changed, batchers and
+// callers size their inputs from them, load another predictor instead.
+func Reconfigure(p *PredictorData, opts ...Option) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if state := p.State(); state != StateReady {
+		return errors.Errorf("predictor is %s", state)
+	}
+
+	previous := *p.options
+	for _, o := range opts {
+		o(p.options)
+	}
+	if p.options.mode != previous.mode {
+		*p.options = previous
+		return errors.New("the runtime of a loaded predictor cannot be changed")
+	}
+	if p.options.batch != previous.batch {
+		*p.options = previous
+		return errors.New("the batch size of a loaded predictor cannot be changed")
+	}
+
+	oldCtx, oldLogID, oldRuntime := p.ctx, p.logID, p.runtime
+	start := time.Now()
+	if err := loadNative(p); err != nil {
+		*p.options = previous
+		p.ctx, p.logID, p.runtime = oldCtx, oldLogID, oldRuntime
+		p.metrics.observeLoad(p, time.Since(start), err)
+		return errors.Wrap(err, "failed to rebuild the predictor")
+	}
+	// the new network replaces the old one in the active count, and a
+	// fallback to another runtime is counted like on a load
+	p.metrics.closed()
+	p.metrics.observeLoad(p, time.Since(start), nil)
+	deleteNative(oldCtx)
+	unregisterNativeLog(oldLogID)
+	return nil
+}
+
+// Switch the performance profile of a loaded predictor, see Reconfigure
+func SetPerformanceProfile(p *PredictorData, profile PerfProfile) error {
+	return Reconfigure(p, PerformanceProfile(profile))
+}
+
+// PredictorDiagnostics reports how a predictor is set up
+type PredictorDiagnostics struct {
+	Model              string           `json:"model"`
+	State              string           `json:"state"`
+	Runtime            string           `json:"runtime"`
+	Mode               int              `json:"mode"`
+	Batch              int              `json:"batch"`
+	InputShape         []int            `json:"input_shape,omitempty"`
+	PerformanceProfile string           `json:"performance_profile"`
+	ExecutionPriority  string           `json:"execution_priority"`
+	CPUFixedPoint      bool             `json:"cpu_fixed_point"`
+	InitCache          bool             `json:"init_cache"`
+	OutputLayers       []string         `json:"output_layers,omitempty"`
+	AutoDecision       *RuntimeDecision `json:"auto_decision,omitempty"`
+	SNPEVersion        string           `json:"snpe_version"`
+}
+
+// Settings a predictor is running with
+func Diagnostics(p *PredictorData) PredictorDiagnostics {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PredictorDiagnostics{
+		Model:              p.model,
+		State:              p.State().String(),
+		Runtime:            p.metricKey().runtime,
+		Mode:               p.options.mode,
+		Batch:              p.options.batch,
+		InputShape:         append([]int(nil), p.inputShape...),
+		PerformanceProfile: p.options.perfProfile.String(),
+		ExecutionPriority:  p.options.priority.String(),
+		CPUFixedPoint:      p.options.cpuFixedPoint,
+		InitCache:          p.options.initCache,
+		OutputLayers:       append([]string(nil), p.options.outputLayers...),
+		AutoDecision:       p.autoDecision,
+		SNPEVersion:        LibraryVersion(),
+	}
+}
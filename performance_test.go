@@ -0,0 +1,41 @@
+package snpe
+
+import (
+	"testing"
+)
+
+func TestReconfigureRejectsRuntimeAndBatch(t *testing.T) {
+	p := newPredictorData("/models/mobilenet.dlc", NewOptions(Mode(GPU), Batch(2)))
+	p.metrics = newMetrics()
+	p.setState(StateReady)
+
+	for _, opt := range []Option{Batch(4), Mode(CPU_1_thread), Mode(AUTO)} {
+		if err := Reconfigure(p, PerformanceProfile(PerfBurst), opt); err == nil {
+			t.Error("expected an error for a runtime or batch change")
+		}
+		if p.options.batch != 2 || p.options.mode != GPU || p.options.perfProfile != PerfDefault {
+			t.Errorf("options changed to %+v by a rejected reconfiguration", *p.options)
+		}
+	}
+	if n := len(p.metrics.loads); n != 0 {
+		t.Errorf("%d loads recorded without a rebuild", n)
+	}
+}
+
+func TestReconfigureFailureKeepsSettings(t *testing.T) {
+	p := newPredictorData("/nonexistent/mobilenet.dlc", NewOptions(Mode(GPU)))
+	p.metrics = newMetrics()
+	p.runtime = "GPU"
+	p.setState(StateReady)
+
+	if err := Reconfigure(p, PerformanceProfile(PerfBurst)); err == nil {
+		t.Fatal("expected an error for a model that cannot be loaded")
+	}
+	if p.options.perfProfile != PerfDefault || p.runtime != "GPU" {
+		t.Errorf("profile %v runtime %s, want the previous settings", p.options.perfProfile, p.runtime)
+	}
+	key := metricKey{model: "mobilenet.dlc", runtime: "GPU"}
+	if p.metrics.loadErrors[key] != 1 || p.metrics.active != 0 {
+		t.Errorf("load errors %d active %d, want a failed load", p.metrics.loadErrors[key], p.metrics.active)
+	}
+}
@@ -0,0 +1,448 @@
+package snpe
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/rai-project/dlframework"
+	"github.com/rai-project/dlframework/framework/feature"
+)
+
+// Format of the raw features produced by the pose decoder,
+// the raw data is the JSON encoding of a Pose
+const PoseFormat = "pose_keypoints"
+
+// Keypoints of the PoseNet models, in the order of the heatmap channels
+var PoseNetKeypoints = []string{
+	"nose", "leftEye", "rightEye", "leftEar", "rightEar",
+	"leftShoulder", "rightShoulder", "leftElbow", "rightElbow",
+	"leftWrist", "rightWrist", "leftHip", "rightHip",
+	"leftKnee", "rightKnee", "leftAnkle", "rightAnkle",
+}
+
+// Parent and child keypoints of the PoseNet displacement maps, in the order
+// of the displacement channels
+var PoseNetSkeleton = [][2]int{
+	{0, 1}, {1, 3}, {0, 2}, {2, 4},
+	{0, 5}, {5, 7}, {7, 9}, {5, 11}, {11, 13}, {13, 15},
+	{0, 6}, {6, 8}, {8, 10}, {6, 12}, {12, 14}, {14, 16},
+}
+
+// Keypoint is a body part located in image coordinates
+type Keypoint struct {
+	Name  string  `json:"name"`
+	X     float32 `json:"x"`
+	Y     float32 `json:"y"`
+	Score float32 `json:"score"`
+}
+
+// Pose is the set of keypoints of a person
+type Pose struct {
+	Keypoints []Keypoint `json:"keypoints"`
+	Score     float32    `json:"score"`
+}
+
+// PoseOptions configures the decoding of PoseNet style outputs: keypoint
+// heatmaps of shape [batch,] height, width, keypoints, with optional offsets
+// (y then x for every keypoint) and forward/backward displacements (y then
+// x for every skeleton edge). Without displacements a single pose is decoded.
+type PoseOptions struct {
+	// output tensor names, found by name when empty
+	Heatmaps         string
+	Offsets          string
+	DisplacementsFwd string
+	DisplacementsBwd string
+
+	// input size of the network in pixels
+	InputWidth  int
+	InputHeight int
+	// size of the source image the keypoints are mapped to, 0 keeps the input size
+	SourceWidth  int
+	SourceHeight int
+	// pixels per heatmap cell, derived from the input and heatmap sizes when 0
+	OutputStride int
+	// the heatmaps hold probabilities already, by default they are taken as
+	// logits, as PoseNet outputs them, and go through a sigmoid
+	HeatmapProbabilities bool
+
+	// keypoint names and skeleton, default to PoseNet
+	Keypoints []string
+	Skeleton  [][2]int
+
+	ScoreThreshold float32
+	// keypoints of two poses closer than that many input pixels are the same
+	NMSRadius float32
+	// keep at most that many poses per image, defaults to 10
+	MaxPoses int
+}
+
+type poseMaps struct {
+	height, width int
+	heatmaps      []float32
+	offsets       []float32
+	fwd, bwd      []float32
+	numKeypoints  int
+	numEdges      int
+	stride        float32
+}
+
+// Decode the poses of the last inference into raw and region features
+func ReadPoseOutput(p *PredictorData, opts PoseOptions) ([]dlframework.Features, error) {
+	tensors, err := ReadOutputTensors(p)
+	if err != nil {
+		return nil, err
+	}
+	poses, err := DecodePoses(tensors, opts)
+	if err != nil {
+		return nil, err
+	}
+	features := make([]dlframework.Features, len(poses))
+	for ii, ps := range poses {
+		for _, pose := range ps {
+			features[ii] = append(features[ii], PoseFeatures(pose, opts)...)
+		}
+	}
+	return features, nil
+}
+
+// Decode PoseNet outputs into the poses of every image of the batch
+func DecodePoses(tensors []Tensor, opts PoseOptions) ([][]Pose, error) {
+	if opts.InputWidth <= 0 || opts.InputHeight <= 0 {
+		return nil, errors.New("the pose input size is required")
+	}
+	if opts.Keypoints == nil {
+		opts.Keypoints = PoseNetKeypoints
+	}
+	if opts.Skeleton == nil {
+		opts.Skeleton = PoseNetSkeleton
+	}
+	if opts.NMSRadius <= 0 {
+		opts.NMSRadius = 20
+	}
+	if opts.MaxPoses <= 0 {
+		opts.MaxPoses = 10
+	}
+
+	heatmaps, err := findTensor(tensors, opts.Heatmaps, "heatmap")
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := optionalTensor(tensors, opts.Offsets, "offset")
+	if err != nil {
+		return nil, err
+	}
+	fwd, err := optionalTensor(tensors, opts.DisplacementsFwd, "displacement_fwd")
+	if err != nil {
+		return nil, err
+	}
+	bwd, err := optionalTensor(tensors, opts.DisplacementsBwd, "displacement_bwd")
+	if err != nil {
+		return nil, err
+	}
+
+	batch, height, width, numKeypoints := 1, 0, 0, heatmaps.lastDim()
+	switch len(heatmaps.Shape) {
+	case 3:
+		height, width = heatmaps.Shape[0], heatmaps.Shape[1]
+	case 4:
+		batch, height, width = heatmaps.Shape[0], heatmaps.Shape[1], heatmaps.Shape[2]
+	default:
+		return nil, errors.Errorf("heatmaps %s must be [batch,] height, width, keypoints, got %v", heatmaps.Name, heatmaps.Shape)
+	}
+	if numKeypoints != len(opts.Keypoints) {
+		return nil, errors.Errorf("heatmaps %s have %d keypoints, expected %d", heatmaps.Name, numKeypoints, len(opts.Keypoints))
+	}
+
+	stride := float32(opts.OutputStride)
+	if stride <= 0 {
+		if height < 2 {
+			return nil, errors.New("the output stride is required for single cell heatmaps")
+		}
+		stride = float32(opts.InputHeight-1) / float32(height-1)
+	}
+
+	cells := height * width
+	slice := func(t *Tensor, channels, b int) ([]float32, error) {
+		if t == nil {
+			return nil, nil
+		}
+		if t.lastDim() != channels || len(t.Data) < batch*cells*channels {
+			return nil, errors.Errorf("output %s of shape %v does not match %d channels on a %dx%d grid", t.Name, t.Shape, channels, height, width)
+		}
+		return t.Data[b*cells*channels : (b+1)*cells*channels], nil
+	}
+
+	res := make([][]Pose, batch)
+	for b := 0; b < batch; b++ {
+		m := &poseMaps{
+			height:       height,
+			width:        width,
+			numKeypoints: numKeypoints,
+			numEdges:     len(opts.Skeleton),
+			stride:       stride,
+		}
+		if m.heatmaps, err = slice(heatmaps, numKeypoints, b); err != nil {
+			return nil, err
+		}
+		if !opts.HeatmapProbabilities {
+			scores := make([]float32, len(m.heatmaps))
+			for ii, v := range m.heatmaps {
+				scores[ii] = sigmoid(v)
+			}
+			m.heatmaps = scores
+		}
+		if m.offsets, err = slice(offsets, 2*numKeypoints, b); err != nil {
+			return nil, err
+		}
+		if fwd != nil && bwd != nil {
+			if m.fwd, err = slice(fwd, 2*m.numEdges, b); err != nil {
+				return nil, err
+			}
+			if m.bwd, err = slice(bwd, 2*m.numEdges, b); err != nil {
+				return nil, err
+			}
+		}
+
+		var poses []Pose
+		if m.fwd != nil {
+			poses = m.decodeMultiple(opts)
+		} else {
+			poses = m.decodeSingle(opts)
+		}
+		for ii := range poses {
+			poses[ii].scale(opts)
+		}
+		res[b] = poses
+	}
+	return res, nil
+}
+
+// Raw feature with the keypoints of a pose and region feature with their
+// bounding box normalized to the image
+func PoseFeatures(pose Pose, opts PoseOptions) dlframework.Features {
+	data, _ := json.Marshal(pose)
+	features := dlframework.Features{
+		feature.New(
+			feature.Raw(&dlframework.Raw{
+				Data:   data,
+				Format: PoseFormat,
+			}),
+			feature.Probability(pose.Score),
+		),
+	}
+
+	width, height := float32(opts.SourceWidth), float32(opts.SourceHeight)
+	if width <= 0 || height <= 0 {
+		width, height = float32(opts.InputWidth), float32(opts.InputHeight)
+	}
+	var box *BoundingBox
+	for _, k := range pose.Keypoints {
+		if k.Score < opts.ScoreThreshold {
+			continue
+		}
+		x, y := k.X/width, k.Y/height
+		if box == nil {
+			box = &BoundingBox{XMin: x, YMin: y, XMax: x, YMax: y}
+			continue
+		}
+		box.XMin, box.YMin = min32(box.XMin, x), min32(box.YMin, y)
+		box.XMax, box.YMax = max32(box.XMax, x), max32(box.YMax, y)
+	}
+	if box != nil {
+		b := clampBox(box.XMin, box.YMin, box.XMax, box.YMax)
+		features = append(features, DetectionFeature(Detection{
+			Box:   b,
+			Label: "person",
+			Score: pose.Score,
+		}))
+	}
+	return features
+}
+
+// Best location of every keypoint
+func (m *poseMaps) decodeSingle(opts PoseOptions) []Pose {
+	pose := Pose{Keypoints: make([]Keypoint, m.numKeypoints)}
+	var total float32
+	for k := 0; k < m.numKeypoints; k++ {
+		best := 0
+		for cell := 1; cell < m.height*m.width; cell++ {
+			if m.heatmaps[cell*m.numKeypoints+k] > m.heatmaps[best*m.numKeypoints+k] {
+				best = cell
+			}
+		}
+		x, y := m.position(best/m.width, best%m.width, k)
+		score := m.heatmaps[best*m.numKeypoints+k]
+		pose.Keypoints[k] = Keypoint{Name: opts.Keypoints[k], X: x, Y: y, Score: score}
+		total += score
+	}
+	pose.Score = total / float32(m.numKeypoints)
+	if pose.Score < opts.ScoreThreshold {
+		return nil
+	}
+	return []Pose{pose}
+}
+
+type poseRoot struct {
+	row, col, keypoint int
+	score              float32
+}
+
+// Greedy multi person decoding: the strongest local maxima of the heatmaps
+// are taken as roots and the other keypoints are reached by following the
+// displacements along the skeleton
+func (m *poseMaps) decodeMultiple(opts PoseOptions) []Pose {
+	var roots []poseRoot
+	for row := 0; row < m.height; row++ {
+		for col := 0; col < m.width; col++ {
+			for k := 0; k < m.numKeypoints; k++ {
+				score := m.score(row, col, k)
+				if score >= opts.ScoreThreshold && m.isLocalMaximum(row, col, k, score) {
+					roots = append(roots, poseRoot{row: row, col: col, keypoint: k, score: score})
+				}
+			}
+		}
+	}
+	sort.SliceStable(roots, func(ii, jj int) bool {
+		return roots[ii].score > roots[jj].score
+	})
+
+	radius2 := opts.NMSRadius * opts.NMSRadius
+	var poses []Pose
+	for _, root := range roots {
+		if len(poses) >= opts.MaxPoses {
+			break
+		}
+		x, y := m.position(root.row, root.col, root.keypoint)
+		if withinRadius(poses, root.keypoint, x, y, radius2) {
+			continue
+		}
+
+		keypoints := make([]Keypoint, m.numKeypoints)
+		found := make([]bool, m.numKeypoints)
+		keypoints[root.keypoint] = Keypoint{X: x, Y: y, Score: root.score}
+		found[root.keypoint] = true
+
+		// walk from the root towards the parents, then towards the children
+		for e := m.numEdges - 1; e >= 0; e-- {
+			parent, child := opts.Skeleton[e][0], opts.Skeleton[e][1]
+			if found[child] && !found[parent] {
+				keypoints[parent] = m.traverse(e, keypoints[child], parent, m.bwd)
+				found[parent] = true
+			}
+		}
+		for e := 0; e < m.numEdges; e++ {
+			parent, child := opts.Skeleton[e][0], opts.Skeleton[e][1]
+			if found[parent] && !found[child] {
+				keypoints[child] = m.traverse(e, keypoints[parent], child, m.fwd)
+				found[child] = true
+			}
+		}
+
+		// keypoints already claimed by a stronger pose do not count
+		var total float32
+		for k := range keypoints {
+			keypoints[k].Name = opts.Keypoints[k]
+			if !withinRadius(poses, k, keypoints[k].X, keypoints[k].Y, radius2) {
+				total += keypoints[k].Score
+			}
+		}
+		pose := Pose{Keypoints: keypoints, Score: total / float32(m.numKeypoints)}
+		if pose.Score >= opts.ScoreThreshold {
+			poses = append(poses, pose)
+		}
+	}
+	return poses
+}
+
+// Follow the displacement of an edge from a keypoint to the target keypoint
+func (m *poseMaps) traverse(edge int, source Keypoint, target int, displacements []float32) Keypoint {
+	row, col := m.cell(source.X, source.Y)
+	base := (row*m.width + col) * 2 * m.numEdges
+	x := source.X + displacements[base+m.numEdges+edge]
+	y := source.Y + displacements[base+edge]
+
+	// refine the displaced point with the offsets of the target keypoint
+	for step := 0; step < 2; step++ {
+		row, col = m.cell(x, y)
+		x, y = m.position(row, col, target)
+	}
+	row, col = m.cell(x, y)
+	return Keypoint{X: x, Y: y, Score: m.score(row, col, target)}
+}
+
+// Location of a keypoint in input pixels
+func (m *poseMaps) position(row, col, k int) (float32, float32) {
+	x, y := float32(col)*m.stride, float32(row)*m.stride
+	if m.offsets != nil {
+		base := (row*m.width + col) * 2 * m.numKeypoints
+		y += m.offsets[base+k]
+		x += m.offsets[base+m.numKeypoints+k]
+	}
+	return x, y
+}
+
+// Heatmap cell of a location in input pixels
+func (m *poseMaps) cell(x, y float32) (int, int) {
+	row := int(math.Round(float64(y / m.stride)))
+	col := int(math.Round(float64(x / m.stride)))
+	return clampInt(row, 0, m.height-1), clampInt(col, 0, m.width-1)
+}
+
+func (m *poseMaps) score(row, col, k int) float32 {
+	return m.heatmaps[(row*m.width+col)*m.numKeypoints+k]
+}
+
+func (m *poseMaps) isLocalMaximum(row, col, k int, score float32) bool {
+	for r := clampInt(row-1, 0, m.height-1); r <= clampInt(row+1, 0, m.height-1); r++ {
+		for c := clampInt(col-1, 0, m.width-1); c <= clampInt(col+1, 0, m.width-1); c++ {
+			if m.score(r, c, k) > score {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Map the keypoints from input pixels to source image pixels
+func (p *Pose) scale(opts PoseOptions) {
+	if opts.SourceWidth <= 0 || opts.SourceHeight <= 0 {
+		return
+	}
+	sx := float32(opts.SourceWidth) / float32(opts.InputWidth)
+	sy := float32(opts.SourceHeight) / float32(opts.InputHeight)
+	for ii := range p.Keypoints {
+		p.Keypoints[ii].X *= sx
+		p.Keypoints[ii].Y *= sy
+	}
+}
+
+func withinRadius(poses []Pose, k int, x, y, radius2 float32) bool {
+	for _, p := range poses {
+		dx, dy := p.Keypoints[k].X-x, p.Keypoints[k].Y-y
+		if dx*dx+dy*dy <= radius2 {
+			return true
+		}
+	}
+	return false
+}
+
+// Find an optional tensor, only a missing tensor given by name is an error
+func optionalTensor(tensors []Tensor, name, hint string) (*Tensor, error) {
+	if name != "" {
+		return FindTensor(tensors, name)
+	}
+	t, _ := findTensor(tensors, "", hint)
+	return t, nil
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
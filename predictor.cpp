@@ -1,6 +1,8 @@
 #define _GLIBCXX_USE_CXX11_ABI 0
 
 #include <algorithm>
+#include <cerrno>
+#include <cstring>
 #include <iosfwd>
 #include <memory>
 #include <string>
@@ -8,6 +10,9 @@
 #include <vector>
 #include <iostream>
 #include <iomanip>
+#include <sstream>
+#include <atomic>
+#include <stdexcept>
 #include <sys/time.h>
 
 #include "SNPE/SNPE.hpp"
@@ -27,8 +32,33 @@
 #include "DlSystem/PlatformConfig.hpp"
 
 #include "predictor.hpp"
+#include "_cgo_export.h"
 
-#define LOG(x) std::cerr
+// messages below this level are not formatted nor passed to Go
+static std::atomic<int> min_log_level(SNPE_LOG_INFO);
+
+// collects a message and hands it to the Go logger when it goes out of scope
+class LogMessage {
+  public:
+    LogMessage(int level, int id) : level_(level), id_(id) {}
+    ~LogMessage() {
+      std::string msg = stream_.str();
+      while(!msg.empty() && (msg.back() == '\n' || msg.back() == ' ')) {
+        msg.pop_back();
+      }
+      goSnpeLog(id_, level_, const_cast<char*>(msg.c_str()));
+    }
+    std::ostringstream &stream() { return stream_; }
+
+  private:
+    int level_;
+    int id_;
+    std::ostringstream stream_;
+};
+
+#define LOG(level) \
+  if(SNPE_LOG_##level < min_log_level.load()) {} \
+  else LogMessage(SNPE_LOG_##level, log_id_).stream()
 
 //using namespace snpe;
 using std::string;
@@ -39,43 +69,100 @@ double get_us(struct timeval t) { return (t.tv_sec * 1000000 + t.tv_usec); }
   Predictor class takes in model file (converted into .tflite from the original .pb file
   using tflite_convert CLI tool), batch size and device mode for inference
 */
+// map a hardware mode onto an SNPE runtime
+static bool runtime_for_mode(int mode, zdl::DlSystem::Runtime_t &runtime) {
+  if((mode > 0) && (mode < 9)) {
+    runtime = zdl::DlSystem::Runtime_t::CPU;
+  } else if(mode == 9) {
+    runtime = zdl::DlSystem::Runtime_t::GPU;
+  } else if (mode == 11) {
+    runtime = zdl::DlSystem::Runtime_t::DSP;
+  } else {
+    return false;
+  }
+  return true;
+}
+
+static zdl::DlSystem::PerformanceProfile_t performance_profile(int profile) {
+  switch(profile) {
+  case SNPE_PROFILE_BALANCED:
+    return zdl::DlSystem::PerformanceProfile_t::BALANCED;
+  case SNPE_PROFILE_HIGH_PERFORMANCE:
+    return zdl::DlSystem::PerformanceProfile_t::HIGH_PERFORMANCE;
+  case SNPE_PROFILE_POWER_SAVER:
+    return zdl::DlSystem::PerformanceProfile_t::POWER_SAVER;
+  case SNPE_PROFILE_SYSTEM_SETTINGS:
+    return zdl::DlSystem::PerformanceProfile_t::SYSTEM_SETTINGS;
+  case SNPE_PROFILE_SUSTAINED_HIGH_PERFORMANCE:
+    return zdl::DlSystem::PerformanceProfile_t::SUSTAINED_HIGH_PERFORMANCE;
+  case SNPE_PROFILE_BURST:
+    return zdl::DlSystem::PerformanceProfile_t::BURST;
+  }
+  return zdl::DlSystem::PerformanceProfile_t::DEFAULT;
+}
+
+static zdl::DlSystem::ExecutionPriorityHint_t execution_priority(int priority) {
+  switch(priority) {
+  case SNPE_PRIORITY_HIGH:
+    return zdl::DlSystem::ExecutionPriorityHint_t::HIGH;
+  case SNPE_PRIORITY_LOW:
+    return zdl::DlSystem::ExecutionPriorityHint_t::LOW;
+  }
+  return zdl::DlSystem::ExecutionPriorityHint_t::NORMAL;
+}
+
 class Predictor {
   public:
-    Predictor(const string &model_file, int batch, int mode, bool verbose, bool profile);
+    Predictor(const string &model_file, const SnpeOptions &opts);
+    ~Predictor();
     void Predict(int* inputData_quantize, float* inputData_float, bool quantize);
+    void PredictInputs(float* data, size_t size);
+    void ReadOutputs(const zdl::DlSystem::TensorMap &outputTensorMap);
 
     std::unique_ptr<zdl::DlContainer::IDlContainer> net_;
     std::unique_ptr<zdl::SNPE::SNPE> snpe;
-    int width_, height_, channels_;
+    int width_ = 0, height_ = 0, channels_ = 0;
+    std::vector<size_t> input_dims_;
+    // every input tensor of the network, in the order SNPE returns them
+    std::vector<string> input_names_;
+    std::vector<std::vector<size_t>> input_shapes_;
     int batch_;
     int pred_len_ = 0;
     int mode_ = 0;
-    float* result_float_;
+    int log_id_ = 0;
+    float* result_float_ = nullptr;
+    // output tensors of the last inference, in the order SNPE returns them
+    std::vector<string> output_names_;
+    std::vector<std::vector<size_t>> output_dims_;
+    std::vector<std::vector<float>> outputs_;
     bool quantize_ = false;
     bool verbose_ = false; // display model details
     bool allow_fp16_ = false;
     bool profile_ = false; // operator level profiling
     bool read_outputs_ = true;
+    bool init_cache_ = false; // use SNPE init caching
 };
 
-Predictor::Predictor(const string &model_file, int batch, int mode, bool verbose, bool profile) {
+Predictor::Predictor(const string &model_file, const SnpeOptions &opts) {
   char* model_file_char = const_cast<char*>(model_file.c_str());
   
   // set verbosity and profiling levels
-  profile_ = profile;
-  verbose_ = verbose;
-  mode_ = mode;
-  batch_ = batch;
+  profile_ = opts.profile;
+  verbose_ = opts.verbose;
+  mode_ = opts.mode;
+  batch_ = opts.batch;
+  init_cache_ = opts.init_cache;
+  log_id_ = opts.log_id;
  
   // build a runnable model from given model file
   struct timeval start_time, stop_time;
   gettimeofday(&start_time, nullptr);
   // read model file into a network 
   static zdl::DlSystem::Version_t Version = zdl::SNPE::SNPEFactory::getLibraryVersion();
-  LOG(INFO) << "SNPE Version: " << Version.asString().c_str() << "\n";  
+  LOG(DEBUG) << "SNPE Version: " << Version.asString().c_str() << "\n";  
   net_ = zdl::DlContainer::IDlContainer::open(zdl::DlSystem::String(model_file_char));
   if(net_ == nullptr) {
-    LOG(FATAL) << "Error while opening the container file" << "\n";
+    throw std::runtime_error("Error while opening the container file");
   }
   zdl::SNPE::SNPEBuilder snpeBuilder(net_.get());
   
@@ -87,20 +174,14 @@ Predictor::Predictor(const string &model_file, int batch, int mode, bool verbose
   // set hardware backend
   zdl::DlSystem::Runtime_t runtime = zdl::DlSystem::Runtime_t::CPU;
   zdl::DlSystem::RuntimeList runtimeList;
-  if((mode_ > 0) && (mode_ < 9)) {
-    runtime = zdl::DlSystem::Runtime_t::CPU;
-  } else if(mode_ == 9) {
-    runtime = zdl::DlSystem::Runtime_t::GPU;
-  } else if(mode_ == 10) {
-    LOG(FATAL) << "Cannot run NNAPI through SNPE" << "\n";
-  } else if (mode_ == 11) {
-    runtime = zdl::DlSystem::Runtime_t::DSP;
-  } else {
-    LOG(FATAL) << "Invalid hardware mode" << "\n";
+  if(mode_ == 10) {
+    throw std::invalid_argument("Cannot run NNAPI through SNPE");
+  } else if(!runtime_for_mode(mode_, runtime)) {
+    throw std::invalid_argument("Invalid hardware mode");
   }
   // check if chosen runtime is available on the device
   if(!zdl::SNPE::SNPEFactory::isRuntimeAvailable(runtime)) {
-    LOG(INFO) << "Selected runtime not present. Falling back to CPU" << "\n";
+    LOG(WARN) << "Selected runtime not present. Falling back to CPU" << "\n";
     runtime = zdl::DlSystem::Runtime_t::CPU;
   }
   if(runtimeList.empty()) {
@@ -111,16 +192,50 @@ Predictor::Predictor(const string &model_file, int batch, int mode, bool verbose
   // to make our life easier
   bool useUserSuppliedBuffers = false;
   zdl::DlSystem::PlatformConfig platformConfig;
-  bool usingInitCaching = false;
-  snpe = snpeBuilder.setOutputLayers({})
+  bool usingInitCaching = init_cache_;
+  zdl::DlSystem::StringList outputLayers;
+  for(int i = 0; i < opts.num_output_layers; i++) {
+    outputLayers.append(opts.output_layers[i]);
+  }
+  snpe = snpeBuilder.setOutputLayers(outputLayers)
       .setRuntimeProcessorOrder(runtimeList)
       .setUdlBundle(udlBundle)
       .setUseUserSuppliedBuffers(useUserSuppliedBuffers)
       .setPlatformConfig(platformConfig)
       .setInitCacheMode(usingInitCaching)
+      .setPerformanceProfile(performance_profile(opts.performance_profile))
+      .setExecutionPriorityHint(execution_priority(opts.execution_priority))
+      .setCPUFixedPointMode(opts.cpu_fixed_point)
       .build();
   if(snpe == nullptr) {
-    LOG(FATAL) << "Error while building SNPE object" << "\n";
+    throw std::runtime_error("Error while building SNPE object");
+  }
+  // persist the cache records generated during the build
+  if(init_cache_ && opts.init_cache_file != nullptr) {
+    if(!net_->save(string(opts.init_cache_file))) {
+      LOG(WARN) << "Failed to save the init cache to " << opts.init_cache_file << "\n";
+    }
+  }
+  // record the input dimensions of the network (NHWC)
+  const zdl::DlSystem::TensorShape inputShape = *snpe->getInputDimensions();
+  for(size_t i = 0; i < inputShape.rank(); i++) {
+    input_dims_.push_back(inputShape[i]);
+  }
+  const auto &inputNames_opt = snpe->getInputTensorNames();
+  const auto &inputNames = *inputNames_opt;
+  for(const char *name : inputNames) {
+    const zdl::DlSystem::TensorShape shape = *snpe->getInputDimensions(name);
+    std::vector<size_t> dims;
+    for(size_t i = 0; i < shape.rank(); i++) {
+      dims.push_back(shape[i]);
+    }
+    input_names_.push_back(name);
+    input_shapes_.push_back(dims);
+  }
+  if(input_dims_.size() == 4) {
+    height_ = input_dims_[1];
+    width_ = input_dims_[2];
+    channels_ = input_dims_[3];
   }
   gettimeofday(&stop_time, nullptr);
   // log model loading time
@@ -130,13 +245,17 @@ Predictor::Predictor(const string &model_file, int batch, int mode, bool verbose
   
 }
 
+Predictor::~Predictor() {
+  delete[] result_float_;
+}
+
 void Predictor::Predict(int* inputData_quantize, float* inputData_float, bool quantize) {
   // check the batch size for the container
   zdl::DlSystem::TensorShape tensorShape;
   tensorShape = snpe->getInputDimensions();
   size_t net_batchSize = tensorShape.getDimensions()[0];
   if(verbose_) {
-    LOG(INFO) << "Batch size for the container is " << net_batchSize << "\n";
+    LOG(DEBUG) << "Batch size for the container is " << net_batchSize << "\n";
   }
   
   std::string bufferType = "ITENSOR";
@@ -145,11 +264,13 @@ void Predictor::Predict(int* inputData_quantize, float* inputData_float, bool qu
   std::unique_ptr<zdl::DlSystem::ITensor> input;
   const auto &strList_opt = snpe->getInputTensorNames();
   if(!strList_opt) {
-    LOG(FATAL) << "Error obtaining Input tensor names" << "\n";
+    throw std::runtime_error("Error obtaining Input tensor names");
   }
   const auto &strList = *strList_opt;
   // make sure the network requires only a single input
-  assert (strList.size() == 1);
+  if(strList.size() != 1) {
+    throw std::invalid_argument("The network has " + std::to_string(strList.size()) + " inputs, a single input is expected");
+  }
 
   // create an input tensor that is correctly sized to hold the input of the network
   // Dimensions that have no fixed size will be represented with a value of 0
@@ -159,48 +280,26 @@ void Predictor::Predict(int* inputData_quantize, float* inputData_float, bool qu
   // calculate the total number of elements that can be stored in the tensor so that
   // we can check that the input contains the expected number of elememnts
   input = zdl::SNPE::SNPEFactory::getTensorFactory().createTensor(inputShape);
+  if(!input) {
+    throw std::runtime_error("Failed to create the input tensor");
+  }
 
   // TODO padding the input vetcor so as to make the size of the vector to be equal
   // to an intgeret multiple of the  batch size
   // NOTE: for now we assume that the input model is going to have a batch size == 1
 
-  // TODO set input dimensions
-  width_ = 224;
-  height_ = 224;
-  channels_ = 3;
-  if(width_ != inputShape[2]) {
-    LOG(FATAL) << "width is not 224, need to resize" << "\n";
-  }
-  if(height_ != inputShape[1]) {
-    LOG(FATAL) << "height is not 224, need to resize" << "\n";
-  }
-  if(channels_ != inputShape[3]) {
-    LOG(FATAL) << "channel is not 3, can't do anything" << "\n";
-  }
-
   // set quantization
   quantize_ = quantize;
-  const int size = batch_ * width_ * height_ * channels_;
-  // check if model bitwidth matches our expectation
-  // input image = 224 X 224 X 3
-  // resize it to what model expects if needed
+  // input dimensions were read from the network when it was built
+  // and the caller provides a buffer matching them
   if(quantize_ == false) {
-    LOG(INFO) << "Running float model" << "\n";
-    // copy array into a vector
-    std::vector<float> temp;
-    for(int i = 0; i < size; i++){
-      temp[i] = inputData_float[i];
-    }
-    std::copy(temp.begin(), temp.end(), input->begin());
+    LOG(DEBUG) << "Running float model" << "\n";
+    std::copy(inputData_float, inputData_float + input->getSize(), input->begin());
   } else if (quantize_ == true) {
-    LOG(INFO) << "Running 8-bit unsigned quantized model" << "\n";
+    LOG(DEBUG) << "Running 8-bit unsigned quantized model" << "\n";
     // TODO add quantization
   } else {
-    LOG(FATAL) << "Unsupported input type: " << ", Quantize: " << quantize_ << "\n";
-  }
-
-  if(!input) {
-    LOG(FATAL) << "could not read an empty tensor" << "\n";
+    LOG(ERROR) << "Unsupported input type: " << ", Quantize: " << quantize_ << "\n";
   }
 
   bool execStatus = false;
@@ -209,7 +308,7 @@ void Predictor::Predict(int* inputData_quantize, float* inputData_float, bool qu
   // run inference
   execStatus = snpe->execute(input.get(), outputTensorMap);
   if(execStatus == false) {
-    LOG(FATAL) << "Failed to run inference" << "\n";
+    throw std::runtime_error("Failed to run inference");
   }
   gettimeofday(&stop_time, nullptr);
   // log model inference
@@ -217,18 +316,68 @@ void Predictor::Predict(int* inputData_quantize, float* inputData_float, bool qu
     LOG(INFO) << "Model computation (C++): " << (get_us(stop_time) - get_us(start_time))/1000 << "ms \n"; 
   }
 
-  // handle output
+  ReadOutputs(outputTensorMap);
+}
+
+// run a network with several inputs, data holds every input in the order
+// of input_names_ one after the other
+void Predictor::PredictInputs(float* data, size_t size) {
+  std::vector<std::unique_ptr<zdl::DlSystem::ITensor>> inputs;
+  zdl::DlSystem::TensorMap inputTensorMap;
+  size_t offset = 0;
+  for(size_t i = 0; i < input_names_.size(); i++) {
+    const zdl::DlSystem::TensorShape inputShape = *snpe->getInputDimensions(input_names_[i].c_str());
+    std::unique_ptr<zdl::DlSystem::ITensor> input = zdl::SNPE::SNPEFactory::getTensorFactory().createTensor(inputShape);
+    if(!input) {
+      throw std::runtime_error("Failed to create the input tensor " + input_names_[i]);
+    }
+    if(offset + input->getSize() > size) {
+      throw std::invalid_argument("Input data is smaller than the inputs of the network");
+    }
+    std::copy(data + offset, data + offset + input->getSize(), input->begin());
+    offset += input->getSize();
+    inputTensorMap.add(input_names_[i].c_str(), input.get());
+    inputs.push_back(std::move(input));
+  }
+
+  zdl::DlSystem::TensorMap outputTensorMap;
+  struct timeval start_time, stop_time;
+  gettimeofday(&start_time, nullptr);
+  if(!snpe->execute(inputTensorMap, outputTensorMap)) {
+    throw std::runtime_error("Failed to run inference");
+  }
+  gettimeofday(&stop_time, nullptr);
+  if(verbose_) {
+    LOG(INFO) << "Model computation (C++): " << (get_us(stop_time) - get_us(start_time))/1000 << "ms \n";
+  }
+  ReadOutputs(outputTensorMap);
+}
+
+void Predictor::ReadOutputs(const zdl::DlSystem::TensorMap &outputTensorMap) {
   int output_size = 0;
   std::vector<float> result_temp;
+  output_names_.clear();
+  output_dims_.clear();
+  outputs_.clear();
   zdl::DlSystem::StringList tensorNames = outputTensorMap.getTensorNames();
   for(auto& name : tensorNames) {
-    LOG(INFO) << "Output tensor name: " << name << "\n";
+    LOG(DEBUG) << "Output tensor name: " << name << "\n";
     auto tensorPtr = outputTensorMap.getTensor(name);
     output_size += tensorPtr->getSize();
     for(auto it = tensorPtr->cbegin(); it != tensorPtr->cend(); it++) {
       result_temp.push_back(*it);
     }
+    // keep every output separately as well
+    const zdl::DlSystem::TensorShape shape = tensorPtr->getShape();
+    std::vector<size_t> dims;
+    for(size_t i = 0; i < shape.rank(); i++) {
+      dims.push_back(shape[i]);
+    }
+    output_names_.push_back(name);
+    output_dims_.push_back(dims);
+    outputs_.push_back(std::vector<float>(tensorPtr->cbegin(), tensorPtr->cend()));
   }
+  delete[] result_float_;
   result_float_ = new float[output_size];
   for(int i = 0; i < output_size; i++) {
     result_float_[i] = result_temp[i];
@@ -237,11 +386,14 @@ void Predictor::Predict(int* inputData_quantize, float* inputData_float, bool qu
   pred_len_ = output_size;
 }
 
-PredictorContext NewSnpe(char *model_file, int batch, int mode, bool verbose, bool profile) {
+PredictorContext NewSnpe(char *model_file, SnpeOptions opts, char **error) {
   try {
-    const auto ctx = new Predictor(model_file, batch, mode, verbose, profile);
+    const auto ctx = new Predictor(model_file, opts);
     return (void *) ctx;
-  } catch(const std::invalid_argument &ex) {
+  } catch(const std::exception &ex) {
+    if(error != nullptr) {
+      *error = strdup(ex.what());
+    }
     errno = EINVAL;
     return nullptr;
   }
@@ -249,13 +401,84 @@ PredictorContext NewSnpe(char *model_file, int batch, int mode, bool verbose, bo
 
 void InitSnpe() {}
 
-void PredictSnpe(PredictorContext pred, int* inputData_quantize, float* inputData_float, bool quantize) {
+void SetLogLevelSnpe(int level) {
+  min_log_level.store(level);
+}
+
+const char *GetLibraryVersionSnpe() {
+  static const string version(zdl::SNPE::SNPEFactory::getLibraryVersion().asString().c_str());
+  return version.c_str();
+}
+
+bool IsRuntimeAvailableSnpe(int mode) {
+  zdl::DlSystem::Runtime_t runtime;
+  if(!runtime_for_mode(mode, runtime)) {
+    return false;
+  }
+  return zdl::SNPE::SNPEFactory::isRuntimeAvailable(runtime);
+}
+
+bool IsRuntimeTypeAvailableSnpe(int runtime) {
+  zdl::DlSystem::Runtime_t rt;
+  switch(runtime) {
+  case SNPE_RUNTIME_CPU:
+    rt = zdl::DlSystem::Runtime_t::CPU;
+    break;
+  case SNPE_RUNTIME_GPU:
+    rt = zdl::DlSystem::Runtime_t::GPU;
+    break;
+  case SNPE_RUNTIME_GPU_FLOAT16:
+    rt = zdl::DlSystem::Runtime_t::GPU_FLOAT16;
+    break;
+  case SNPE_RUNTIME_DSP:
+    rt = zdl::DlSystem::Runtime_t::DSP;
+    break;
+  case SNPE_RUNTIME_AIP:
+    rt = zdl::DlSystem::Runtime_t::AIP_FIXED8_TF;
+    break;
+  default:
+    return false;
+  }
+  return zdl::SNPE::SNPEFactory::isRuntimeAvailable(rt);
+}
+
+bool PredictSnpe(PredictorContext pred, int* inputData_quantize, float* inputData_float, bool quantize, char **error) {
   auto predictor = (Predictor *)pred;
   if (predictor == nullptr) {
-    return;
+    if(error != nullptr) {
+      *error = strdup("empty predictor context");
+    }
+    return false;
+  }
+  try {
+    predictor->Predict(inputData_quantize, inputData_float, quantize);
+    return true;
+  } catch(const std::exception &ex) {
+    if(error != nullptr) {
+      *error = strdup(ex.what());
+    }
+    return false;
+  }
+}
+
+// run a network with several inputs stored one after the other
+bool PredictInputsSnpe(PredictorContext pred, float* data, int size, char **error) {
+  auto predictor = (Predictor *)pred;
+  if (predictor == nullptr) {
+    if(error != nullptr) {
+      *error = strdup("empty predictor context");
+    }
+    return false;
+  }
+  try {
+    predictor->PredictInputs(data, size);
+    return true;
+  } catch(const std::exception &ex) {
+    if(error != nullptr) {
+      *error = strdup(ex.what());
+    }
+    return false;
   }
-  predictor->Predict(inputData_quantize, inputData_float, quantize);
-  return;
 }
 
 float* GetPredictionsSnpe(PredictorContext pred) {
@@ -298,6 +521,47 @@ int GetChannelsSnpe(PredictorContext pred) {
   return predictor->channels_;
 }
 
+int GetInputShapeSnpe(PredictorContext pred, int *dims, int max_dims) {
+  auto predictor = (Predictor *)pred;
+  if (predictor == nullptr) {
+    return 0;
+  }
+  int rank = predictor->input_dims_.size();
+  for(int i = 0; i < rank && i < max_dims; i++) {
+    dims[i] = predictor->input_dims_[i];
+  }
+  return rank;
+}
+
+int GetInputCountSnpe(PredictorContext pred) {
+  auto predictor = (Predictor *)pred;
+  if (predictor == nullptr) {
+    return 0;
+  }
+  return predictor->input_names_.size();
+}
+
+const char *GetInputNameSnpe(PredictorContext pred, int index) {
+  auto predictor = (Predictor *)pred;
+  if (predictor == nullptr || index < 0 || index >= (int) predictor->input_names_.size()) {
+    return nullptr;
+  }
+  return predictor->input_names_[index].c_str();
+}
+
+int GetInputShapeAtSnpe(PredictorContext pred, int index, int *dims, int max_dims) {
+  auto predictor = (Predictor *)pred;
+  if (predictor == nullptr || index < 0 || index >= (int) predictor->input_shapes_.size()) {
+    return 0;
+  }
+  const auto &shape = predictor->input_shapes_[index];
+  int rank = shape.size();
+  for(int i = 0; i < rank && i < max_dims; i++) {
+    dims[i] = shape[i];
+  }
+  return rank;
+}
+
 int GetPredLenSnpe(PredictorContext pred) {
   auto predictor = (Predictor *)pred;
   if (predictor == nullptr) {
@@ -306,3 +570,48 @@ int GetPredLenSnpe(PredictorContext pred) {
   return predictor->pred_len_;
 }
 
+
+int GetOutputCountSnpe(PredictorContext pred) {
+  auto predictor = (Predictor *)pred;
+  if (predictor == nullptr) {
+    return 0;
+  }
+  return predictor->outputs_.size();
+}
+
+const char *GetOutputNameSnpe(PredictorContext pred, int index) {
+  auto predictor = (Predictor *)pred;
+  if (predictor == nullptr || index < 0 || index >= (int) predictor->output_names_.size()) {
+    return nullptr;
+  }
+  return predictor->output_names_[index].c_str();
+}
+
+int GetOutputShapeSnpe(PredictorContext pred, int index, int *dims, int max_dims) {
+  auto predictor = (Predictor *)pred;
+  if (predictor == nullptr || index < 0 || index >= (int) predictor->output_dims_.size()) {
+    return 0;
+  }
+  const auto &shape = predictor->output_dims_[index];
+  int rank = shape.size();
+  for(int i = 0; i < rank && i < max_dims; i++) {
+    dims[i] = shape[i];
+  }
+  return rank;
+}
+
+int GetOutputSizeSnpe(PredictorContext pred, int index) {
+  auto predictor = (Predictor *)pred;
+  if (predictor == nullptr || index < 0 || index >= (int) predictor->outputs_.size()) {
+    return 0;
+  }
+  return predictor->outputs_[index].size();
+}
+
+float *GetOutputDataSnpe(PredictorContext pred, int index) {
+  auto predictor = (Predictor *)pred;
+  if (predictor == nullptr || index < 0 || index >= (int) predictor->outputs_.size()) {
+    return nullptr;
+  }
+  return predictor->outputs_[index].data();
+}
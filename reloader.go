@@ -0,0 +1,211 @@
+package snpe
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// How long the reloader waits for writes to a file to settle
+const DefaultReloadDelay = 500 * time.Millisecond
+
+// ErrReloaderClosed is returned for reloads of a closed Reloader
+var ErrReloaderClosed = errors.New("reloader is closed")
+
+// A predictor along with the requests currently running on it
+type reloadGeneration struct {
+	p        *PredictorData
+	inflight sync.WaitGroup
+}
+
+// Reloader serves predictions from a predictor that is rebuilt whenever its
+// DLC or label file changes. The new network is built in the background and
+// swapped in once ready, the old one is closed after its in-flight requests
+// finished. If the new model fails to load the old one keeps serving.
+type Reloader struct {
+	model string
+	opts  []Option
+	files map[string]bool
+
+	mu         sync.RWMutex
+	current    *reloadGeneration
+	generation int
+	onReload   func(error)
+
+	reloadMu  sync.Mutex
+	watcher   *fsnotify.Watcher
+	delay     time.Duration
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Create new reloading predictor, the options are used for every reload
+func NewReloader(model string, opts ...Option) (*Reloader, error) {
+	p, err := NewWithOptions(model, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		Close(p)
+		return nil, errors.Wrap(err, "failed to create file watcher")
+	}
+
+	r := &Reloader{
+		model:   model,
+		opts:    opts,
+		files:   map[string]bool{},
+		current: &reloadGeneration{p: p},
+		watcher: watcher,
+		delay:   DefaultReloadDelay,
+		done:    make(chan struct{}),
+	}
+
+	// files are usually replaced rather than written in place,
+	// so the parent directories are watched
+	watched := []string{model}
+	if labels := p.options.labels; labels != "" {
+		watched = append(watched, labels)
+	}
+	for _, f := range watched {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			r.Close()
+			return nil, errors.Wrapf(err, "failed to resolve %s", f)
+		}
+		r.files[abs] = true
+		if err := watcher.Add(filepath.Dir(abs)); err != nil {
+			r.Close()
+			return nil, errors.Wrapf(err, "failed to watch %s", f)
+		}
+	}
+
+	r.wg.Add(1)
+	go r.watch()
+	return r, nil
+}
+
+// Register a function called after every reload attempt with its result
+func (r *Reloader) OnReload(fn func(error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onReload = fn
+}
+
+// Number of successful reloads
+func (r *Reloader) Generation() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.generation
+}
+
+// Get the current predictor, release must be called once the caller is
+// done with it so that a replaced predictor can be closed
+func (r *Reloader) Acquire() (p *PredictorData, release func()) {
+	r.mu.RLock()
+	g := r.current
+	g.inflight.Add(1)
+	r.mu.RUnlock()
+	return g.p, g.inflight.Done
+}
+
+// Run inference on the current predictor and return its raw output
+func (r *Reloader) Predict(data []byte, quantize bool) ([]float32, error) {
+	p, release := r.Acquire()
+	defer release()
+	return predictRaw(p, data, quantize)
+}
+
+// Build a new predictor from the model files and swap it in
+func (r *Reloader) Reload() error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	// Close holds reloadMu while closing the current predictor, a reload
+	// after that would never be closed
+	select {
+	case <-r.done:
+		return ErrReloaderClosed
+	default:
+	}
+
+	p, err := NewWithOptions(r.model, r.opts...)
+	if err == nil {
+		r.mu.Lock()
+		old := r.current
+		r.current = &reloadGeneration{p: p}
+		r.generation++
+		r.mu.Unlock()
+
+		// drain the requests still running on the old network
+		go func() {
+			old.inflight.Wait()
+			Close(old.p)
+		}()
+		log.WithField("model", r.model).Info("reloaded model")
+	} else {
+		log.WithField("model", r.model).WithError(err).Error("failed to reload model, keep serving the previous one")
+	}
+
+	r.mu.RLock()
+	fn := r.onReload
+	r.mu.RUnlock()
+	if fn != nil {
+		fn(err)
+	}
+	return err
+}
+
+// Stop watching the files and close the current predictor
+func (r *Reloader) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.watcher.Close()
+		r.wg.Wait()
+
+		r.reloadMu.Lock()
+		defer r.reloadMu.Unlock()
+		r.mu.Lock()
+		g := r.current
+		r.mu.Unlock()
+		g.inflight.Wait()
+		Close(g.p)
+	})
+}
+
+func (r *Reloader) watch() {
+	defer r.wg.Done()
+
+	// reload once the files have not changed for the reload delay
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-r.done:
+			return
+		case ev, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			if !r.files[filepath.Clean(ev.Name)] {
+				continue
+			}
+			if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			timer = time.After(r.delay)
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.WithField("model", r.model).WithError(err).Warn("file watcher error")
+		case <-timer:
+			timer = nil
+			r.Reload()
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package snpe
+
+import "testing"
+
+func TestReloadAfterClose(t *testing.T) {
+	r := &Reloader{model: "missing.dlc", done: make(chan struct{})}
+	close(r.done)
+	if err := r.Reload(); err != ErrReloaderClosed {
+		t.Errorf("error = %v, want %v", err, ErrReloaderClosed)
+	}
+	if r.Generation() != 0 {
+		t.Error("a closed reloader swapped in a new predictor")
+	}
+}
@@ -0,0 +1,275 @@
+package snpe
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/rai-project/dlframework"
+	"github.com/rai-project/dlframework/framework/feature"
+)
+
+// SegmentationOptions configures the decoding of segmentation score maps
+type SegmentationOptions struct {
+	// output tensor name, defaults to the first output
+	Output string
+	// size of the source image the mask is resized to, 0 keeps the network size
+	Width  int
+	Height int
+	// colors indexed by class, defaults to the Pascal VOC palette
+	Palette color.Palette
+	// labels indexed by class, defaults to the label file of the predictor
+	Labels []string
+	// batch size of the network, defaults to the predictor batch size and to
+	// 1 when tensors are decoded directly. A 3-D output whose first dimension
+	// equals it holds batch, height, width class indices.
+	Batch int
+}
+
+// ClassStats are the pixel statistics of a class in a mask
+type ClassStats struct {
+	Index  int    `json:"index"`
+	Label  string `json:"label"`
+	Pixels int    `json:"pixels"`
+	// share of the pixels of the mask
+	Fraction float32 `json:"fraction"`
+	// mean score of the pixels assigned to the class at the network size
+	MeanScore float32 `json:"mean_score"`
+}
+
+// Segmentation is the per pixel class mask of an image
+type Segmentation struct {
+	Width  int
+	Height int
+	// class index of every pixel in row major order
+	Mask []int
+	// statistics of the classes present in the mask, by class index
+	Classes []ClassStats
+}
+
+// Decode the segmentation masks of the last inference into image features
+func ReadSegmentationOutput(p *PredictorData, opts SegmentationOptions) ([]dlframework.Features, error) {
+	tensors, err := ReadOutputTensors(p)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Labels, err = predictorLabels(p, opts.Labels); err != nil {
+		return nil, err
+	}
+	if opts.Batch <= 0 {
+		opts.Batch = p.batch
+	}
+	segs, err := DecodeSegmentation(tensors, opts)
+	if err != nil {
+		return nil, err
+	}
+	features := make([]dlframework.Features, len(segs))
+	for ii, s := range segs {
+		f, err := SegmentationFeature(s, opts.Palette)
+		if err != nil {
+			return nil, err
+		}
+		features[ii] = dlframework.Features{f}
+	}
+	return features, nil
+}
+
+// Decode [batch,] height, width, classes score maps into class masks. A
+// single channel output, or a batch, height, width output, is taken as
+// class indices already.
+func DecodeSegmentation(tensors []Tensor, opts SegmentationOptions) ([]*Segmentation, error) {
+	if len(tensors) == 0 {
+		return nil, errors.New("no output tensors")
+	}
+	t := &tensors[0]
+	if opts.Output != "" {
+		var err error
+		if t, err = FindTensor(tensors, opts.Output); err != nil {
+			return nil, err
+		}
+	}
+
+	batchSize := opts.Batch
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	var batch, height, width, classes int
+	switch len(t.Shape) {
+	case 3:
+		if t.Shape[0] == batchSize {
+			// argmax already applied by the network
+			batch, height, width, classes = t.Shape[0], t.Shape[1], t.Shape[2], 1
+		} else {
+			batch, height, width, classes = 1, t.Shape[0], t.Shape[1], t.Shape[2]
+		}
+	case 4:
+		batch, height, width, classes = t.Shape[0], t.Shape[1], t.Shape[2], t.Shape[3]
+	default:
+		return nil, errors.Errorf("segmentation output %s must be [batch,] height, width[, classes], got %v", t.Name, t.Shape)
+	}
+	if len(t.Data) < batch*height*width*classes {
+		return nil, errors.Errorf("segmentation output %s is smaller than its shape %v", t.Name, t.Shape)
+	}
+
+	res := make([]*Segmentation, batch)
+	for b := 0; b < batch; b++ {
+		scores := t.Data[b*height*width*classes : (b+1)*height*width*classes]
+		mask, best := argmaxMask(scores, height*width, classes)
+		s := &Segmentation{
+			Width:  width,
+			Height: height,
+			Mask:   mask,
+		}
+
+		// mean scores are only meaningful at the network size
+		numClasses := classes
+		if classes == 1 {
+			numClasses = maxIndex(mask) + 1
+		}
+		sums := make([]float64, numClasses)
+		for ii, c := range mask {
+			sums[c] += float64(best[ii])
+		}
+
+		if opts.Width > 0 && opts.Height > 0 && (opts.Width != width || opts.Height != height) {
+			s.Mask = resizeMask(mask, width, height, opts.Width, opts.Height)
+			s.Width, s.Height = opts.Width, opts.Height
+		}
+
+		counts := make([]int, numClasses)
+		for _, c := range s.Mask {
+			counts[c]++
+		}
+		// pixel counts change with the resize, so averages use the network size
+		netCounts := make([]int, numClasses)
+		for _, c := range mask {
+			netCounts[c]++
+		}
+		for c, n := range counts {
+			if n == 0 {
+				continue
+			}
+			s.Classes = append(s.Classes, ClassStats{
+				Index:     c,
+				Label:     labelAt(opts.Labels, c),
+				Pixels:    n,
+				Fraction:  float32(n) / float32(len(s.Mask)),
+				MeanScore: float32(sums[c] / float64(netCounts[c])),
+			})
+		}
+		res[b] = s
+	}
+	return res, nil
+}
+
+// Encode the mask as a paletted PNG, classes past the palette wrap around
+func (s *Segmentation) PNG(palette color.Palette) ([]byte, error) {
+	if len(palette) == 0 {
+		palette = DefaultSegmentationPalette()
+	}
+	if len(palette) > 256 {
+		return nil, errors.Errorf("the palette has %d colors, at most 256 are supported", len(palette))
+	}
+	img := image.NewPaletted(image.Rect(0, 0, s.Width, s.Height), palette)
+	for ii, c := range s.Mask {
+		img.Pix[ii] = uint8(c % len(palette))
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, errors.Wrap(err, "failed to encode the segmentation mask")
+	}
+	return buf.Bytes(), nil
+}
+
+// Image feature of a segmentation mask, the size and class statistics are kept in the metadata
+func SegmentationFeature(s *Segmentation, palette color.Palette) (*dlframework.Feature, error) {
+	data, err := s.PNG(palette)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := json.Marshal(s.Classes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode the class statistics")
+	}
+	return feature.New(
+		feature.Image(&dlframework.Image{
+			Data: data,
+		}),
+		feature.AppendMetadata("format", "png"),
+		feature.AppendMetadata("width", strconv.Itoa(s.Width)),
+		feature.AppendMetadata("height", strconv.Itoa(s.Height)),
+		feature.AppendMetadata("classes", string(stats)),
+	), nil
+}
+
+// Pascal VOC color map: the bits of the class index are spread over the
+// high bits of the red, green and blue channels
+func DefaultSegmentationPalette() color.Palette {
+	palette := make(color.Palette, 256)
+	for ii := range palette {
+		var r, g, b uint8
+		c := ii
+		for jj := uint(0); jj < 8; jj++ {
+			r |= uint8((c>>0)&1) << (7 - jj)
+			g |= uint8((c>>1)&1) << (7 - jj)
+			b |= uint8((c>>2)&1) << (7 - jj)
+			c >>= 3
+		}
+		palette[ii] = color.RGBA{R: r, G: g, B: b, A: 255}
+	}
+	return palette
+}
+
+// Class with the highest score of every pixel along with that score
+func argmaxMask(scores []float32, pixels, classes int) ([]int, []float32) {
+	mask := make([]int, pixels)
+	best := make([]float32, pixels)
+	for ii := 0; ii < pixels; ii++ {
+		row := scores[ii*classes : (ii+1)*classes]
+		if classes == 1 {
+			mask[ii] = int(row[0])
+			if mask[ii] < 0 {
+				mask[ii] = 0
+			}
+			best[ii] = 1
+			continue
+		}
+		arg := 0
+		for c, v := range row {
+			if v > row[arg] {
+				arg = c
+			}
+		}
+		mask[ii] = arg
+		best[ii] = row[arg]
+	}
+	return mask, best
+}
+
+// Nearest neighbour resize, interpolating class indices makes no sense
+func resizeMask(mask []int, width, height, newWidth, newHeight int) []int {
+	res := make([]int, newWidth*newHeight)
+	for y := 0; y < newHeight; y++ {
+		sy := y * height / newHeight
+		for x := 0; x < newWidth; x++ {
+			sx := x * width / newWidth
+			res[y*newWidth+x] = mask[sy*width+sx]
+		}
+	}
+	return res
+}
+
+func maxIndex(mask []int) int {
+	max := 0
+	for _, c := range mask {
+		if c > max {
+			max = c
+		}
+	}
+	return max
+}
@@ -0,0 +1,254 @@
+package snpe
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DropPolicy decides which frames are skipped when inference cannot keep
+// up with the frame rate
+type DropPolicy int
+
+const (
+	// drop the oldest buffered frame for the incoming one, latest frame wins
+	DropOldest DropPolicy = iota
+	// drop incoming frames while the buffer is full
+	DropNewest
+	// run every Nth frame only, a sampled frame arriving while the buffer is
+	// full replaces the oldest one like DropOldest
+	EveryNth
+)
+
+func (d DropPolicy) String() string {
+	switch d {
+	case DropOldest:
+		return "drop_oldest"
+	case DropNewest:
+		return "drop_newest"
+	case EveryNth:
+		return "every_nth"
+	}
+	return "unknown"
+}
+
+// Upper bounds in milliseconds of the latency histogram buckets
+var latencyBounds = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000}
+
+// StreamOptions configures a Stream
+type StreamOptions struct {
+	Policy DropPolicy
+	// number of frames waiting for inference, defaults to 1
+	Buffer int
+	// sampling interval of EveryNth, defaults to 1
+	N int
+	// whether frames are passed to the model as quantized data
+	Quantize bool
+}
+
+// Frame is an input of a stream
+type Frame struct {
+	// sequence number chosen by the producer
+	ID   uint64
+	Data []byte
+	// capture time, the time the frame is received when zero
+	Timestamp time.Time
+}
+
+// FrameResult is the inference result of a frame
+type FrameResult struct {
+	Frame   Frame
+	Outputs []Tensor
+	Err     error
+	// time from the frame timestamp to the result
+	Latency time.Duration
+	// time spent in inference
+	Inference time.Duration
+}
+
+// StreamStats reports the frames seen by a Stream
+type StreamStats struct {
+	Received  uint64 `json:"received"`
+	Processed uint64 `json:"processed"`
+	Dropped   uint64 `json:"dropped"`
+	// per-frame latency in milliseconds
+	Latency HistogramSnapshot `json:"latency"`
+}
+
+// Stream runs inference on the frames of a channel, skipping frames
+// according to its drop policy, and emits results in frame order
+type Stream struct {
+	p    *PredictorData
+	opts StreamOptions
+
+	results chan FrameResult
+	mu      sync.Mutex
+	buffer  []Frame
+	// signaled when a frame is buffered
+	ready chan struct{}
+	eof   bool
+
+	received    uint64
+	processed   uint64
+	dropped     uint64
+	latencyHist *Histogram
+}
+
+// Start streaming inference on the frames until the channel is closed or
+// the context is done, the results channel is closed afterwards. Results are
+// not dropped, a slow reader of the results slows down inference.
+func StartStream(ctx context.Context, p *PredictorData, frames <-chan Frame, opts StreamOptions) (*Stream, error) {
+	if p == nil {
+		return nil, errors.New("empty predictor")
+	}
+	if opts.Policy < DropOldest || opts.Policy > EveryNth {
+		return nil, errors.Errorf("unknown drop policy %d", opts.Policy)
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 1
+	}
+	if opts.N <= 0 {
+		opts.N = 1
+	}
+	s := &Stream{
+		p:           p,
+		opts:        opts,
+		results:     make(chan FrameResult),
+		ready:       make(chan struct{}, 1),
+		latencyHist: NewHistogram(latencyBounds...),
+	}
+	go s.read(ctx, frames)
+	go s.loop(ctx)
+	return s, nil
+}
+
+// Results of the processed frames
+func (s *Stream) Results() <-chan FrameResult {
+	return s.results
+}
+
+// Report frame counts and latencies
+func (s *Stream) Stats() StreamStats {
+	return StreamStats{
+		Received:  atomic.LoadUint64(&s.received),
+		Processed: atomic.LoadUint64(&s.processed),
+		Dropped:   atomic.LoadUint64(&s.dropped),
+		Latency:   s.latencyHist.Snapshot(),
+	}
+}
+
+func (s *Stream) read(ctx context.Context, frames <-chan Frame) {
+	defer func() {
+		s.mu.Lock()
+		s.eof = true
+		s.mu.Unlock()
+		signal(s.ready)
+	}()
+
+	var count uint64
+	for {
+		var frame Frame
+		var ok bool
+		select {
+		case frame, ok = <-frames:
+			if !ok {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+		if frame.Timestamp.IsZero() {
+			frame.Timestamp = time.Now()
+		}
+		atomic.AddUint64(&s.received, 1)
+		count++
+
+		if s.opts.Policy == EveryNth && (count-1)%uint64(s.opts.N) != 0 {
+			atomic.AddUint64(&s.dropped, 1)
+			continue
+		}
+		s.push(frame)
+	}
+}
+
+// Buffer a frame following the drop policy, the input is never blocked so
+// the frames keep being counted and sampled while inference falls behind
+func (s *Stream) push(frame Frame) {
+	s.mu.Lock()
+	if len(s.buffer) < s.opts.Buffer {
+		s.buffer = append(s.buffer, frame)
+		s.mu.Unlock()
+		signal(s.ready)
+		return
+	}
+	if s.opts.Policy != DropNewest {
+		copy(s.buffer, s.buffer[1:])
+		s.buffer[len(s.buffer)-1] = frame
+	}
+	s.mu.Unlock()
+	atomic.AddUint64(&s.dropped, 1)
+}
+
+// Take the next buffered frame, returns false once the input is exhausted
+func (s *Stream) pop(ctx context.Context) (Frame, bool) {
+	for {
+		s.mu.Lock()
+		if len(s.buffer) > 0 {
+			frame := s.buffer[0]
+			s.buffer = s.buffer[1:]
+			s.mu.Unlock()
+			return frame, true
+		}
+		eof := s.eof
+		s.mu.Unlock()
+		if eof {
+			return Frame{}, false
+		}
+
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			return Frame{}, false
+		}
+	}
+}
+
+func (s *Stream) loop(ctx context.Context) {
+	defer close(s.results)
+	for {
+		frame, ok := s.pop(ctx)
+		if !ok {
+			return
+		}
+
+		start := time.Now()
+		outputs, err := predictTensors(s.p, frame.Data, s.opts.Quantize)
+		now := time.Now()
+		res := FrameResult{
+			Frame:     frame,
+			Outputs:   outputs,
+			Err:       err,
+			Latency:   now.Sub(frame.Timestamp),
+			Inference: now.Sub(start),
+		}
+		atomic.AddUint64(&s.processed, 1)
+		s.latencyHist.Observe(float64(res.Latency) / float64(time.Millisecond))
+
+		select {
+		case s.results <- res:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Non blocking notification on a channel of capacity 1
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,54 @@
+package snpe
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// Stream reading the frames without an inference loop, as if it had stalled
+func readStalled(opts StreamOptions, ids ...uint64) *Stream {
+	s := &Stream{opts: opts, ready: make(chan struct{}, 1), latencyHist: NewHistogram(latencyBounds...)}
+	frames := make(chan Frame, len(ids))
+	for _, id := range ids {
+		frames <- Frame{ID: id}
+	}
+	close(frames)
+	s.read(context.Background(), frames)
+	return s
+}
+
+func bufferedIDs(s *Stream) []uint64 {
+	var res []uint64
+	for _, frame := range s.buffer {
+		res = append(res, frame.ID)
+	}
+	return res
+}
+
+func TestStreamDropPolicies(t *testing.T) {
+	cases := []struct {
+		opts    StreamOptions
+		want    []uint64
+		dropped uint64
+	}{
+		{StreamOptions{Policy: DropOldest, Buffer: 2, N: 1}, []uint64{4, 5}, 3},
+		{StreamOptions{Policy: DropNewest, Buffer: 2, N: 1}, []uint64{1, 2}, 3},
+		// frames 1, 3 and 5 are sampled, the input is not blocked by the full buffer
+		{StreamOptions{Policy: EveryNth, Buffer: 1, N: 2}, []uint64{5}, 4},
+		{StreamOptions{Policy: EveryNth, Buffer: 2, N: 2}, []uint64{3, 5}, 3},
+	}
+	for _, c := range cases {
+		s := readStalled(c.opts, 1, 2, 3, 4, 5)
+		if got := bufferedIDs(s); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: buffered %v, want %v", c.opts.Policy, got, c.want)
+		}
+		stats := s.Stats()
+		if stats.Received != 5 || stats.Dropped != c.dropped {
+			t.Errorf("%v: received %d dropped %d, want 5 and %d", c.opts.Policy, stats.Received, stats.Dropped, c.dropped)
+		}
+		if !s.eof {
+			t.Errorf("%v: the end of the input was not recorded", c.opts.Policy)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package snpe
+
+import "github.com/pkg/errors"
+
+// Tensor is a named output of the network
+type Tensor struct {
+	Name  string    `json:"name"`
+	Shape []int     `json:"shape"`
+	Data  []float32 `json:"data"`
+}
+
+// Find a tensor by name
+func FindTensor(tensors []Tensor, name string) (*Tensor, error) {
+	for ii := range tensors {
+		if tensors[ii].Name == name {
+			return &tensors[ii], nil
+		}
+	}
+	return nil, errors.Errorf("output tensor %s not found", name)
+}
+
+// Size of the innermost dimension, or 0 for scalars
+func (t *Tensor) lastDim() int {
+	if len(t.Shape) == 0 {
+		return 0
+	}
+	return t.Shape[len(t.Shape)-1]
+}
@@ -0,0 +1,225 @@
+package snpe
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abhiutd/snpe-predictor/tokenizer"
+	"github.com/pkg/errors"
+	"github.com/rai-project/dlframework"
+	"github.com/rai-project/dlframework/framework/feature"
+)
+
+// TextOptions names the inputs of a text model. When empty they are found
+// by their usual names: input_ids, input_mask or attention_mask, and
+// segment_ids or token_type_ids, ignoring a scope prefix and a port suffix
+// such as bert/input_ids:0. Inputs the network does not have are not fed.
+type TextOptions struct {
+	InputIDs      string
+	AttentionMask string
+	SegmentIDs    string
+}
+
+// AnswerOptions configures the extraction of answer spans
+type AnswerOptions struct {
+	// start and end logit outputs, found by name (start, end) when empty
+	Start string
+	End   string
+	// longest answer in tokens, defaults to 30
+	MaxAnswerLen int
+	// number of answers returned, defaults to 1
+	TopK int
+}
+
+// Tokenize text, and an optional pair such as question and context, to
+// the sequence length of the model and run inference on it
+func PredictText(p *PredictorData, t tokenizer.Tokenizer, text, pair string, opts TextOptions) (*tokenizer.Encoding, error) {
+	inputs := Inputs(p)
+	if inputs == nil {
+		return nil, errors.Errorf("predictor is %s", p.State())
+	}
+	ids, err := textInput(inputs, opts.InputIDs, inputIDsNames)
+	if err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		return nil, errors.New("no input ids tensor found")
+	}
+	seqLen := ids.lastDim()
+
+	enc, err := tokenizer.Encode(t, text, pair, seqLen)
+	if err != nil {
+		return nil, err
+	}
+	if enc.Truncated {
+		log.WithField("length", seqLen).Debug("text truncated to the sequence length of the model")
+	}
+
+	feeds := []struct {
+		name   string
+		names  []string
+		values []int
+	}{
+		{opts.InputIDs, inputIDsNames, enc.InputIDs},
+		{opts.AttentionMask, attentionMaskNames, enc.AttentionMask},
+		{opts.SegmentIDs, segmentIDsNames, enc.SegmentIDs},
+	}
+	var tensors []Tensor
+	fed := map[string]bool{}
+	for _, f := range feeds {
+		in, err := textInput(inputs, f.name, f.names)
+		if err != nil {
+			return nil, err
+		}
+		if in == nil || fed[in.Name] {
+			continue
+		}
+		if shapeSize(in.Shape) != len(f.values) {
+			return nil, errors.Errorf("input %s of shape %v does not hold a single sequence of %d tokens", in.Name, in.Shape, len(f.values))
+		}
+		data := make([]float32, len(f.values))
+		for ii, v := range f.values {
+			data[ii] = float32(v)
+		}
+		tensors = append(tensors, Tensor{Name: in.Name, Shape: in.Shape, Data: data})
+		fed[in.Name] = true
+	}
+
+	if err := PredictInputs(p, tensors); err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+// Usual names of the inputs of BERT style models
+var (
+	inputIDsNames      = []string{"input_ids"}
+	attentionMaskNames = []string{"input_mask", "attention_mask"}
+	segmentIDsNames    = []string{"segment_ids", "token_type_ids"}
+)
+
+// Input of the given name, or else the input whose name is one of the
+// usual names, nil when there is none
+func textInput(inputs []Tensor, name string, names []string) (*Tensor, error) {
+	if name != "" {
+		return FindTensor(inputs, name)
+	}
+	for ii := range inputs {
+		base := strings.ToLower(inputs[ii].Name)
+		if i := strings.LastIndex(base, "/"); i >= 0 {
+			base = base[i+1:]
+		}
+		if i := strings.LastIndex(base, ":"); i >= 0 {
+			base = base[:i]
+		}
+		for _, n := range names {
+			if base == n {
+				return &inputs[ii], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Classification features of the logits of a sequence classification
+// model, sorted by decreasing probability
+func ReadSequenceClassificationOutput(p *PredictorData, labels []string) (dlframework.Features, error) {
+	tensors, err := ReadOutputTensors(p)
+	if err != nil {
+		return nil, err
+	}
+	if labels, err = predictorLabels(p, labels); err != nil {
+		return nil, err
+	}
+	if len(tensors) == 0 || len(tensors[0].Data) == 0 {
+		return nil, errors.New("no sequence classification logits")
+	}
+
+	probs := make([]float32, len(tensors[0].Data))
+	softmax(probs, tensors[0].Data)
+	features := make(dlframework.Features, len(probs))
+	for ii, prob := range probs {
+		features[ii] = feature.New(
+			feature.ClassificationIndex(int32(ii)),
+			feature.ClassificationLabel(labelAt(labels, ii)),
+			feature.Probability(prob),
+		)
+	}
+	sort.Sort(features)
+	return features, nil
+}
+
+// Extract the best answer spans of a question answering model from the
+// context, the pair text of the encoding. The answers are text features
+// with the token range in their metadata.
+func ReadAnswerOutput(p *PredictorData, t tokenizer.Tokenizer, enc *tokenizer.Encoding, opts AnswerOptions) (dlframework.Features, error) {
+	tensors, err := ReadOutputTensors(p)
+	if err != nil {
+		return nil, err
+	}
+	start, err := findTensor(tensors, opts.Start, "start")
+	if err != nil {
+		return nil, err
+	}
+	end, err := findTensor(tensors, opts.End, "end")
+	if err != nil {
+		return nil, err
+	}
+	n := len(enc.Tokens)
+	if len(enc.Sequence) != n {
+		return nil, errors.New("the encoding does not tell the texts apart, use tokenizer.Encode")
+	}
+	if len(start.Data) < n || len(end.Data) < n {
+		return nil, errors.Errorf("answer logits do not cover the %d tokens of the sequence", n)
+	}
+	if opts.MaxAnswerLen <= 0 {
+		opts.MaxAnswerLen = 30
+	}
+	if opts.TopK <= 0 {
+		opts.TopK = 1
+	}
+
+	// only tokens of the context can be part of the answer
+	inContext := func(ii int) bool {
+		return enc.Sequence[ii] == 1
+	}
+	startProbs := make([]float32, n)
+	endProbs := make([]float32, n)
+	softmax(startProbs, start.Data[:n])
+	softmax(endProbs, end.Data[:n])
+
+	type span struct {
+		start, end int
+		score      float32
+	}
+	var spans []span
+	for s := 0; s < n; s++ {
+		if !inContext(s) {
+			continue
+		}
+		for e := s; e < n && e-s < opts.MaxAnswerLen && inContext(e); e++ {
+			spans = append(spans, span{s, e, startProbs[s] * endProbs[e]})
+		}
+	}
+	sort.SliceStable(spans, func(ii, jj int) bool {
+		return spans[ii].score > spans[jj].score
+	})
+	if len(spans) > opts.TopK {
+		spans = spans[:opts.TopK]
+	}
+
+	features := make(dlframework.Features, len(spans))
+	for ii, s := range spans {
+		answer := t.Detokenize(enc.Tokens[s.start : s.end+1])
+		features[ii] = feature.New(
+			feature.Text(&dlframework.Text{
+				Data: []byte(strings.TrimSpace(answer)),
+			}),
+			feature.Probability(s.score),
+			feature.AppendMetadata("start_token", strconv.Itoa(s.start)),
+			feature.AppendMetadata("end_token", strconv.Itoa(s.end)),
+		)
+	}
+	return features, nil
+}
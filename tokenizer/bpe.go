@@ -0,0 +1,192 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Pre tokenization of GPT-2, without the lookahead Go regexps do not support
+var bpeWordPattern = regexp.MustCompile(`'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+`)
+
+// BPE is the byte level byte-pair encoding tokenizer of GPT-2 and RoBERTa
+// models. Text is mapped to bytes, every byte to a printable rune, and the
+// runes of every word are merged by the rank of the merge rules.
+type BPE struct {
+	vocab   *Vocab
+	special SpecialTokens
+	ranks   map[[2]string]int
+
+	byteRunes map[byte]rune
+	runeBytes map[rune]byte
+
+	mu    sync.Mutex
+	cache map[string][]string
+}
+
+// Create BPE tokenizer from a vocabulary and merge rules ordered by priority
+func NewBPE(vocab *Vocab, merges [][2]string) *BPE {
+	b := &BPE{
+		vocab:     vocab,
+		special:   RobertaSpecialTokens,
+		ranks:     make(map[[2]string]int, len(merges)),
+		byteRunes: map[byte]rune{},
+		runeBytes: map[rune]byte{},
+		cache:     map[string][]string{},
+	}
+	for ii, m := range merges {
+		if _, ok := b.ranks[m]; !ok {
+			b.ranks[m] = ii
+		}
+	}
+
+	// printable bytes map to themselves, the others to runes past 255
+	n := 0
+	for c := 0; c < 256; c++ {
+		r := rune(c)
+		if !((c >= '!' && c <= '~') || (c >= 0xA1 && c <= 0xAC) || (c >= 0xAE && c <= 0xFF)) {
+			r = rune(256 + n)
+			n++
+		}
+		b.byteRunes[byte(c)] = r
+		b.runeBytes[r] = byte(c)
+	}
+	return b
+}
+
+// Read a JSON vocabulary of token ids and a merges file
+func LoadBPE(vocabFile, mergesFile string) (*BPE, error) {
+	buf, err := ioutil.ReadFile(vocabFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read vocabulary %s", vocabFile)
+	}
+	var ids map[string]int
+	if err := json.Unmarshal(buf, &ids); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse vocabulary %s", vocabFile)
+	}
+	size := 0
+	for _, id := range ids {
+		if id < 0 {
+			return nil, errors.Errorf("negative token id %d in %s", id, vocabFile)
+		}
+		if id >= size {
+			size = id + 1
+		}
+	}
+	tokens := make([]string, size)
+	for t, id := range ids {
+		tokens[id] = t
+	}
+
+	f, err := os.Open(mergesFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open merges %s", mergesFile)
+	}
+	defer f.Close()
+	var merges [][2]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// the first line is a version header
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		merges = append(merges, [2]string{fields[0], fields[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read merges %s", mergesFile)
+	}
+	return NewBPE(NewVocab(tokens), merges), nil
+}
+
+func (b *BPE) Vocab() *Vocab {
+	return b.vocab
+}
+
+func (b *BPE) Special() SpecialTokens {
+	return b.special
+}
+
+// Split text into words and merge the bytes of every word
+func (b *BPE) Tokenize(text string) []string {
+	var tokens []string
+	for _, word := range bpeWordPattern.FindAllString(text, -1) {
+		var runes []rune
+		for _, c := range []byte(word) {
+			runes = append(runes, b.byteRunes[c])
+		}
+		for _, t := range b.merge(string(runes)) {
+			if _, ok := b.vocab.ID(t); !ok {
+				t = b.special.Unknown
+			}
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+// Map the runes of the tokens back to bytes
+func (b *BPE) Detokenize(tokens []string) string {
+	var buf []byte
+	for _, t := range tokens {
+		for _, r := range t {
+			if c, ok := b.runeBytes[r]; ok {
+				buf = append(buf, c)
+			}
+		}
+	}
+	return string(buf)
+}
+
+// Merge the pair of symbols with the lowest rank until no rule applies
+func (b *BPE) merge(word string) []string {
+	b.mu.Lock()
+	cached, ok := b.cache[word]
+	b.mu.Unlock()
+	if ok {
+		return cached
+	}
+
+	var symbols []string
+	for _, r := range word {
+		symbols = append(symbols, string(r))
+	}
+	for len(symbols) > 1 {
+		best, bestRank := -1, 0
+		for ii := 0; ii+1 < len(symbols); ii++ {
+			rank, ok := b.ranks[[2]string{symbols[ii], symbols[ii+1]}]
+			if ok && (best < 0 || rank < bestRank) {
+				best, bestRank = ii, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		pair := [2]string{symbols[best], symbols[best+1]}
+		merged := symbols[:0:0]
+		for ii := 0; ii < len(symbols); ii++ {
+			if ii+1 < len(symbols) && symbols[ii] == pair[0] && symbols[ii+1] == pair[1] {
+				merged = append(merged, pair[0]+pair[1])
+				ii++
+				continue
+			}
+			merged = append(merged, symbols[ii])
+		}
+		symbols = merged
+	}
+
+	b.mu.Lock()
+	b.cache[word] = symbols
+	b.mu.Unlock()
+	return symbols
+}
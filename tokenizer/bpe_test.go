@@ -0,0 +1,84 @@
+package tokenizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Vocabulary of every byte rune along with the merges of "hello world"
+func testBPE() *BPE {
+	b := NewBPE(NewVocab(nil), nil)
+	tokens := []string{"<s>", "</s>", "<pad>", "<unk>"}
+	for c := 0; c < 256; c++ {
+		tokens = append(tokens, string(b.byteRunes[byte(c)]))
+	}
+	merges := [][2]string{
+		{"h", "e"}, {"l", "l"}, {"he", "ll"}, {"hell", "o"},
+		{"Ġ", "w"}, {"o", "r"}, {"Ġw", "or"}, {"Ġwor", "l"}, {"Ġworl", "d"},
+	}
+	for _, m := range merges {
+		tokens = append(tokens, m[0]+m[1])
+	}
+	return NewBPE(NewVocab(tokens), merges)
+}
+
+func TestBPETokenize(t *testing.T) {
+	b := testBPE()
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"hello world", []string{"hello", "Ġworld"}},
+		{"hello, world's", []string{"hello", ",", "Ġworld", "'", "s"}},
+		{"hold", []string{"h", "o", "l", "d"}},
+	}
+	for _, c := range cases {
+		if got := b.Tokenize(c.text); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestBPEUnknownToken(t *testing.T) {
+	// a vocabulary without byte runes maps unmerged symbols to the unknown token
+	b := NewBPE(NewVocab([]string{"<unk>", "hello"}), [][2]string{
+		{"h", "e"}, {"l", "l"}, {"he", "ll"}, {"hell", "o"},
+	})
+	if got, want := b.Tokenize("hello x"), []string{"hello", "<unk>", "<unk>"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize = %q, want %q", got, want)
+	}
+}
+
+func TestBPERoundTrip(t *testing.T) {
+	b := testBPE()
+	for _, text := range []string{
+		"hello world",
+		"  leading and trailing spaces  ",
+		"tabs\tand\nnewlines\r\n",
+		"héllo wörld, 你好 🙂",
+		"numbers 12345 and symbols #$%&",
+		"control \x00\x01\x7f bytes",
+	} {
+		if got := b.Detokenize(b.Tokenize(text)); got != text {
+			t.Errorf("Detokenize(Tokenize(%q)) = %q", text, got)
+		}
+	}
+}
+
+func TestBPEByteRunes(t *testing.T) {
+	b := testBPE()
+	seen := map[rune]bool{}
+	for c := 0; c < 256; c++ {
+		r := b.byteRunes[byte(c)]
+		if seen[r] {
+			t.Fatalf("byte %d maps to the rune %q of another byte", c, r)
+		}
+		seen[r] = true
+		if b.runeBytes[r] != byte(c) {
+			t.Fatalf("rune %q maps back to %d instead of %d", r, b.runeBytes[r], c)
+		}
+	}
+	if r := b.byteRunes[' ']; r != 'Ġ' {
+		t.Errorf("space maps to %q, want Ġ", r)
+	}
+}
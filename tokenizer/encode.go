@@ -0,0 +1,94 @@
+package tokenizer
+
+import "github.com/pkg/errors"
+
+// Encoding is a tokenized sequence padded to the sequence length of a model
+type Encoding struct {
+	Tokens        []string
+	InputIDs      []int
+	AttentionMask []int
+	// token type ids, the tokens of the pair get the PairSegment of the special tokens
+	SegmentIDs []int
+	// text each token comes from: 0 for the first text, 1 for the pair and
+	// -1 for special tokens and padding
+	Sequence []int
+	// the texts did not fit into the sequence length
+	Truncated bool
+}
+
+// Encode a text, and optionally a second text, as
+// [CLS] text [SEP] pair [SEP] followed by padding up to maxLen tokens.
+// The separators between the texts and the segment ids of the pair come
+// from the special tokens of the tokenizer. The longer text is truncated
+// first when they do not fit.
+func Encode(t Tokenizer, text, pair string, maxLen int) (*Encoding, error) {
+	special := t.Special()
+	separators := special.PairSeparators
+	if separators < 1 {
+		separators = 1
+	}
+	a := t.Tokenize(text)
+	var b []string
+	reserved := 2
+	if pair != "" {
+		b = t.Tokenize(pair)
+		reserved = 2 + separators
+	}
+	if maxLen <= reserved {
+		return nil, errors.Errorf("sequence length %d is too short", maxLen)
+	}
+
+	truncated := false
+	for len(a)+len(b)+reserved > maxLen {
+		truncated = true
+		if len(a) >= len(b) {
+			a = a[:len(a)-1]
+		} else {
+			b = b[:len(b)-1]
+		}
+	}
+
+	enc := &Encoding{Truncated: truncated}
+	add := func(token string, segment, sequence int) {
+		enc.Tokens = append(enc.Tokens, token)
+		enc.AttentionMask = append(enc.AttentionMask, 1)
+		enc.SegmentIDs = append(enc.SegmentIDs, segment)
+		enc.Sequence = append(enc.Sequence, sequence)
+	}
+	add(special.Classify, 0, -1)
+	for _, token := range a {
+		add(token, 0, 0)
+	}
+	add(special.Separate, 0, -1)
+	if pair != "" {
+		// further separators open the pair
+		for ii := 1; ii < separators; ii++ {
+			add(special.Separate, special.PairSegment, -1)
+		}
+		for _, token := range b {
+			add(token, special.PairSegment, 1)
+		}
+		add(special.Separate, special.PairSegment, -1)
+	}
+	for len(enc.Tokens) < maxLen {
+		enc.Tokens = append(enc.Tokens, special.Pad)
+		enc.AttentionMask = append(enc.AttentionMask, 0)
+		enc.SegmentIDs = append(enc.SegmentIDs, 0)
+		enc.Sequence = append(enc.Sequence, -1)
+	}
+
+	vocab := t.Vocab()
+	unknown, ok := vocab.ID(special.Unknown)
+	if !ok {
+		return nil, errors.Errorf("unknown token %s is not in the vocabulary", special.Unknown)
+	}
+	enc.InputIDs = make([]int, len(enc.Tokens))
+	for ii, token := range enc.Tokens {
+		id, ok := vocab.ID(token)
+		if !ok {
+			id = unknown
+		}
+		enc.InputIDs[ii] = id
+	}
+	return enc, nil
+}
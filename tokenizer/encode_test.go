@@ -0,0 +1,104 @@
+package tokenizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodePair(t *testing.T) {
+	w := testWordPiece(true)
+	enc, err := Encode(w, "quick fox", "the fox", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTokens := []string{"[CLS]", "quick", "fox", "[SEP]", "the", "fox", "[SEP]", "[PAD]", "[PAD]", "[PAD]"}
+	if !reflect.DeepEqual(enc.Tokens, wantTokens) {
+		t.Errorf("Tokens = %q, want %q", enc.Tokens, wantTokens)
+	}
+	if want := []int{2, 8, 10, 3, 4, 10, 3, 0, 0, 0}; !reflect.DeepEqual(enc.InputIDs, want) {
+		t.Errorf("InputIDs = %v, want %v", enc.InputIDs, want)
+	}
+	if want := []int{1, 1, 1, 1, 1, 1, 1, 0, 0, 0}; !reflect.DeepEqual(enc.AttentionMask, want) {
+		t.Errorf("AttentionMask = %v, want %v", enc.AttentionMask, want)
+	}
+	if want := []int{0, 0, 0, 0, 1, 1, 1, 0, 0, 0}; !reflect.DeepEqual(enc.SegmentIDs, want) {
+		t.Errorf("SegmentIDs = %v, want %v", enc.SegmentIDs, want)
+	}
+	if want := []int{-1, 0, 0, -1, 1, 1, -1, -1, -1, -1}; !reflect.DeepEqual(enc.Sequence, want) {
+		t.Errorf("Sequence = %v, want %v", enc.Sequence, want)
+	}
+	if enc.Truncated {
+		t.Error("sequence reported as truncated")
+	}
+}
+
+func TestEncodeRobertaPair(t *testing.T) {
+	b := testBPE()
+	enc, err := Encode(b, "hello", "hello", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RoBERTa separates the texts with two separators and has a single token type
+	wantTokens := []string{"<s>", "hello", "</s>", "</s>", "hello", "</s>", "<pad>", "<pad>"}
+	if !reflect.DeepEqual(enc.Tokens, wantTokens) {
+		t.Errorf("Tokens = %q, want %q", enc.Tokens, wantTokens)
+	}
+	if want := []int{0, 0, 0, 0, 0, 0, 0, 0}; !reflect.DeepEqual(enc.SegmentIDs, want) {
+		t.Errorf("SegmentIDs = %v, want %v", enc.SegmentIDs, want)
+	}
+	if want := []int{1, 1, 1, 1, 1, 1, 0, 0}; !reflect.DeepEqual(enc.AttentionMask, want) {
+		t.Errorf("AttentionMask = %v, want %v", enc.AttentionMask, want)
+	}
+	if want := []int{-1, 0, -1, -1, 1, -1, -1, -1}; !reflect.DeepEqual(enc.Sequence, want) {
+		t.Errorf("Sequence = %v, want %v", enc.Sequence, want)
+	}
+	hello, _ := b.Vocab().ID("hello")
+	if want := []int{0, hello, 1, 1, hello, 1, 2, 2}; !reflect.DeepEqual(enc.InputIDs, want) {
+		t.Errorf("InputIDs = %v, want %v", enc.InputIDs, want)
+	}
+
+	// the four special tokens of a pair are reserved before truncating
+	enc, err = Encode(b, "hello world", "hello", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"<s>", "hello", "</s>", "</s>", "hello", "</s>"}; !reflect.DeepEqual(enc.Tokens, want) || !enc.Truncated {
+		t.Errorf("Tokens = %q, truncated %v, want %q", enc.Tokens, enc.Truncated, want)
+	}
+	if _, err := Encode(b, "hello", "hello", 4); err == nil {
+		t.Error("expected an error for a sequence length without room for tokens")
+	}
+}
+
+func TestEncodeTruncatesLongerText(t *testing.T) {
+	w := testWordPiece(true)
+	cases := []struct {
+		maxLen int
+		want   []string
+	}{
+		{8, []string{"[CLS]", "the", "quick", "brown", "fox", "[SEP]", "fox", "[SEP]"}},
+		{7, []string{"[CLS]", "the", "quick", "brown", "[SEP]", "fox", "[SEP]"}},
+		{5, []string{"[CLS]", "the", "[SEP]", "fox", "[SEP]"}},
+		// texts of the same length shorten the first one
+		{4, []string{"[CLS]", "[SEP]", "fox", "[SEP]"}},
+	}
+	for _, c := range cases {
+		enc, err := Encode(w, "the quick brown fox", "fox", c.maxLen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(enc.Tokens, c.want) {
+			t.Errorf("Encode to %d tokens = %q, want %q", c.maxLen, enc.Tokens, c.want)
+		}
+		if truncated := c.maxLen < 8; enc.Truncated != truncated {
+			t.Errorf("Encode to %d tokens: Truncated = %v, want %v", c.maxLen, enc.Truncated, truncated)
+		}
+	}
+}
+
+func TestEncodeTooShort(t *testing.T) {
+	w := testWordPiece(true)
+	if _, err := Encode(w, "fox", "the", 3); err == nil {
+		t.Error("expected an error for a sequence length without room for tokens")
+	}
+}
@@ -0,0 +1,116 @@
+// Package tokenizer turns text into the token ids expected by NLP models.
+//
+// WordPiece (BERT) vocabularies are a text file with one token per line, the
+// line number being the token id. Byte level BPE (GPT-2, RoBERTa) models are a
+// JSON vocabulary of token ids along with a merges file listing the merge
+// rules by priority.
+package tokenizer
+
+import (
+	"bufio"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Tokenizer splits text into tokens of its vocabulary
+type Tokenizer interface {
+	// Split text into tokens, unknown pieces map to the unknown token
+	Tokenize(text string) []string
+	// Join tokens back into text
+	Detokenize(tokens []string) string
+	Vocab() *Vocab
+	// Special tokens of the model family
+	Special() SpecialTokens
+}
+
+// SpecialTokens frame and pad encoded sequences
+type SpecialTokens struct {
+	Classify string
+	Separate string
+	Pad      string
+	Unknown  string
+	// separators between the two texts of a pair, defaults to 1
+	PairSeparators int
+	// segment id of the second text of a pair, 0 for models with a single token type
+	PairSegment int
+}
+
+// Special tokens of BERT models, a pair is [CLS] a [SEP] b [SEP]
+var BertSpecialTokens = SpecialTokens{
+	Classify:       "[CLS]",
+	Separate:       "[SEP]",
+	Pad:            "[PAD]",
+	Unknown:        "[UNK]",
+	PairSeparators: 1,
+	PairSegment:    1,
+}
+
+// Special tokens of RoBERTa models, a pair is <s> a </s></s> b </s>
+var RobertaSpecialTokens = SpecialTokens{
+	Classify:       "<s>",
+	Separate:       "</s>",
+	Pad:            "<pad>",
+	Unknown:        "<unk>",
+	PairSeparators: 2,
+	PairSegment:    0,
+}
+
+// Vocab maps tokens to ids
+type Vocab struct {
+	ids    map[string]int
+	tokens []string
+}
+
+// Create a vocabulary where the id of a token is its index
+func NewVocab(tokens []string) *Vocab {
+	v := &Vocab{
+		ids:    make(map[string]int, len(tokens)),
+		tokens: make([]string, len(tokens)),
+	}
+	copy(v.tokens, tokens)
+	for ii, t := range tokens {
+		if _, ok := v.ids[t]; !ok {
+			v.ids[t] = ii
+		}
+	}
+	return v
+}
+
+// Read a vocabulary file with one token per line
+func LoadVocab(path string) (*Vocab, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open vocabulary %s", path)
+	}
+	defer f.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		tokens = append(tokens, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read vocabulary %s", path)
+	}
+	return NewVocab(tokens), nil
+}
+
+// Id of a token
+func (v *Vocab) ID(token string) (int, bool) {
+	id, ok := v.ids[token]
+	return id, ok
+}
+
+// Token of an id
+func (v *Vocab) Token(id int) (string, bool) {
+	if id < 0 || id >= len(v.tokens) {
+		return "", false
+	}
+	return v.tokens[id], true
+}
+
+// Number of tokens
+func (v *Vocab) Size() int {
+	return len(v.tokens)
+}
@@ -0,0 +1,172 @@
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Prefix of the word pieces that continue a word
+const continuationPrefix = "##"
+
+// WordPiece is the tokenizer of BERT models
+type WordPiece struct {
+	vocab   *Vocab
+	special SpecialTokens
+	// lower case and strip accents, for uncased models
+	lowerCase bool
+	// longer words map to the unknown token
+	maxWordLen int
+}
+
+// Create WordPiece tokenizer, lowerCase must match the casing of the model
+func NewWordPiece(vocab *Vocab, lowerCase bool) *WordPiece {
+	return &WordPiece{
+		vocab:      vocab,
+		special:    BertSpecialTokens,
+		lowerCase:  lowerCase,
+		maxWordLen: 100,
+	}
+}
+
+// Read the vocabulary file and create WordPiece tokenizer
+func LoadWordPiece(vocabFile string, lowerCase bool) (*WordPiece, error) {
+	vocab, err := LoadVocab(vocabFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewWordPiece(vocab, lowerCase), nil
+}
+
+func (w *WordPiece) Vocab() *Vocab {
+	return w.vocab
+}
+
+func (w *WordPiece) Special() SpecialTokens {
+	return w.special
+}
+
+// Split text into words and punctuation, then every word into the longest
+// pieces found in the vocabulary
+func (w *WordPiece) Tokenize(text string) []string {
+	var tokens []string
+	for _, word := range w.basicTokenize(text) {
+		tokens = append(tokens, w.wordPieces(word)...)
+	}
+	return tokens
+}
+
+// Join word pieces back into text
+func (w *WordPiece) Detokenize(tokens []string) string {
+	var b strings.Builder
+	for ii, t := range tokens {
+		if strings.HasPrefix(t, continuationPrefix) {
+			b.WriteString(t[len(continuationPrefix):])
+			continue
+		}
+		if ii > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t)
+	}
+	return b.String()
+}
+
+func (w *WordPiece) basicTokenize(text string) []string {
+	if w.lowerCase {
+		text = stripAccents(strings.ToLower(text))
+	}
+
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range text {
+		switch {
+		case r == 0 || r == unicode.ReplacementChar || isControl(r):
+			continue
+		case unicode.IsSpace(r):
+			flush()
+		case isPunctuation(r) || isCJK(r):
+			// punctuation and CJK characters are words of their own
+			flush()
+			words = append(words, string(r))
+		default:
+			word = append(word, r)
+		}
+	}
+	flush()
+	return words
+}
+
+// Greedy longest match first
+func (w *WordPiece) wordPieces(word string) []string {
+	runes := []rune(word)
+	if len(runes) > w.maxWordLen {
+		return []string{w.special.Unknown}
+	}
+
+	var pieces []string
+	for start := 0; start < len(runes); {
+		end := len(runes)
+		piece := ""
+		for ; end > start; end-- {
+			candidate := string(runes[start:end])
+			if start > 0 {
+				candidate = continuationPrefix + candidate
+			}
+			if _, ok := w.vocab.ID(candidate); ok {
+				piece = candidate
+				break
+			}
+		}
+		if piece == "" {
+			return []string{w.special.Unknown}
+		}
+		pieces = append(pieces, piece)
+		start = end
+	}
+	return pieces
+}
+
+func stripAccents(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isControl(r rune) bool {
+	if r == '\t' || r == '\n' || r == '\r' {
+		return false
+	}
+	return unicode.IsControl(r) || unicode.In(r, unicode.Cf)
+}
+
+// ASCII symbols count as punctuation like in the BERT reference tokenizer
+func isPunctuation(r rune) bool {
+	if (r >= 33 && r <= 47) || (r >= 58 && r <= 64) || (r >= 91 && r <= 96) || (r >= 123 && r <= 126) {
+		return true
+	}
+	return unicode.IsPunct(r)
+}
+
+func isCJK(r rune) bool {
+	return (r >= 0x4E00 && r <= 0x9FFF) ||
+		(r >= 0x3400 && r <= 0x4DBF) ||
+		(r >= 0x20000 && r <= 0x2A6DF) ||
+		(r >= 0x2A700 && r <= 0x2B73F) ||
+		(r >= 0x2B740 && r <= 0x2B81F) ||
+		(r >= 0x2B820 && r <= 0x2CEAF) ||
+		(r >= 0xF900 && r <= 0xFAFF) ||
+		(r >= 0x2F800 && r <= 0x2FA1F)
+}
@@ -0,0 +1,62 @@
+package tokenizer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testWordPiece(lowerCase bool) *WordPiece {
+	return NewWordPiece(NewVocab([]string{
+		"[PAD]", "[UNK]", "[CLS]", "[SEP]",
+		"the", "un", "##aff", "##able", "quick", "brown", "fox", "cafe",
+		"runn", "##ing", "!", ",", "中", "国",
+	}), lowerCase)
+}
+
+func TestWordPieceTokenize(t *testing.T) {
+	w := testWordPiece(true)
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"The unaffable, quick fox!", []string{"the", "un", "##aff", "##able", ",", "quick", "fox", "!"}},
+		{"  running\tCafé\n", []string{"runn", "##ing", "cafe"}},
+		{"中国", []string{"中", "国"}},
+		{"the jumping fox", []string{"the", "[UNK]", "fox"}},
+		{"", nil},
+	}
+	for _, c := range cases {
+		if got := w.Tokenize(c.text); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestWordPieceCased(t *testing.T) {
+	w := testWordPiece(false)
+	if got, want := w.Tokenize("The fox"), []string{"[UNK]", "fox"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize = %q, want %q", got, want)
+	}
+}
+
+func TestWordPieceLongWord(t *testing.T) {
+	w := testWordPiece(true)
+	long := strings.Repeat("a", w.maxWordLen+1)
+	if got, want := w.Tokenize(long), []string{"[UNK]"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize = %q, want %q", got, want)
+	}
+}
+
+func TestWordPieceRoundTrip(t *testing.T) {
+	w := testWordPiece(true)
+	for _, text := range []string{
+		"the unaffable quick brown fox",
+		"running cafe",
+		"fox",
+	} {
+		if got := w.Detokenize(w.Tokenize(text)); got != text {
+			t.Errorf("Detokenize(Tokenize(%q)) = %q", text, got)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package snpe
+
+import "unsafe"
+
+// Number of elements in a tensor of the given shape
+func shapeSize(shape []int) int {
+	if len(shape) == 0 {
+		return 0
+	}
+	size := 1
+	for _, d := range shape {
+		size *= d
+	}
+	return size
+}
+
+// View a float slice as the byte buffer the native predictor reads
+func float32Bytes(data []float32) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	n := 4 * len(data)
+	return (*[1 << 30]byte)(unsafe.Pointer(&data[0]))[:n:n]
+}